@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+)
+
+const experimentUsage = `usage: chaos-proxy experiment [-admin URL] [-token TOKEN] <command>
+
+commands:
+  list                   Show every experiment and its latest run
+  status <name>          Show an experiment, live while it runs
+  start <name>           Start an experiment
+  abort <name> [reason]  End an experiment early
+
+The admin API address and token are read from config.yaml unless given.`
+
+// experimentCommand controls the experiments of a running chaos-proxy
+// through its admin API
+func experimentCommand(args []string) error {
+	flags := flag.NewFlagSet("experiment", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprintln(flags.Output(), experimentUsage) }
+	adminURL := flags.String("admin", "", "admin API URL, e.g. http://127.0.0.1:9000")
+	token := flags.String("token", "", "admin API bearer token")
+	flags.Parse(args)
+	args = flags.Args()
+
+	if *adminURL == "" {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		if cfg.Admin == nil {
+			return errors.New("config.yaml has no admin API, pass -admin")
+		}
+		*adminURL = adminAddress(cfg.Admin.Listen)
+		if *token == "" {
+			*token = cfg.Admin.Token
+		}
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	name := func() (string, error) {
+		if len(args) < 2 {
+			return "", fmt.Errorf("%s needs an experiment name", args[0])
+		}
+		return url.PathEscape(args[1]), nil
+	}
+
+	var method, path string
+	var body []byte
+	switch args[0] {
+	case "list":
+		method, path = http.MethodGet, "/experiments"
+	case "status", "start", "abort":
+		n, err := name()
+		if err != nil {
+			return err
+		}
+		method, path = http.MethodPost, "/experiments/"+n+"/"+args[0]
+		if args[0] == "status" {
+			method, path = http.MethodGet, "/experiments/"+n
+		}
+		if args[0] == "abort" && len(args) > 2 {
+			body, _ = json.Marshal(map[string]string{"reason": strings.Join(args[2:], " ")})
+		}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(*adminURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if json.Indent(&out, data, "", "  ") != nil {
+		out.Reset()
+		out.Write(data)
+	}
+	fmt.Println(strings.TrimSpace(out.String()))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin API answered %s", resp.Status)
+	}
+	return nil
+}
+
+// adminAddress turns the admin listen address into a URL to call it on
+func adminAddress(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "http://" + listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
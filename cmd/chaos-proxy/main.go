@@ -1,24 +1,33 @@
 package main
 
 import (
-	"context"
-	"fmt"
 	"log"
 	"log/slog"
-	"net/http"
-	"net/http/httputil"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
 	"time"
 
-	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/admin"
 	"github.com/khizar-sudo/chaos-proxy/internal/config"
-	"github.com/khizar-sudo/chaos-proxy/internal/middleware"
+	"github.com/khizar-sudo/chaos-proxy/internal/experiment"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
+	"github.com/khizar-sudo/chaos-proxy/internal/metrics"
+	"github.com/khizar-sudo/chaos-proxy/internal/proxy"
+	"github.com/khizar-sudo/chaos-proxy/internal/steadystate"
+	"github.com/khizar-sudo/chaos-proxy/internal/tracing"
 	"github.com/khizar-sudo/chaos-proxy/internal/watcher"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "experiment" {
+		if err := experimentCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if err := run(); err != nil {
 		log.Fatal(err)
 	}
@@ -31,112 +40,177 @@ func run() error {
 	}
 
 	configPath := "config.yaml"
+	var reloadChan <-chan struct{}
 	watcher, err := watcher.NewWatcher(configPath)
 	if err != nil {
 		slog.Warn("failed to set up config watcher, hot reload disabled")
 	} else {
 		watcher.Start()
 		defer watcher.Close()
+		reloadChan = watcher.ReloadChan()
 		slog.Info("config file watching enabled", "path", configPath)
 	}
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	for {
-		srv, err := startServer(cfg)
-		if err != nil {
+	// SIGUSR1 flips the kill switch
+	toggleChan := make(chan os.Signal, 1)
+	signal.Notify(toggleChan, syscall.SIGUSR1)
+
+	stopKillSwitch := watchKillSwitch(cfg.KillSwitch)
+	defer func() { stopKillSwitch() }()
+
+	// Stopped after the proxies, so the spans of their last requests are sent
+	exporter := reloadTracing(nil, cfg.Tracing)
+	defer func() {
+		if exporter != nil {
+			exporter.Stop()
+		}
+	}()
+
+	manager := proxy.NewManager()
+	if err := manager.Apply(cfg.Proxies); err != nil {
+		manager.Shutdown()
+		return err
+	}
+
+	experiments := experiment.NewRunner(manager)
+	experiments.SetExperiments(cfg.Experiments)
+
+	probes := reloadSteadyState(nil, cfg.SteadyState, experiments)
+	defer func() {
+		if probes != nil {
+			probes.Stop()
+		}
+	}()
+
+	var adminServer *admin.Server
+	if cfg.Admin != nil {
+		adminServer = admin.New(*cfg.Admin, manager, experiments)
+		if err := adminServer.Start(); err != nil {
+			manager.Shutdown()
 			return err
 		}
+	}
 
+	for {
 		select {
 		case <-sigChan:
-			slog.Info("shutdown signal received, stopping server")
-			shutDownServer(srv)
+			slog.Info("shutdown signal received, stopping servers")
+			if adminServer != nil {
+				adminServer.Shutdown()
+			}
+			experiments.Shutdown()
+			manager.Shutdown()
 			return nil
-		case <-watcher.ReloadChan():
+		case <-toggleChan:
+			killswitch.Toggle()
+		case <-reloadChan:
 			slog.Info("reloading configuration...")
-			shutDownServer(srv)
 
 			newCfg, err := config.Load()
 			if err != nil {
 				slog.Error("failed to reload config", "error", err)
 				slog.Info("keeping previous configuration")
+				metrics.ConfigReloaded(false)
+				continue
+			}
+
+			if err := manager.Apply(newCfg.Proxies); err != nil {
+				slog.Error("failed to apply some proxies", "error", err)
+				metrics.ConfigReloaded(false)
 			} else {
-				cfg = newCfg
 				slog.Info("configuration reloaded successfully")
+				metrics.ConfigReloaded(true)
 			}
+			experiments.SetExperiments(newCfg.Experiments)
+			probes = reloadSteadyState(probes, newCfg.SteadyState, experiments)
+			exporter = reloadTracing(exporter, newCfg.Tracing)
+			adminServer = reloadAdmin(adminServer, newCfg.Admin, manager, experiments)
+			stopKillSwitch = reloadKillSwitch(stopKillSwitch, cfg.KillSwitch, newCfg.KillSwitch)
+			cfg = newCfg
 		}
 	}
 }
 
-func startServer(cfg *config.Config) (*http.Server, error) {
-	proxy := httputil.NewSingleHostReverseProxy(cfg.UpstreamURL)
-	latencies, err := cfg.ParseDurations()
-	if err != nil {
-		return nil, err
-	}
-
-	chaosConfig := chaos.ChaosConfig{
-		DropRate:    cfg.Chaos.DropRate,
-		ErrorRate:   cfg.Chaos.ErrorRate,
-		ErrorCode:   cfg.Chaos.ErrorCode,
-		Latency:     latencies.Latency,
-		LatencyMin:  latencies.LatencyMin,
-		LatencyMax:  latencies.LatencyMax,
-		CorruptRate: cfg.Chaos.CorruptRate,
-	}
-	chaosEngine := chaos.NewEngine(chaosConfig)
-
-	// Customize the Director to properly set headers for the upstream request
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-		req.Host = cfg.UpstreamURL.Host
-		req.Header.Set("User-Agent", "chaos-proxy/1.0")
-		req.Header.Set("X-Forwarded-Host", req.Header.Get("Host"))
-	}
-
-	handler := middleware.ChaosMiddleware(
-		http.HandlerFunc(
-			func(w http.ResponseWriter, r *http.Request) {
-				fmt.Printf("[PROXY] %s %s\n", r.Method, r.URL.Path)
-				proxy.ServeHTTP(w, r)
-			}),
-		chaosEngine)
-	handler = middleware.LoggingMiddleware(handler)
-
-	srv := &http.Server{
-		Addr:              cfg.Listen,
-		Handler:           handler,
-		ReadHeaderTimeout: 10 * time.Second,
-	}
-
-	go func() {
-		fmt.Println()
-		fmt.Println("==============================================================================")
-		slog.Info("starting server", "listen", cfg.Listen, "upstream", cfg.UpstreamURL.String())
-		cfg.PrintConfiguration()
-		if err := srv.ListenAndServe(); err != nil {
-			slog.Error("server error", "error", err)
-		}
-	}()
+// reloadAdmin restarts the admin API when its configuration changed
+func reloadAdmin(current *admin.Server, cfg *config.AdminConfig, manager *proxy.Manager, experiments *experiment.Runner) *admin.Server {
+	if current != nil && cfg != nil && current.Config() == *cfg {
+		return current
+	}
+	if current == nil && cfg == nil {
+		return nil
+	}
 
-	time.Sleep(100 * time.Millisecond)
-	return srv, nil
+	if current != nil {
+		current.Shutdown()
+	}
+	if cfg == nil {
+		slog.Info("admin API stopped")
+		return nil
+	}
+
+	next := admin.New(*cfg, manager, experiments)
+	if err := next.Start(); err != nil {
+		slog.Error("failed to start admin API", "error", err)
+		return nil
+	}
+	return next
 }
 
-func shutDownServer(srv *http.Server) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer func() {
-		cancel()
-		fmt.Println()
-	}()
+// watchKillSwitch engages the kill switch while cfg's sentinel file exists
+func watchKillSwitch(cfg *config.KillSwitchConfig) (stop func()) {
+	if cfg == nil {
+		return func() {}
+	}
+	slog.Info("kill switch file watching enabled", "file", cfg.File)
+	return killswitch.WatchFile(cfg.File, time.Second)
+}
 
-	slog.Info("shutting down server...")
-	if err := srv.Shutdown(ctx); err != nil {
-		slog.Error("server shutdown error", "error", err)
-	} else {
-		slog.Info("server stopped gracefully")
+// reloadKillSwitch restarts the sentinel file watch when its configuration
+// changed
+func reloadKillSwitch(stop func(), old, cfg *config.KillSwitchConfig) func() {
+	if old != nil && cfg != nil && *old == *cfg {
+		return stop
 	}
+	stop()
+	return watchKillSwitch(cfg)
+}
+
+// reloadSteadyState restarts the steady state probes when their
+// configuration changed. A failing probe aborts the running experiments.
+func reloadSteadyState(current *steadystate.Monitor, cfg *config.SteadyStateConfig, experiments *experiment.Runner) *steadystate.Monitor {
+	if current != nil && cfg != nil && reflect.DeepEqual(current.Config(), *cfg) {
+		return current
+	}
+
+	if current != nil {
+		current.Stop()
+	}
+	if cfg == nil {
+		return nil
+	}
+
+	next := steadystate.New(*cfg, experiments.AbortAll)
+	next.Start()
+	return next
+}
+
+// reloadTracing restarts the span exporter when its configuration changed
+func reloadTracing(current *tracing.Exporter, cfg *config.TracingConfig) *tracing.Exporter {
+	if current != nil && cfg != nil && reflect.DeepEqual(current.Config(), *cfg) {
+		return current
+	}
+
+	if current != nil {
+		current.Stop()
+	}
+	if cfg == nil {
+		return nil
+	}
+
+	next := tracing.NewExporter(*cfg)
+	next.Start()
+	return next
 }
@@ -2,9 +2,9 @@ module github.com/khizar-sudo/chaos-proxy
 
 go 1.25.5
 
-require gopkg.in/yaml.v3 v3.0.1
-
 require (
-	github.com/fsnotify/fsnotify v1.9.0 // indirect
-	golang.org/x/sys v0.13.0 // indirect
+	github.com/fsnotify/fsnotify v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.13.0 // indirect
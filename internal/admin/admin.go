@@ -0,0 +1,447 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"reflect"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+	"github.com/khizar-sudo/chaos-proxy/internal/experiment"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
+	"github.com/khizar-sudo/chaos-proxy/internal/metrics"
+	"github.com/khizar-sudo/chaos-proxy/internal/proxy"
+)
+
+// Request bodies are small config snippets
+const maxBodySize = 1 << 20
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboard is the web UI, served from the admin listener
+var dashboard, _ = fs.Sub(dashboardFiles, "dashboard")
+
+// Server is the admin API. Changes apply to the running proxies right away
+// and last until the proxy is reloaded from the config file.
+type Server struct {
+	cfg         config.AdminConfig
+	manager     *proxy.Manager
+	experiments *experiment.Runner
+	stats       *stats
+	stopMetrics func()
+	done        chan struct{} // Closed on shutdown, ends the event streams
+	srv         *http.Server
+	addr        net.Addr
+}
+
+func New(cfg config.AdminConfig, manager *proxy.Manager, experiments *experiment.Runner) *Server {
+	s := &Server{cfg: cfg, manager: manager, experiments: experiments, stats: newStats(), done: make(chan struct{})}
+	s.stopMetrics = metrics.Collect()
+	s.srv = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Handler serves the API and the dashboard. Bodies may be JSON or YAML, with
+// the same field names as config.yaml. Responses are JSON.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stats", s.getStats)
+	mux.HandleFunc("GET /events", s.streamEvents)
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.HandleFunc("GET /proxies", s.listProxies)
+	mux.HandleFunc("GET /proxies/{name}", s.withProxy(s.getProxy))
+	mux.HandleFunc("PUT /proxies/{name}/chaos", s.withProxy(s.putChaos))
+	mux.HandleFunc("PATCH /proxies/{name}/chaos", s.withProxy(s.patchChaos))
+	mux.HandleFunc("PUT /proxies/{name}/rules", s.withProxy(s.putRules))
+	mux.HandleFunc("PATCH /proxies/{name}/rules/{rule}", s.withProxy(s.patchRule))
+	mux.HandleFunc("GET /proxies/{name}/faults", s.withProxy(s.getFaults))
+	mux.HandleFunc("PUT /proxies/{name}/faults/{fault}", s.withProxy(s.putFault))
+	mux.HandleFunc("POST /proxies/{name}/reset", s.withProxy(s.reset))
+	mux.HandleFunc("GET /kill-switch", s.getKillSwitch)
+	mux.HandleFunc("PUT /kill-switch", s.putKillSwitch)
+	mux.HandleFunc("GET /experiments", s.listExperiments)
+	mux.HandleFunc("GET /experiments/{name}", s.getExperiment)
+	mux.HandleFunc("POST /experiments/{name}/start", s.startExperiment)
+	mux.HandleFunc("POST /experiments/{name}/abort", s.abortExperiment)
+
+	// The dashboard's files hold no data, the token is asked for by its
+	// API calls
+	site := http.NewServeMux()
+	site.Handle("/", s.authorized(mux))
+	site.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", http.FileServerFS(dashboard)))
+	site.Handle("GET /{$}", http.RedirectHandler("/dashboard/", http.StatusFound))
+	return site
+}
+
+// Start binds the listen address and serves in the background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("admin: failed to listen on %s: %w", s.cfg.Listen, err)
+	}
+	s.addr = ln.Addr()
+
+	slog.Info("starting admin API", "listen", s.cfg.Listen, "token", s.cfg.Token != "")
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("admin server error", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the listener, giving in-flight requests up to 5 seconds
+func (s *Server) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	close(s.done)
+	if err := s.srv.Shutdown(ctx); err != nil {
+		slog.Error("admin server shutdown error", "error", err)
+	}
+	s.stats.close()
+	s.stopMetrics()
+}
+
+// Addr returns the bound listen address, nil before Start
+func (s *Server) Addr() net.Addr {
+	return s.addr
+}
+
+// Config returns the configuration the server was built from
+func (s *Server) Config() config.AdminConfig {
+	return s.cfg
+}
+
+func (s *Server) authorized(next http.Handler) http.Handler {
+	if s.cfg.Token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.cfg.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withProxy looks up the proxy named in the path
+func (s *Server) withProxy(h func(http.ResponseWriter, *http.Request, *proxy.Server)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv, ok := s.manager.Get(r.PathValue("name"))
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no proxy named %q", r.PathValue("name")))
+			return
+		}
+		h(w, r, srv)
+	}
+}
+
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.stats.snapshot())
+}
+
+func (s *Server) listProxies(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]string{"proxies": s.manager.Names()})
+}
+
+func (s *Server) getProxy(w http.ResponseWriter, r *http.Request, srv *proxy.Server) {
+	live := srv.Live()
+	modified := !reflect.DeepEqual(live, srv.Config()) || len(srv.DisabledFaults()) > 0
+
+	if live.Control != nil {
+		control := *live.Control
+		control.Secret = "[redacted]"
+		live.Control = &control
+	}
+	cfg, err := snakeCase(live)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":            live.Name,
+		"config":          cfg,
+		"disabled_faults": srv.DisabledFaults(),
+		"modified":        modified,
+	})
+}
+
+func (s *Server) putChaos(w http.ResponseWriter, r *http.Request, srv *proxy.Server) {
+	var fc config.FileConfig
+	s.updateChaos(w, r, srv, fc, srv.SetChaos)
+}
+
+// patchChaos only changes the fields present in the body
+func (s *Server) patchChaos(w http.ResponseWriter, r *http.Request, srv *proxy.Server) {
+	s.updateChaos(w, r, srv, srv.Live().Chaos, srv.UpdateChaos)
+}
+
+func (s *Server) updateChaos(w http.ResponseWriter, r *http.Request, srv *proxy.Server, fc config.FileConfig, apply func(config.FileConfig) error) {
+	if err := decode(r, &fc); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := apply(fc); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	fmt.Printf("[ADMIN] %s: chaos settings changed\n", srv.Config().Name)
+	s.getProxy(w, r, srv)
+}
+
+func (s *Server) putRules(w http.ResponseWriter, r *http.Request, srv *proxy.Server) {
+	var rules []config.RuleConfig
+	if err := decode(r, &rules); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := srv.SetRules(rules); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	fmt.Printf("[ADMIN] %s: rules replaced (%d rules)\n", srv.Config().Name, len(rules))
+	s.getProxy(w, r, srv)
+}
+
+// patchRule changes the fields present in the body of one rule
+func (s *Server) patchRule(w http.ResponseWriter, r *http.Request, srv *proxy.Server) {
+	name := r.PathValue("rule")
+	rules := append([]config.RuleConfig{}, srv.Live().Rules...)
+
+	i := -1
+	for j, rule := range rules {
+		if rule.Name == name {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no rule named %q", name))
+		return
+	}
+
+	if err := decode(r, &rules[i]); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := srv.SetRules(rules); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	fmt.Printf("[ADMIN] %s: rule %q changed\n", srv.Config().Name, name)
+	s.getProxy(w, r, srv)
+}
+
+func (s *Server) getFaults(w http.ResponseWriter, r *http.Request, srv *proxy.Server) {
+	writeJSON(w, http.StatusOK, faults(srv))
+}
+
+func (s *Server) putFault(w http.ResponseWriter, r *http.Request, srv *proxy.Server) {
+	var body struct {
+		Enabled *bool `yaml:"enabled"`
+	}
+	if err := decode(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.Enabled == nil {
+		writeError(w, http.StatusBadRequest, errors.New("enabled is required"))
+		return
+	}
+
+	fault := r.PathValue("fault")
+	if err := srv.SetFault(fault, *body.Enabled); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	state := "enabled"
+	if !*body.Enabled {
+		state = "disabled"
+	}
+	fmt.Printf("[ADMIN] %s: %s %s\n", srv.Config().Name, fault, state)
+	writeJSON(w, http.StatusOK, faults(srv))
+}
+
+func (s *Server) reset(w http.ResponseWriter, r *http.Request, srv *proxy.Server) {
+	if err := srv.Reset(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	fmt.Printf("[ADMIN] %s: back to the config file\n", srv.Config().Name)
+	s.getProxy(w, r, srv)
+}
+
+func (s *Server) getKillSwitch(w http.ResponseWriter, r *http.Request) {
+	byHand, byFile := killswitch.State()
+	writeJSON(w, http.StatusOK, map[string]bool{
+		"engaged": killswitch.Engaged(),
+		"manual":  byHand,
+		"file":    byFile,
+	})
+}
+
+// putKillSwitch engages or releases the switch by hand. The sentinel file
+// keeps chaos off while it exists, whatever is set here.
+func (s *Server) putKillSwitch(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Engaged *bool `yaml:"engaged"`
+	}
+	if err := decode(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.Engaged == nil {
+		writeError(w, http.StatusBadRequest, errors.New("engaged is required"))
+		return
+	}
+
+	killswitch.Set(*body.Engaged)
+	fmt.Printf("[ADMIN] kill switch set to %v\n", *body.Engaged)
+	s.getKillSwitch(w, r)
+}
+
+func (s *Server) listExperiments(w http.ResponseWriter, r *http.Request) {
+	summaries := s.experiments.List()
+	out := make([]any, 0, len(summaries))
+	for _, summary := range summaries {
+		v, err := snakeCase(summary)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		out = append(out, v)
+	}
+	writeJSON(w, http.StatusOK, map[string][]any{"experiments": out})
+}
+
+func (s *Server) getExperiment(w http.ResponseWriter, r *http.Request) {
+	summary, err := s.experiments.Get(r.PathValue("name"))
+	writeSummary(w, summary, err)
+}
+
+func (s *Server) startExperiment(w http.ResponseWriter, r *http.Request) {
+	summary, err := s.experiments.Start(r.PathValue("name"))
+	writeSummary(w, summary, err)
+}
+
+// abortExperiment takes an optional reason, {"reason": "checkout is down"}
+func (s *Server) abortExperiment(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Reason string `yaml:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := decode(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if body.Reason == "" {
+		body.Reason = "aborted through the admin API"
+	}
+
+	summary, err := s.experiments.Abort(r.PathValue("name"), body.Reason)
+	writeSummary(w, summary, err)
+}
+
+// writeSummary answers with summary, or err with a status depending on what
+// went wrong
+func writeSummary(w http.ResponseWriter, summary experiment.Summary, err error) {
+	switch {
+	case errors.Is(err, experiment.ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, experiment.ErrRunning), errors.Is(err, experiment.ErrNotRunning):
+		writeError(w, http.StatusConflict, err)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		v, err := snakeCase(summary)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+// faults maps every fault to whether it's enabled
+func faults(srv *proxy.Server) map[string]bool {
+	state := make(map[string]bool)
+	for _, fault := range slices.Concat(chaos.Faults, chaos.ProxyFaults) {
+		state[fault] = true
+	}
+	for _, fault := range srv.DisabledFaults() {
+		state[fault] = false
+	}
+	return state
+}
+
+// decode reads a JSON or YAML body into v. JSON is valid YAML, so one decoder
+// covers both, using the yaml tags config.yaml is read with.
+func decode(r *http.Request, v any) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(body))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("body is required")
+		}
+		return fmt.Errorf("invalid body: %w", err)
+	}
+	return nil
+}
+
+// snakeCase converts v to a generic value through its yaml tags, so the
+// JSON output uses the same field names as config.yaml
+func snakeCase(v any) (any, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := yaml.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
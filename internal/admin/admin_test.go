@@ -0,0 +1,479 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+	"github.com/khizar-sudo/chaos-proxy/internal/experiment"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
+	"github.com/khizar-sudo/chaos-proxy/internal/proxy"
+)
+
+// setup runs one proxy named api in front of a healthy upstream and returns
+// the admin API for it
+func setup(t *testing.T, cfg config.AdminConfig) (*httptest.Server, *proxy.Manager) {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	u, _ := url.Parse(upstream.URL)
+	manager := proxy.NewManager()
+	err := manager.Apply([]config.ProxyConfig{{
+		Name:        "api",
+		Mode:        config.ModeReverse,
+		Listen:      "127.0.0.1:0",
+		Upstream:    upstream.URL,
+		UpstreamURL: u,
+		Rules: []config.RuleConfig{
+			{Name: "slow", MatchConfig: config.MatchConfig{PathPrefix: "/slow"}, Chaos: config.FileConfig{Latency: "1ms"}},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	t.Cleanup(manager.Shutdown)
+
+	admin := New(cfg, manager, experiment.NewRunner(manager))
+	t.Cleanup(admin.stats.close)
+	srv := httptest.NewServer(admin.Handler())
+	t.Cleanup(srv.Close)
+	return srv, manager
+}
+
+func call(t *testing.T, srv *httptest.Server, method, path, body string) (int, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var out map[string]any
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+// proxied sends a request through the proxy named api
+func proxied(t *testing.T, manager *proxy.Manager, path string) int {
+	t.Helper()
+	srv, _ := manager.Get("api")
+	resp, err := http.Get("http://" + srv.Addr().String() + path)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAdmin_ListProxies(t *testing.T) {
+	srv, _ := setup(t, config.AdminConfig{})
+
+	code, out := call(t, srv, "GET", "/proxies", "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	names, _ := out["proxies"].([]any)
+	if len(names) != 1 || names[0] != "api" {
+		t.Errorf("Expected [api], got %v", out["proxies"])
+	}
+
+	if code, _ := call(t, srv, "GET", "/proxies/nope", ""); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown proxy, got %d", code)
+	}
+}
+
+func TestAdmin_PatchChaos(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+
+	code, out := call(t, srv, "PATCH", "/proxies/api/chaos", `{"error_rate": 100, "error_code": 503}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %v", code, out)
+	}
+	if out["modified"] != true {
+		t.Error("Expected the proxy to be marked as modified")
+	}
+	chaos := out["config"].(map[string]any)["chaos"].(map[string]any)
+	if chaos["error_rate"] != float64(100) {
+		t.Errorf("Expected error_rate 100 in the live config, got %v", chaos["error_rate"])
+	}
+
+	if code := proxied(t, manager, "/"); code != 503 {
+		t.Errorf("Expected the change to apply right away, got %d", code)
+	}
+
+	// PATCH keeps what isn't in the body
+	call(t, srv, "PATCH", "/proxies/api/chaos", "error_code: 502")
+	if code := proxied(t, manager, "/"); code != 502 {
+		t.Errorf("Expected error_rate to be kept, got %d", code)
+	}
+
+	// PUT replaces everything
+	call(t, srv, "PUT", "/proxies/api/chaos", `{"error_code": 502}`)
+	if code := proxied(t, manager, "/"); code != 200 {
+		t.Errorf("Expected error_rate to be reset by PUT, got %d", code)
+	}
+}
+
+func TestAdmin_InvalidChaos(t *testing.T) {
+	srv, _ := setup(t, config.AdminConfig{})
+
+	tests := map[string]string{
+		"unknown field":  `{"eror_rate": 100}`,
+		"invalid value":  `{"latency": "later"}`,
+		"empty body":     ``,
+		"not an object":  `[1, 2]`,
+		"invalid option": `{"post_failure_mode": "explode"}`,
+		"max below min":  `{"latency_min": "500ms", "latency_max": "100ms"}`,
+	}
+	for name, body := range tests {
+		if code, _ := call(t, srv, "PATCH", "/proxies/api/chaos", body); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", name, code)
+		}
+	}
+}
+
+func TestAdmin_ChaosExpiry(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+
+	// Counted from the PUT, not from when the proxy started
+	time.Sleep(250 * time.Millisecond)
+	call(t, srv, "PUT", "/proxies/api/chaos", `{"error_rate": 100, "expires_after": "200ms"}`)
+	if code := proxied(t, manager, "/"); code != 500 {
+		t.Fatalf("Expected chaos right after the PUT, got %d", code)
+	}
+
+	// A PATCH of something else doesn't restart the countdown
+	time.Sleep(250 * time.Millisecond)
+	call(t, srv, "PATCH", "/proxies/api/chaos", `{"error_code": 503}`)
+	if code := proxied(t, manager, "/"); code != 200 {
+		t.Errorf("Expected expired chaos to stay off after a PATCH, got %d", code)
+	}
+}
+
+func TestAdmin_EqualLatencyBounds(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+
+	code, _ := call(t, srv, "PATCH", "/proxies/api/chaos", `{"latency_min": "1ms", "latency_max": "1ms"}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if code := proxied(t, manager, "/"); code != 200 {
+		t.Errorf("Expected a fixed delay, got %d", code)
+	}
+}
+
+func TestAdmin_Rules(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+
+	code, _ := call(t, srv, "PATCH", "/proxies/api/rules/slow", `{"chaos": {"error_rate": 100, "error_code": 504}}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if code := proxied(t, manager, "/slow/thing"); code != 504 {
+		t.Errorf("Expected the patched rule to apply, got %d", code)
+	}
+	if code := proxied(t, manager, "/fine"); code != 200 {
+		t.Errorf("Expected the rule to keep its path_prefix, got %d", code)
+	}
+
+	if code, _ := call(t, srv, "PATCH", "/proxies/api/rules/nope", `{}`); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown rule, got %d", code)
+	}
+
+	call(t, srv, "PUT", "/proxies/api/rules", `[{"name": "all", "path_prefix": "/", "chaos": {"error_rate": 100, "error_code": 418}}]`)
+	if code := proxied(t, manager, "/fine"); code != 418 {
+		t.Errorf("Expected the new rules to apply, got %d", code)
+	}
+}
+
+func TestAdmin_ToggleFault(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+	call(t, srv, "PATCH", "/proxies/api/chaos", `{"error_rate": 100}`)
+
+	code, out := call(t, srv, "PUT", "/proxies/api/faults/error", `{"enabled": false}`)
+	if code != http.StatusOK || out["error"] != false || out["latency"] != true || out["transport"] != true {
+		t.Fatalf("Expected error to be disabled, got %d %v", code, out)
+	}
+	if code := proxied(t, manager, "/"); code != 200 {
+		t.Errorf("Expected no errors while disabled, got %d", code)
+	}
+
+	call(t, srv, "PUT", "/proxies/api/faults/error", `{"enabled": true}`)
+	if code := proxied(t, manager, "/"); code != 500 {
+		t.Errorf("Expected errors once enabled again, got %d", code)
+	}
+
+	if code, _ := call(t, srv, "PUT", "/proxies/api/faults/meteor", `{"enabled": false}`); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown fault, got %d", code)
+	}
+	if code, _ := call(t, srv, "PUT", "/proxies/api/faults/error", `{}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without enabled, got %d", code)
+	}
+}
+
+func TestAdmin_Reset(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+	call(t, srv, "PATCH", "/proxies/api/chaos", `{"error_rate": 100}`)
+	call(t, srv, "PUT", "/proxies/api/faults/latency", `{"enabled": false}`)
+
+	code, out := call(t, srv, "POST", "/proxies/api/reset", "")
+	if code != http.StatusOK || out["modified"] != false {
+		t.Errorf("Expected the proxy to be back to its config file, got %d %v", code, out)
+	}
+	if code := proxied(t, manager, "/"); code != 200 {
+		t.Errorf("Expected errors to be gone, got %d", code)
+	}
+}
+
+func TestAdmin_KillSwitch(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+	call(t, srv, "PATCH", "/proxies/api/chaos", `{"error_rate": 100}`)
+	t.Cleanup(func() { killswitch.Set(false) })
+
+	code, out := call(t, srv, "PUT", "/kill-switch", `{"engaged": true}`)
+	if code != http.StatusOK || out["engaged"] != true || out["manual"] != true || out["file"] != false {
+		t.Fatalf("Expected the switch to be engaged by hand, got %d %v", code, out)
+	}
+	if code := proxied(t, manager, "/"); code != 200 {
+		t.Errorf("Expected no chaos while engaged, got %d", code)
+	}
+
+	call(t, srv, "PUT", "/kill-switch", `{"engaged": false}`)
+	if _, out := call(t, srv, "GET", "/kill-switch", ""); out["engaged"] != false {
+		t.Errorf("Expected the switch to be released, got %v", out)
+	}
+	if code := proxied(t, manager, "/"); code != 500 {
+		t.Errorf("Expected chaos once released, got %d", code)
+	}
+
+	if code, _ := call(t, srv, "PUT", "/kill-switch", `{}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without engaged, got %d", code)
+	}
+}
+
+func TestAdmin_Experiments(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(upstream.Close)
+	u, _ := url.Parse(upstream.URL)
+	manager := proxy.NewManager()
+	if err := manager.Apply([]config.ProxyConfig{{Name: "api", Mode: config.ModeReverse, Listen: "127.0.0.1:0", UpstreamURL: u}}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	t.Cleanup(manager.Shutdown)
+
+	runner := experiment.NewRunner(manager)
+	runner.SetExperiments([]config.ExperimentConfig{{
+		Name: "outage", Proxy: "api", Duration: "1h", Length: time.Hour,
+		Chaos: config.FileConfig{ErrorRate: 100}, SummaryDir: t.TempDir(),
+	}})
+	srv := httptest.NewServer(New(config.AdminConfig{}, manager, runner).Handler())
+	t.Cleanup(srv.Close)
+
+	code, out := call(t, srv, "POST", "/experiments/outage/start", "")
+	if code != http.StatusOK || out["status"] != "running" {
+		t.Fatalf("Expected the experiment to run, got %d %v", code, out)
+	}
+	if code := proxied(t, manager, "/"); code != 500 {
+		t.Errorf("Expected the experiment's chaos, got %d", code)
+	}
+	if code, _ := call(t, srv, "POST", "/experiments/outage/start", ""); code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a running experiment, got %d", code)
+	}
+
+	code, out = call(t, srv, "POST", "/experiments/outage/abort", `{"reason": "checkout is down"}`)
+	if code != http.StatusOK || out["status"] != "aborted" || out["reason"] != "checkout is down" {
+		t.Errorf("Expected the experiment to be aborted, got %d %v", code, out)
+	}
+	if code := proxied(t, manager, "/"); code != 200 {
+		t.Errorf("Expected the chaos settings to be restored, got %d", code)
+	}
+
+	if code, _ := call(t, srv, "POST", "/experiments/nope/start", ""); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown experiment, got %d", code)
+	}
+	code, out = call(t, srv, "GET", "/experiments", "")
+	if list, _ := out["experiments"].([]any); code != http.StatusOK || len(list) != 1 {
+		t.Errorf("Expected 1 experiment, got %d %v", code, out)
+	}
+}
+
+func TestAdmin_Token(t *testing.T) {
+	srv, _ := setup(t, config.AdminConfig{Token: "secret"})
+
+	if code, _ := call(t, srv, "GET", "/proxies", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a token, got %d", code)
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/proxies", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 with the token, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdmin_Stats(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+	proxied(t, manager, "/slow")
+
+	// The request is counted once the proxy is done with it
+	var out map[string]any
+	deadline := time.Now().Add(2 * time.Second)
+	for out["total"] != 1.0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		_, out = call(t, srv, "GET", "/stats", "")
+	}
+	if out["total"] != 1.0 || out["faulted"] != 1.0 {
+		t.Fatalf("Expected 1 faulted request, got %v", out)
+	}
+	if faults, _ := out["faults"].(map[string]any); faults["latency"] != 1.0 {
+		t.Errorf("Expected 1 latency fault, got %v", out["faults"])
+	}
+	routes, _ := out["routes"].(map[string]any)
+	if api, _ := routes["api"].(map[string]any); api["requests"] != 1.0 {
+		t.Errorf("Expected 1 request for api, got %v", out["routes"])
+	}
+	if recent, _ := out["recent"].([]any); len(recent) != 1 {
+		t.Errorf("Expected 1 logged request, got %v", out["recent"])
+	}
+}
+
+func TestAdmin_Dashboard(t *testing.T) {
+	srv, _ := setup(t, config.AdminConfig{Token: "secret"})
+
+	resp, err := http.Get(srv.URL + "/dashboard/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "app.js") {
+		t.Errorf("Expected the dashboard without a token, got %d %s", resp.StatusCode, body)
+	}
+
+	if code, _ := call(t, srv, "GET", "/stats", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for stats without a token, got %d", code)
+	}
+}
+
+func TestAdmin_Events(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+
+	resp, err := http.Get(srv.URL + "/events?faulted=true")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", ct)
+	}
+
+	proxied(t, manager, "/")
+	proxied(t, manager, "/slow?id=1")
+
+	// Only the faulted request is sent
+	lines := bufio.NewScanner(resp.Body)
+	var data string
+	for lines.Scan() {
+		if line, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+			data = line
+			break
+		}
+	}
+	var event map[string]any
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatalf("Expected a JSON event, got %q: %v", data, err)
+	}
+	if event["proxy"] != "api" || event["path"] != "/slow" || event["query"] != "id=1" || event["status"] != 200.0 {
+		t.Errorf("Expected the request to /slow, got %v", event)
+	}
+	if event["rule"] != "slow" {
+		t.Errorf("Expected rule slow, got %v", event["rule"])
+	}
+	if faults, _ := event["faults"].([]any); len(faults) != 1 || faults[0] != "latency" {
+		t.Errorf("Expected a latency fault, got %v", event["faults"])
+	}
+	decisions, _ := event["decisions"].([]any)
+	if len(decisions) != 1 {
+		t.Fatalf("Expected 1 decision, got %v", event["decisions"])
+	}
+	if d, _ := decisions[0].(map[string]any); d["latency_ms"] != 1.0 {
+		t.Errorf("Expected 1ms of latency, got %v", d)
+	}
+	if event["upstream_status"] != 200.0 {
+		t.Errorf("Expected upstream status 200, got %v", event["upstream_status"])
+	}
+	if timings, _ := event["timings"].(map[string]any); timings["upstream_ms"] == nil {
+		t.Errorf("Expected the upstream time, got %v", event["timings"])
+	}
+}
+
+func TestAdmin_EventsUpstreamStatus(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+	call(t, srv, "PUT", "/proxies/api/chaos", `{"post_failure_rate": 100, "post_failure_mode": "error"}`)
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The upstream answered, the client got the injected error
+	proxied(t, manager, "/")
+	lines := bufio.NewScanner(resp.Body)
+	var data string
+	for lines.Scan() {
+		if line, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+			data = line
+			break
+		}
+	}
+	var event map[string]any
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatalf("Expected a JSON event, got %q: %v", data, err)
+	}
+	if event["status"] != 500.0 {
+		t.Errorf("Expected status 500, got %v", event["status"])
+	}
+	if event["upstream_status"] != 200.0 {
+		t.Errorf("Expected upstream status 200, got %v", event["upstream_status"])
+	}
+}
+
+func TestAdmin_Metrics(t *testing.T) {
+	srv, manager := setup(t, config.AdminConfig{})
+	proxied(t, manager, "/slow")
+
+	// The request is counted once the proxy is done with it
+	want := `chaos_proxy_faults_total{proxy="api",route="",fault="latency",status="200",corrupt_strategy=""}`
+	var body []byte
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(string(body), want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		resp, err := http.Get(srv.URL + "/metrics")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if !strings.Contains(string(body), want) {
+		t.Errorf("Expected the latency fault in the metrics, got:\n%s", body)
+	}
+}
@@ -0,0 +1,203 @@
+'use strict';
+
+// Chaos rates that get a slider, in percent
+const rates = [
+  'error_rate', 'drop_rate', 'corrupt_rate', 'stale_rate',
+  'duplicate_rate', 'post_failure_rate', 'reorder_rate',
+];
+
+const $ = id => document.getElementById(id);
+
+// api calls the admin API, asking for the token when it's refused
+async function api(method, path, body) {
+  for (;;) {
+    const headers = {};
+    const token = sessionStorage.getItem('chaos-proxy-token');
+    if (token) {
+      headers.Authorization = 'Bearer ' + token;
+    }
+    if (body !== undefined) {
+      headers['Content-Type'] = 'application/json';
+    }
+    const resp = await fetch(new URL('../' + path, location.href), {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (resp.status === 401) {
+      const entered = prompt('Admin API token');
+      if (entered === null) {
+        throw new Error('unauthorized');
+      }
+      sessionStorage.setItem('chaos-proxy-token', entered);
+      continue;
+    }
+    const data = await resp.json();
+    if (!resp.ok) {
+      throw new Error(data.error || resp.statusText);
+    }
+    return data;
+  }
+}
+
+function el(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined) {
+    e.textContent = text;
+  }
+  if (className) {
+    e.className = className;
+  }
+  return e;
+}
+
+function row(...cells) {
+  const tr = el('tr');
+  for (const cell of cells) {
+    tr.append(cell instanceof Node ? cell : el('td', String(cell)));
+  }
+  return tr;
+}
+
+function bar(value, max) {
+  const td = el('td');
+  td.style.width = '50%';
+  const div = el('div', undefined, 'bar');
+  div.style.width = (max > 0 ? value * 100 / max : 0) + '%';
+  td.append(div);
+  return td;
+}
+
+function num(value) {
+  return el('td', String(value), 'num');
+}
+
+function render(stats) {
+  const rate = stats.rate;
+  $('rate-now').textContent = rate[rate.length - 2] ?? 0; // The last full second
+  $('total').textContent = stats.total;
+  $('faulted').textContent = stats.faulted;
+
+  const peak = Math.max(1, ...rate);
+  const points = rate.map((n, i) => `${i * 600 / (rate.length - 1)},${80 - n * 76 / peak}`);
+  $('rate').innerHTML = `<polyline points="${points.join(' ')}"/>`;
+
+  const faults = Object.entries(stats.faults).sort((a, b) => b[1] - a[1]);
+  const mostFaults = Math.max(0, ...faults.map(f => f[1]));
+  $('faults').replaceChildren(...faults.map(([fault, n]) => row(fault, bar(n, mostFaults), num(n))));
+  if (faults.length === 0) {
+    $('faults').replaceChildren(row('No faults injected yet'));
+  }
+
+  const counts = stats.latency.counts;
+  const mostLatency = Math.max(0, ...counts);
+  $('latency').replaceChildren(...stats.latency.buckets.map((bucket, i) =>
+    row(bucket, bar(counts[i], mostLatency), num(counts[i]))));
+
+  const routes = Object.entries(stats.routes).sort((a, b) => a[0].localeCompare(b[0]));
+  $('routes').replaceChildren(
+    row(el('th', 'Route'), el('th', 'Requests'), el('th', 'Faults')),
+    ...routes.map(([route, rs]) => row(route, num(rs.requests),
+      Object.entries(rs.faults).map(([f, n]) => `${f} ${n}`).join(', ') || '-')));
+
+  $('recent').replaceChildren(
+    row(el('th', 'Time'), el('th', 'Route'), el('th', 'Request'), el('th', 'Status'), el('th', 'Duration'), el('th', 'Faults')),
+    ...stats.recent.map(r => {
+      const tr = row(
+        new Date(r.time).toLocaleTimeString(),
+        r.route ? `${r.proxy}/${r.route}` : r.proxy,
+        `${r.method} ${r.path}`,
+        r.status || 'none',
+        num(r.duration_ms.toFixed(1) + ' ms'),
+        (r.faults || []).join(', '));
+      if (r.faults && r.faults.length > 0) {
+        tr.className = 'faulted';
+      }
+      return tr;
+    }));
+
+  $('status').textContent = 'since ' + new Date(stats.since).toLocaleString();
+}
+
+async function renderKillSwitch() {
+  const state = await api('GET', 'kill-switch');
+  const button = $('kill-switch');
+  button.classList.toggle('engaged', state.engaged);
+  button.textContent = state.engaged ? 'Chaos off (kill switch engaged)' : 'Kill switch';
+  button.disabled = state.file; // Only removing the file releases it
+  return state;
+}
+
+async function renderControls() {
+  const name = $('proxy').value;
+  if (!name) {
+    return;
+  }
+  const proxy = await api('GET', 'proxies/' + encodeURIComponent(name));
+  const faults = await api('GET', 'proxies/' + encodeURIComponent(name) + '/faults');
+  const chaos = proxy.config.chaos || {};
+
+  const controls = rates.map(rate => {
+    const label = el('label');
+    const value = el('span', String(chaos[rate] || 0) + '%', 'num');
+    const slider = el('input');
+    slider.type = 'range';
+    slider.min = 0;
+    slider.max = 100;
+    slider.value = chaos[rate] || 0;
+    slider.oninput = () => { value.textContent = slider.value + '%'; };
+    slider.onchange = () => update('PATCH', 'chaos', { [rate]: Number(slider.value) });
+    label.append(el('span', rate.replace(/_rate$/, '').replace('_', ' ')), slider, value);
+    return label;
+  });
+  for (const [fault, enabled] of Object.entries(faults).sort()) {
+    const label = el('label');
+    const toggle = el('input');
+    toggle.type = 'checkbox';
+    toggle.checked = enabled;
+    toggle.onchange = () => update('PUT', 'faults/' + fault, { enabled: toggle.checked });
+    label.append(toggle, el('span', fault + ' enabled'));
+    controls.push(label);
+  }
+  $('controls').replaceChildren(...controls);
+}
+
+async function update(method, path, body) {
+  $('error').textContent = '';
+  try {
+    await api(method, 'proxies/' + encodeURIComponent($('proxy').value) + '/' + path, body);
+  } catch (err) {
+    $('error').textContent = err.message;
+  }
+  await renderControls();
+}
+
+async function refresh() {
+  try {
+    render(await api('GET', 'stats'));
+  } catch (err) {
+    $('status').textContent = err.message;
+  }
+}
+
+async function init() {
+  const { proxies } = await api('GET', 'proxies');
+  $('proxy').replaceChildren(...proxies.map(name => {
+    const option = el('option', name);
+    option.value = name;
+    return option;
+  }));
+  $('proxy').onchange = renderControls;
+
+  $('kill-switch').onclick = async () => {
+    const state = await api('GET', 'kill-switch');
+    await api('PUT', 'kill-switch', { engaged: !state.engaged });
+    await renderKillSwitch();
+  };
+
+  await Promise.all([renderControls(), renderKillSwitch(), refresh()]);
+  setInterval(refresh, 1000);
+  setInterval(renderKillSwitch, 5000);
+}
+
+init().catch(err => { $('status').textContent = err.message; });
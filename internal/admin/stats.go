@@ -0,0 +1,181 @@
+package admin
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/events"
+)
+
+// Upper bounds of the latency histogram, the last bucket takes the rest
+var latencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+const (
+	rateSeconds = 60  // Request rate history
+	recentSize  = 100 // Requests in the recent log
+)
+
+// loggedRequest is one line of the dashboard's request log
+type loggedRequest struct {
+	Time       time.Time `json:"time"`
+	Proxy      string    `json:"proxy"`
+	Route      string    `json:"route"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+	Faults     []string  `json:"faults"`
+}
+
+type routeStats struct {
+	Requests int            `json:"requests"`
+	Faults   map[string]int `json:"faults"`
+}
+
+// stats aggregates the events of every proxy for the dashboard
+type stats struct {
+	mu          sync.Mutex
+	started     time.Time
+	total       int
+	faulted     int
+	perSec      [rateSeconds]int   // Requests per second, indexed by unix second
+	secs        [rateSeconds]int64 // The second each slot of perSec counts
+	faults      map[string]int
+	routes      map[string]*routeStats // By "proxy" or "proxy/route"
+	latency     []int                  // Per latency bucket
+	recent      []loggedRequest        // Ring of the latest requests
+	next        int                    // Where the next request goes in recent
+	now         func() time.Time
+	unsubscribe func()
+}
+
+func newStats() *stats {
+	st := &stats{
+		started: time.Now(),
+		faults:  make(map[string]int),
+		routes:  make(map[string]*routeStats),
+		latency: make([]int, len(latencyBuckets)+1),
+		now:     time.Now,
+	}
+	st.unsubscribe = events.Subscribe(st.add)
+	return st
+}
+
+func (st *stats) add(e events.Event) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.total++
+	faults := e.Faults()
+	if len(faults) > 0 {
+		st.faulted++
+	}
+
+	sec := st.now().Unix()
+	slot := sec % rateSeconds
+	if st.secs[slot] != sec {
+		st.secs[slot], st.perSec[slot] = sec, 0
+	}
+	st.perSec[slot]++
+
+	label := e.Proxy
+	if e.Route != "" {
+		label += "/" + e.Route
+	}
+	rs, ok := st.routes[label]
+	if !ok {
+		rs = &routeStats{Faults: make(map[string]int)}
+		st.routes[label] = rs
+	}
+	rs.Requests++
+	for _, fault := range faults {
+		st.faults[fault]++
+		rs.Faults[fault]++
+	}
+
+	bucket := len(latencyBuckets)
+	for i, bound := range latencyBuckets {
+		if e.Duration <= bound {
+			bucket = i
+			break
+		}
+	}
+	st.latency[bucket]++
+
+	logged := loggedRequest{
+		Time:       e.Start,
+		Proxy:      e.Proxy,
+		Route:      e.Route,
+		Method:     e.Method,
+		Path:       e.Path,
+		Status:     e.Status,
+		DurationMs: float64(e.Duration.Microseconds()) / 1000,
+		Faults:     faults,
+	}
+	if len(st.recent) < recentSize {
+		st.recent = append(st.recent, logged)
+	} else {
+		st.recent[st.next] = logged
+	}
+	st.next = (st.next + 1) % recentSize
+}
+
+// snapshot returns the stats as the dashboard reads them
+func (st *stats) snapshot() map[string]any {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// Oldest second first, the current one is still counting
+	now := st.now().Unix()
+	rate := make([]int, rateSeconds)
+	for i := range rate {
+		sec := now - rateSeconds + 1 + int64(i)
+		if slot := sec % rateSeconds; st.secs[slot] == sec {
+			rate[i] = st.perSec[slot]
+		}
+	}
+
+	// Newest first
+	recent := make([]loggedRequest, 0, len(st.recent))
+	for i := 1; i <= len(st.recent); i++ {
+		recent = append(recent, st.recent[(st.next-i+recentSize)%recentSize])
+	}
+
+	buckets := make([]string, 0, len(latencyBuckets)+1)
+	for _, bound := range latencyBuckets {
+		buckets = append(buckets, "≤"+bound.String())
+	}
+	buckets = append(buckets, ">"+latencyBuckets[len(latencyBuckets)-1].String())
+
+	routes := make(map[string]routeStats, len(st.routes))
+	for label, rs := range st.routes {
+		routes[label] = routeStats{Requests: rs.Requests, Faults: maps.Clone(rs.Faults)}
+	}
+
+	return map[string]any{
+		"since":   st.started,
+		"total":   st.total,
+		"faulted": st.faulted,
+		"rate":    rate,
+		"faults":  maps.Clone(st.faults),
+		"routes":  routes,
+		"latency": map[string]any{"buckets": buckets, "counts": append([]int(nil), st.latency...)},
+		"recent":  recent,
+	}
+}
+
+func (st *stats) close() {
+	st.unsubscribe()
+}
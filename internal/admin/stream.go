@@ -0,0 +1,210 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/events"
+)
+
+const (
+	streamBuffer    = 1024             // Events queued per client before they are dropped
+	streamKeepAlive = 15 * time.Second // Comment sent when there's no traffic, so idle proxies don't cut the stream
+)
+
+// streamedDecision is a chaos.Decision with durations in milliseconds
+type streamedDecision struct {
+	Rule             string   `json:"rule"`
+	Faults           []string `json:"faults"`
+	Drop             bool     `json:"drop"`
+	Error            bool     `json:"error"`
+	ErrorCode        int      `json:"error_code,omitempty"`
+	LatencyMs        float64  `json:"latency_ms"`
+	Corrupt          bool     `json:"corrupt"`
+	CorruptStrategy  string   `json:"corrupt_strategy,omitempty"`
+	Stale            bool     `json:"stale"`
+	StaleVersions    int      `json:"stale_versions,omitempty"`
+	StaleAgeMs       float64  `json:"stale_age_ms,omitempty"`
+	StaleKeepHeaders bool     `json:"stale_keep_headers,omitempty"`
+	Duplicates       int      `json:"duplicates"`
+	DuplicateDelayMs float64  `json:"duplicate_delay_ms,omitempty"`
+	PostFailure      string   `json:"post_failure,omitempty"`
+	Reorder          bool     `json:"reorder"`
+	ReorderWindowMs  float64  `json:"reorder_window_ms,omitempty"`
+	ReorderCount     int      `json:"reorder_count,omitempty"`
+	ReorderOrder     string   `json:"reorder_order,omitempty"`
+}
+
+// streamedEvent is what a client of the event stream gets for one request
+type streamedEvent struct {
+	Time            time.Time          `json:"time"`
+	Proxy           string             `json:"proxy"`
+	Route           string             `json:"route"`
+	Method          string             `json:"method"`
+	Host            string             `json:"host"`
+	Path            string             `json:"path"`
+	Query           string             `json:"query"`
+	Client          string             `json:"client"`
+	RequestID       string             `json:"request_id"`
+	Status          int                `json:"status"`          // What the client got, injected errors included, 0 when nothing was sent
+	UpstreamStatus  int                `json:"upstream_status"` // What the upstream answered, 0 when it never did
+	Rule            string             `json:"rule"`            // The first matched rule, empty for the default config
+	Faults          []string           `json:"faults"`
+	CorruptStrategy string             `json:"corrupt_strategy"`
+	Decisions       []streamedDecision `json:"decisions"` // One per chaos layer the request passed
+	Timings         streamedTimings    `json:"timings"`
+}
+
+type streamedTimings struct {
+	DurationMs        float64  `json:"duration_ms"`
+	InjectedLatencyMs float64  `json:"injected_latency_ms"`
+	UpstreamMs        *float64 `json:"upstream_ms"` // null when the request never reached the upstream
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func newStreamedEvent(e events.Event) streamedEvent {
+	out := streamedEvent{
+		Time:           e.Start,
+		Proxy:          e.Proxy,
+		Route:          e.Route,
+		Method:         e.Method,
+		Host:           e.Host,
+		Path:           e.Path,
+		Query:          e.Query,
+		Client:         e.Client,
+		RequestID:      e.RequestID,
+		Status:         e.Status,
+		UpstreamStatus: e.UpstreamStatus,
+		Faults:         e.Faults(),
+		Decisions:      make([]streamedDecision, 0, len(e.Decisions)),
+		Timings: streamedTimings{
+			DurationMs:        ms(e.Duration),
+			InjectedLatencyMs: ms(e.InjectedLatency()),
+		},
+	}
+	if out.Faults == nil {
+		out.Faults = []string{}
+	}
+	if d, ok := e.Upstream(); ok {
+		upstream := ms(d)
+		out.Timings.UpstreamMs = &upstream
+	}
+
+	for _, d := range e.Decisions {
+		if out.Rule == "" {
+			out.Rule = d.Rule
+		}
+		if out.CorruptStrategy == "" {
+			out.CorruptStrategy = d.CorruptStrategy
+		}
+		out.Decisions = append(out.Decisions, newStreamedDecision(d))
+	}
+	return out
+}
+
+func newStreamedDecision(d chaos.Decision) streamedDecision {
+	faults := d.Faults()
+	if faults == nil {
+		faults = []string{}
+	}
+	return streamedDecision{
+		Rule:             d.Rule,
+		Faults:           faults,
+		Drop:             d.Drop,
+		Error:            d.ReturnError,
+		ErrorCode:        d.ErrorCode,
+		LatencyMs:        ms(d.Latency),
+		Corrupt:          d.Corrupt,
+		CorruptStrategy:  d.CorruptStrategy,
+		Stale:            d.Stale,
+		StaleVersions:    d.StaleVersions,
+		StaleAgeMs:       ms(d.StaleAge),
+		StaleKeepHeaders: d.StaleKeepHeaders,
+		Duplicates:       d.Duplicates,
+		DuplicateDelayMs: ms(d.DuplicateDelay),
+		PostFailure:      d.PostFailure,
+		Reorder:          d.Reorder,
+		ReorderWindowMs:  ms(d.ReorderWindow),
+		ReorderCount:     d.ReorderCount,
+		ReorderOrder:     d.ReorderOrder,
+	}
+}
+
+// streamEvents sends every request as a server-sent event until the client
+// goes away. ?proxy= keeps one proxy's requests, ?faulted=true only those
+// with a fault. A client too slow to keep up loses events, it's told how many
+// in a "dropped" event.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	proxy := r.URL.Query().Get("proxy")
+	faultedOnly := r.URL.Query().Get("faulted") == "true"
+
+	queue := make(chan events.Event, streamBuffer)
+	dropped := make(chan struct{}, 1)
+	var lost atomic.Int64
+	unsubscribe := events.Subscribe(func(e events.Event) {
+		if proxy != "" && e.Proxy != proxy {
+			return
+		}
+		if faultedOnly && len(e.Faults()) == 0 {
+			return
+		}
+		select {
+		case queue <- e:
+		default:
+			lost.Add(1)
+			select {
+			case dropped <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e := <-queue:
+			data, err := json.Marshal(newStreamedEvent(e))
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: request\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-dropped:
+			n := lost.Swap(0)
+			if _, err := fmt.Fprintf(w, "event: dropped\ndata: {\"count\": %d}\n\n", n); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,155 @@
+package balancer
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand" // #nosec G404 - math/rand is sufficient for chaos testing, cryptographic randomness not required
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	RoundRobin     = "round_robin"
+	Random         = "random"
+	LeastConn      = "least_conn"
+	ConsistentHash = "consistent_hash"
+)
+
+// Virtual nodes per backend on the consistent hash ring
+const ringReplicas = 100
+
+// Backend is one member of a pool
+type Backend struct {
+	Name    string
+	URL     *url.URL
+	Handler http.Handler // Proxies to URL, usually wrapped in the backend's own chaos
+
+	active atomic.Int64
+}
+
+// Active returns the number of requests currently being served by b
+func (b *Backend) Active() int64 {
+	return b.active.Load()
+}
+
+type ringEntry struct {
+	hash    uint32
+	backend *Backend
+}
+
+// Pool spreads requests over its backends using one of the strategies above
+type Pool struct {
+	backends   []*Backend
+	strategy   string
+	hashHeader string
+
+	next atomic.Uint64
+	ring []ringEntry
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewPool creates a pool. hashHeader picks the consistent hash key, the
+// client IP is used when it's empty or missing from the request.
+func NewPool(strategy, hashHeader string, backends []*Backend) (*Pool, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("pool needs at least one backend")
+	}
+	if strategy == "" {
+		strategy = RoundRobin
+	}
+
+	p := &Pool{
+		backends:   backends,
+		strategy:   strategy,
+		hashHeader: hashHeader,
+		rnd:        rand.New(rand.NewSource(time.Now().UnixNano())), // #nosec G404 - chaos testing doesn't need crypto rand
+	}
+
+	switch strategy {
+	case RoundRobin, Random, LeastConn:
+	case ConsistentHash:
+		p.buildRing()
+	default:
+		return nil, fmt.Errorf("unsupported balance strategy %q", strategy)
+	}
+
+	return p, nil
+}
+
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := p.Pick(r)
+
+	b.active.Add(1)
+	defer b.active.Add(-1)
+
+	fmt.Printf("[BALANCE] %s %s -> %s (%s)\n", r.Method, r.URL.Path, b.Name, b.URL.Host)
+	b.Handler.ServeHTTP(w, r)
+}
+
+// Pick selects the backend for r without serving it
+func (p *Pool) Pick(r *http.Request) *Backend {
+	switch p.strategy {
+	case Random:
+		p.mu.Lock()
+		i := p.rnd.Intn(len(p.backends))
+		p.mu.Unlock()
+		return p.backends[i]
+	case LeastConn:
+		best := p.backends[0]
+		for _, b := range p.backends[1:] {
+			if b.Active() < best.Active() {
+				best = b
+			}
+		}
+		return best
+	case ConsistentHash:
+		return p.lookup(p.hashKey(r))
+	default:
+		n := p.next.Add(1) - 1
+		return p.backends[n%uint64(len(p.backends))]
+	}
+}
+
+func (p *Pool) buildRing() {
+	for _, b := range p.backends {
+		for i := 0; i < ringReplicas; i++ {
+			key := b.URL.String() + "#" + strconv.Itoa(i)
+			p.ring = append(p.ring, ringEntry{hash: crc32.ChecksumIEEE([]byte(key)), backend: b})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool {
+		return p.ring[i].hash < p.ring[j].hash
+	})
+}
+
+func (p *Pool) lookup(key string) *Backend {
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(p.ring), func(i int) bool {
+		return p.ring[i].hash >= h
+	})
+	if i == len(p.ring) {
+		i = 0
+	}
+	return p.ring[i].backend
+}
+
+func (p *Pool) hashKey(r *http.Request) string {
+	if p.hashHeader != "" {
+		if v := r.Header.Get(p.hashHeader); v != "" {
+			return v
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,140 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newBackends(n int) []*Backend {
+	backends := make([]*Backend, n)
+	for i := range backends {
+		name := fmt.Sprintf("backend-%d", i+1)
+		u, _ := url.Parse("http://" + name + ".internal")
+		backends[i] = &Backend{
+			Name: name,
+			URL:  u,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(name))
+			}),
+		}
+	}
+	return backends
+}
+
+func TestNewPool_Invalid(t *testing.T) {
+	if _, err := NewPool(RoundRobin, "", nil); err == nil {
+		t.Error("Expected error for empty pool, got nil")
+	}
+	if _, err := NewPool("fastest", "", newBackends(2)); err == nil {
+		t.Error("Expected error for unknown strategy, got nil")
+	}
+}
+
+func TestPool_RoundRobin(t *testing.T) {
+	backends := newBackends(3)
+	pool, err := NewPool("", "", backends)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < 6; i++ {
+		if got := pool.Pick(req); got != backends[i%3] {
+			t.Errorf("Request %d: expected %s, got %s", i, backends[i%3].Name, got.Name)
+		}
+	}
+}
+
+func TestPool_Random(t *testing.T) {
+	backends := newBackends(3)
+	pool, _ := NewPool(Random, "", backends)
+
+	seen := make(map[*Backend]int)
+	req := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < 300; i++ {
+		seen[pool.Pick(req)]++
+	}
+
+	for _, b := range backends {
+		if seen[b] == 0 {
+			t.Errorf("Expected %s to be picked at least once", b.Name)
+		}
+	}
+}
+
+func TestPool_LeastConn(t *testing.T) {
+	backends := newBackends(3)
+	pool, _ := NewPool(LeastConn, "", backends)
+
+	backends[0].active.Store(5)
+	backends[1].active.Store(1)
+	backends[2].active.Store(3)
+
+	if got := pool.Pick(httptest.NewRequest("GET", "/", nil)); got != backends[1] {
+		t.Errorf("Expected least busy backend-2, got %s", got.Name)
+	}
+}
+
+func TestPool_ConsistentHash(t *testing.T) {
+	backends := newBackends(3)
+	pool, _ := NewPool(ConsistentHash, "X-User-ID", backends)
+
+	// The same key always lands on the same backend
+	for _, user := range []string{"alice", "bob", "carol"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-User-ID", user)
+		first := pool.Pick(req)
+		for i := 0; i < 10; i++ {
+			if got := pool.Pick(req); got != first {
+				t.Errorf("Expected %s to stick to %s, got %s", user, first.Name, got.Name)
+			}
+		}
+	}
+
+	// Different keys spread over the ring
+	seen := make(map[*Backend]bool)
+	for i := 0; i < 200; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-User-ID", fmt.Sprintf("user-%d", i))
+		seen[pool.Pick(req)] = true
+	}
+	if len(seen) != len(backends) {
+		t.Errorf("Expected keys to spread over all %d backends, got %d", len(backends), len(seen))
+	}
+}
+
+func TestPool_ConsistentHashFallsBackToClientIP(t *testing.T) {
+	pool, _ := NewPool(ConsistentHash, "X-User-ID", newBackends(3))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.7:51234"
+	first := pool.Pick(req)
+
+	// Same client IP, different source port
+	req.RemoteAddr = "10.0.0.7:40000"
+	if got := pool.Pick(req); got != first {
+		t.Errorf("Expected client IP to pick the same backend, got %s and %s", first.Name, got.Name)
+	}
+}
+
+func TestPool_ServeHTTP(t *testing.T) {
+	backends := newBackends(2)
+	pool, _ := NewPool(RoundRobin, "", backends)
+
+	for _, want := range []string{"backend-1", "backend-2"} {
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Body.String() != want {
+			t.Errorf("Expected response from %s, got '%s'", want, rec.Body.String())
+		}
+	}
+
+	for _, b := range backends {
+		if b.Active() != 0 {
+			t.Errorf("Expected %s to have no active requests after serving, got %d", b.Name, b.Active())
+		}
+	}
+}
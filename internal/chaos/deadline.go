@@ -0,0 +1,39 @@
+package chaos
+
+import (
+	"sync"
+	"time"
+)
+
+// Deadline is when a proxy's chaos expires. Every engine, handshake fault
+// and transport fault of a proxy reads the same one, so they agree after a
+// change at runtime. The zero time never expires, so does a nil Deadline.
+type Deadline struct {
+	mu sync.RWMutex
+	t  time.Time
+}
+
+func NewDeadline(t time.Time) *Deadline {
+	return &Deadline{t: t}
+}
+
+func (d *Deadline) Get() time.Time {
+	if d == nil {
+		return time.Time{}
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.t
+}
+
+func (d *Deadline) Set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.t = t
+}
+
+// Passed reports whether now is after the deadline
+func (d *Deadline) Passed(now time.Time) bool {
+	t := d.Get()
+	return !t.IsZero() && now.After(t)
+}
@@ -1,56 +1,255 @@
 package chaos
 
 import (
+	"fmt"
 	"math/rand" // #nosec G404 - math/rand is sufficient for chaos testing, cryptographic randomness not required
 	"net/http"
+	"slices"
+	"sync"
 	"time"
 )
 
+// Faults that can be switched off at runtime, whatever their rates say
+const (
+	FaultDrop        = "drop"
+	FaultError       = "error"
+	FaultLatency     = "latency"
+	FaultCorrupt     = "corrupt"
+	FaultStale       = "stale"
+	FaultDuplicate   = "duplicate"
+	FaultPostFailure = "post_failure"
+	FaultReorder     = "reorder"
+)
+
+var Faults = []string{FaultDrop, FaultError, FaultLatency, FaultCorrupt, FaultStale, FaultDuplicate, FaultPostFailure, FaultReorder}
+
+// Faults of the whole proxy rather than its engines, switched off as a group
+const (
+	FaultTransport    = "transport"     // Every fault on the upstream connections
+	FaultTLSHandshake = "tls_handshake" // Every fault on the listener's handshakes
+	FaultRateLimit    = "rate_limit"
+)
+
+var ProxyFaults = []string{FaultTransport, FaultTLSHandshake, FaultRateLimit}
+
 type Engine struct {
-	config ChaosConfig
-	rnd    *rand.Rand
+	mu       sync.Mutex
+	config   ChaosConfig
+	disabled map[string]bool
+	rnd      *rand.Rand
+	now      func() time.Time
+	expired  bool // The expiry was logged
 }
 
 func NewEngine(cfg ChaosConfig) *Engine {
 	return &Engine{
-		config: cfg,
-		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())), // #nosec G404 - chaos testing doesn't need crypto rand
+		config:   cfg,
+		disabled: make(map[string]bool),
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())), // #nosec G404 - chaos testing doesn't need crypto rand
+		now:      time.Now,
 	}
 }
 
 func (e *Engine) Decide(r *http.Request) Decision {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	if expired(e.config, now) {
+		if !e.expired {
+			e.expired = true
+			fmt.Printf("[CHAOS] Chaos expired at %s, passing traffic through\n", activeUntil(e.config).Format(time.RFC3339))
+		}
+		return Decision{}
+	}
+	e.expired = false // The deadline may have moved since
+
+	for _, rule := range e.config.Rules {
+		// An expired rule is gone, the next match applies
+		if !expired(rule.Config, now) && rule.Matches(r) {
+			decision := e.decide(e.enabled(rule.Config))
+			decision.Rule = rule.Name
+			return decision
+		}
+	}
+
+	return e.decide(e.enabled(e.config))
+}
+
+// Config returns the config requests are decided by
+func (e *Engine) Config() ChaosConfig {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.config
+}
+
+// SetConfig replaces the config, the next request is decided by cfg
+func (e *Engine) SetConfig(cfg ChaosConfig) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.config = cfg
+	e.expired = false
+}
+
+// SetRules replaces only the rules of the config
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.config.Rules = rules
+}
+
+// SetFault switches one of Faults on or off. Its rates stay configured, a
+// disabled fault just never fires.
+func (e *Engine) SetFault(fault string, enabled bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if enabled {
+		delete(e.disabled, fault)
+	} else {
+		e.disabled[fault] = true
+	}
+}
+
+// Disabled returns the faults switched off, in the order of Faults
+func (e *Engine) Disabled() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	disabled := []string{}
+	for _, fault := range Faults {
+		if e.disabled[fault] {
+			disabled = append(disabled, fault)
+		}
+	}
+	return disabled
+}
+
+// enabled returns cfg without the disabled faults
+func (e *Engine) enabled(cfg ChaosConfig) ChaosConfig {
+	if len(e.disabled) == 0 {
+		return cfg
+	}
+
+	for fault := range e.disabled {
+		switch fault {
+		case FaultDrop:
+			cfg.DropRate = 0
+		case FaultError:
+			cfg.ErrorRate = 0
+		case FaultLatency:
+			cfg.Latency, cfg.LatencyMin, cfg.LatencyMax = 0, 0, 0
+		case FaultCorrupt:
+			cfg.CorruptRate = 0
+		case FaultStale:
+			cfg.StaleRate = 0
+		case FaultDuplicate:
+			cfg.DuplicateRate = 0
+		case FaultPostFailure:
+			cfg.PostFailureRate = 0
+		case FaultReorder:
+			cfg.ReorderRate = 0
+		}
+	}
+	return cfg
+}
+
+func expired(cfg ChaosConfig, now time.Time) bool {
+	until := activeUntil(cfg)
+	return !until.IsZero() && now.After(until)
+}
+
+// activeUntil returns when cfg expires, its own time or else its Deadline's
+func activeUntil(cfg ChaosConfig) time.Time {
+	if !cfg.ActiveUntil.IsZero() {
+		return cfg.ActiveUntil
+	}
+	return cfg.Deadline.Get()
+}
+
+// IsFault reports whether name is one of Faults
+func IsFault(name string) bool {
+	return slices.Contains(Faults, name)
+}
+
+func (e *Engine) decide(cfg ChaosConfig) Decision {
 	decison := Decision{}
 
-	if e.shouldApply(e.config.DropRate) {
+	if e.shouldApply(cfg.DropRate) {
 		decison.Drop = true
 		// Dropping a request is terminal. No need to evaluate other conditions
 		return decison
 	}
 
-	if e.shouldApply((e.config.ErrorRate)) {
+	if e.shouldApply((cfg.ErrorRate)) {
 		decison.ReturnError = true
-		if e.config.ErrorCode == 0 {
+		if cfg.ErrorCode == 0 {
 			decison.ErrorCode = 500
 		} else {
-			decison.ErrorCode = e.config.ErrorCode
+			decison.ErrorCode = cfg.ErrorCode
 		}
 	}
 
-	if e.config.Latency > 0 {
-		decison.Latency = e.config.Latency
-	} else if e.config.LatencyMax >= e.config.LatencyMin && e.config.LatencyMax > 0 {
-		diff := e.config.LatencyMax - e.config.LatencyMin
+	if cfg.Latency > 0 {
+		decison.Latency = cfg.Latency
+	} else if cfg.LatencyMax >= cfg.LatencyMin && cfg.LatencyMax > 0 {
+		decison.Latency = cfg.LatencyMin
+
+		// Equal bounds are a fixed delay, Int63n panics on 0
+		if diff := cfg.LatencyMax - cfg.LatencyMin; diff > 0 {
+			decison.Latency += time.Duration(e.rnd.Int63n(int64(diff)))
+		}
+	}
 
-		// Note: Pls make sure that LatencyMax >= LatencyMin, otherwise this will panic
-		// No, I will not handle this edge case of user error. Sorry!
-		random := time.Duration(e.rnd.Int63n((int64(diff))))
-		decison.Latency = e.config.LatencyMin + random
+	// An error before the upstream is called wins, the upstream never sees the request
+	if !decison.ReturnError && e.shouldApply(cfg.PostFailureRate) {
+		decison.PostFailure = cfg.PostFailureMode
+		if decison.PostFailure == "" {
+			decison.PostFailure = PostFailureError
+		}
+		if decison.PostFailure == PostFailureError {
+			decison.ErrorCode = cfg.ErrorCode
+			if decison.ErrorCode == 0 {
+				decison.ErrorCode = 500
+			}
+		}
 	}
 
-	if e.shouldApply(e.config.CorruptRate) {
+	if e.shouldApply(cfg.CorruptRate) {
 		decison.Corrupt = true
 	}
 
+	if cfg.StaleRate > 0 {
+		decison.StaleVersions = cfg.StaleVersions
+		decison.StaleAge = cfg.StaleAge
+		decison.StaleKeepHeaders = cfg.StaleKeepHeaders
+		if decison.StaleVersions == 0 && decison.StaleAge == 0 {
+			decison.StaleVersions = 1
+		}
+		decison.Stale = e.shouldApply(cfg.StaleRate)
+	}
+
+	if e.shouldApply(cfg.ReorderRate) {
+		decison.Reorder = true
+		decison.ReorderWindow = cfg.ReorderWindow
+		if decison.ReorderWindow == 0 {
+			decison.ReorderWindow = time.Second
+		}
+		decison.ReorderCount = cfg.ReorderCount
+		decison.ReorderOrder = cfg.ReorderOrder
+		if decison.ReorderOrder == "" {
+			decison.ReorderOrder = ReorderShuffle
+		}
+	}
+
+	if e.shouldApply(cfg.DuplicateRate) {
+		decison.Duplicates = max(cfg.DuplicateCount, 2) - 1
+		decison.DuplicateDelay = cfg.DuplicateDelay
+	}
+
 	return decison
 }
 
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"testing"
 	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/match"
 )
 
 // TestDecide_Drop tests that drop behavior is exclusive and terminal
@@ -138,6 +140,20 @@ func TestDecide_RandomLatency(t *testing.T) {
 	}
 }
 
+func TestDecide_EqualLatencyBounds(t *testing.T) {
+	engine := NewEngine(ChaosConfig{
+		LatencyMin: 200 * time.Millisecond,
+		LatencyMax: 200 * time.Millisecond,
+	})
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	decision := engine.Decide(req)
+
+	if decision.Latency != 200*time.Millisecond {
+		t.Errorf("Expected a fixed latency of 200ms, got %v", decision.Latency)
+	}
+}
+
 // TestDecide_CorruptOnly tests corruption behavior
 func TestDecide_CorruptOnly(t *testing.T) {
 	engine := NewEngine(ChaosConfig{
@@ -365,3 +381,207 @@ func TestDecide_FixedLatencyTakesPrecedence(t *testing.T) {
 		t.Errorf("Expected fixed latency %v to take precedence, got %v", fixedLatency, decision.Latency)
 	}
 }
+
+// TestDecide_RuleOverridesDefault tests that the first matching rule replaces the default config
+func TestDecide_RuleOverridesDefault(t *testing.T) {
+	engine := NewEngine(ChaosConfig{
+		ErrorRate: 100,
+		ErrorCode: 500,
+		Rules: []Rule{
+			{Name: "stripe", Matcher: match.Matcher{Host: "*.stripe.com"}, Config: ChaosConfig{ErrorRate: 100, ErrorCode: 503}},
+			{Name: "quiet", Matcher: match.Matcher{Host: "status.example.com"}},
+		},
+	})
+
+	req, _ := http.NewRequest("GET", "https://api.stripe.com/v1/charges", nil)
+	decision := engine.Decide(req)
+	if decision.Rule != "stripe" {
+		t.Errorf("Expected rule 'stripe', got '%s'", decision.Rule)
+	}
+	if decision.ErrorCode != 503 {
+		t.Errorf("Expected ErrorCode 503 from rule, got %d", decision.ErrorCode)
+	}
+
+	req, _ = http.NewRequest("GET", "http://status.example.com/", nil)
+	decision = engine.Decide(req)
+	if decision.Rule != "quiet" || decision.ReturnError {
+		t.Errorf("Expected quiet rule without error, got %+v", decision)
+	}
+
+	req, _ = http.NewRequest("GET", "http://other.example.com/", nil)
+	decision = engine.Decide(req)
+	if decision.Rule != "" {
+		t.Errorf("Expected default config, got rule '%s'", decision.Rule)
+	}
+	if decision.ErrorCode != 500 {
+		t.Errorf("Expected default ErrorCode 500, got %d", decision.ErrorCode)
+	}
+}
+
+func TestDecide_Stale(t *testing.T) {
+	engine := NewEngine(ChaosConfig{StaleRate: 100})
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	decision := engine.Decide(req)
+	if !decision.Stale {
+		t.Error("Expected Stale to be true")
+	}
+	if decision.StaleVersions != 1 {
+		t.Errorf("Expected StaleVersions to default to 1, got %d", decision.StaleVersions)
+	}
+
+	// Stale responses stay configured even when the rate doesn't fire
+	engine = NewEngine(ChaosConfig{StaleRate: 0.0001, StaleAge: time.Minute})
+	decision = engine.Decide(req)
+	if decision.StaleAge != time.Minute || decision.StaleVersions != 0 {
+		t.Errorf("Expected stale parameters to be set, got %+v", decision)
+	}
+}
+
+func TestDecide_Duplicate(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://example.com", nil)
+
+	decision := NewEngine(ChaosConfig{DuplicateRate: 100}).Decide(req)
+	if decision.Duplicates != 1 {
+		t.Errorf("Expected 1 extra copy by default, got %d", decision.Duplicates)
+	}
+
+	decision = NewEngine(ChaosConfig{DuplicateRate: 100, DuplicateCount: 3, DuplicateDelay: time.Second}).Decide(req)
+	if decision.Duplicates != 2 || decision.DuplicateDelay != time.Second {
+		t.Errorf("Expected 2 extra copies 1s apart, got %d, %v", decision.Duplicates, decision.DuplicateDelay)
+	}
+
+	decision = NewEngine(ChaosConfig{DuplicateRate: 0}).Decide(req)
+	if decision.Duplicates != 0 {
+		t.Errorf("Expected no copies, got %d", decision.Duplicates)
+	}
+}
+
+func TestDecide_PostFailure(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://example.com", nil)
+
+	decision := NewEngine(ChaosConfig{PostFailureRate: 100}).Decide(req)
+	if decision.PostFailure != PostFailureError || decision.ErrorCode != 500 {
+		t.Errorf("Expected post-upstream error 500 by default, got '%s' %d", decision.PostFailure, decision.ErrorCode)
+	}
+	if decision.ReturnError {
+		t.Error("Expected ReturnError to be false")
+	}
+
+	decision = NewEngine(ChaosConfig{PostFailureRate: 100, PostFailureMode: PostFailureReset}).Decide(req)
+	if decision.PostFailure != PostFailureReset {
+		t.Errorf("Expected reset, got '%s'", decision.PostFailure)
+	}
+
+	// The upstream never sees requests that fail up front
+	decision = NewEngine(ChaosConfig{ErrorRate: 100, PostFailureRate: 100}).Decide(req)
+	if !decision.ReturnError || decision.PostFailure != "" {
+		t.Errorf("Expected the early error to win, got %+v", decision)
+	}
+}
+
+func TestDecide_Reorder(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://example.com", nil)
+
+	decision := NewEngine(ChaosConfig{ReorderRate: 100}).Decide(req)
+	if !decision.Reorder {
+		t.Fatal("Expected Reorder to be true")
+	}
+	if decision.ReorderWindow != time.Second || decision.ReorderOrder != ReorderShuffle {
+		t.Errorf("Expected a 1s window and shuffled order by default, got %v %s", decision.ReorderWindow, decision.ReorderOrder)
+	}
+
+	decision = NewEngine(ChaosConfig{ReorderRate: 100, ReorderCount: 5, ReorderOrder: ReorderReverse}).Decide(req)
+	if decision.ReorderCount != 5 || decision.ReorderOrder != ReorderReverse {
+		t.Errorf("Expected count 5 in reverse, got %d %s", decision.ReorderCount, decision.ReorderOrder)
+	}
+}
+
+func TestEngine_SetFault(t *testing.T) {
+	engine := NewEngine(ChaosConfig{
+		ErrorRate: 100,
+		Latency:   time.Second,
+		Rules:     []Rule{{Name: "drop", Matcher: match.Matcher{PathPrefix: "/drop"}, Config: ChaosConfig{DropRate: 100}}},
+	})
+	engine.SetFault(FaultError, false)
+	engine.SetFault(FaultDrop, false)
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	decision := engine.Decide(req)
+	if decision.ReturnError {
+		t.Error("Expected disabled errors not to fire")
+	}
+	if decision.Latency != time.Second {
+		t.Errorf("Expected latency to stay enabled, got %v", decision.Latency)
+	}
+
+	// Rules are covered too
+	req, _ = http.NewRequest("GET", "http://example.com/drop", nil)
+	if engine.Decide(req).Drop {
+		t.Error("Expected disabled drops not to fire inside rules")
+	}
+
+	if disabled := engine.Disabled(); len(disabled) != 2 || disabled[0] != FaultDrop || disabled[1] != FaultError {
+		t.Errorf("Expected drop and error to be disabled, got %v", disabled)
+	}
+
+	engine.SetFault(FaultError, true)
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	if !engine.Decide(req).ReturnError {
+		t.Error("Expected errors once enabled again")
+	}
+}
+
+func TestEngine_SetConfig(t *testing.T) {
+	engine := NewEngine(ChaosConfig{})
+	engine.SetConfig(ChaosConfig{ErrorRate: 100, ErrorCode: 503})
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	if decision := engine.Decide(req); decision.ErrorCode != 503 {
+		t.Errorf("Expected the new config to apply, got %+v", decision)
+	}
+
+	engine.SetRules([]Rule{{Name: "all", Config: ChaosConfig{}}})
+	if decision := engine.Decide(req); decision.ReturnError || decision.Rule != "all" {
+		t.Errorf("Expected the new rule to apply, got %+v", decision)
+	}
+	if engine.Config().ErrorCode != 503 {
+		t.Error("Expected SetRules to keep the rest of the config")
+	}
+}
+
+func TestDecide_Expired(t *testing.T) {
+	start := time.Now()
+	engine := NewEngine(ChaosConfig{ErrorRate: 100, ActiveUntil: start.Add(time.Minute)})
+	engine.now = func() time.Time { return start }
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	if !engine.Decide(req).ReturnError {
+		t.Fatal("Expected chaos before the expiry")
+	}
+
+	engine.now = func() time.Time { return start.Add(2 * time.Minute) }
+	if decision := engine.Decide(req); decision != (Decision{}) {
+		t.Errorf("Expected no chaos after the expiry, got %+v", decision)
+	}
+}
+
+func TestDecide_ExpiredRule(t *testing.T) {
+	start := time.Now()
+	engine := NewEngine(ChaosConfig{
+		ErrorRate: 100,
+		ErrorCode: 503,
+		Rules: []Rule{{
+			Name:    "temporary",
+			Matcher: match.Matcher{PathPrefix: "/"},
+			Config:  ChaosConfig{ErrorRate: 100, ErrorCode: 418, ActiveUntil: start.Add(time.Minute)},
+		}},
+	})
+	engine.now = func() time.Time { return start.Add(2 * time.Minute) }
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	decision := engine.Decide(req)
+	if decision.Rule != "" || decision.ErrorCode != 503 {
+		t.Errorf("Expected the expired rule to be skipped, got rule %q with code %d", decision.Rule, decision.ErrorCode)
+	}
+}
@@ -0,0 +1,146 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Control headers, they replace the engine's decision for one request
+const (
+	HeaderSecret  = "X-Chaos-Secret"
+	HeaderForce   = "X-Chaos-Force"   // e.g. "error=503" or "corrupt, duplicate=3"
+	HeaderLatency = "X-Chaos-Latency" // e.g. "2s"
+	HeaderSkip    = "X-Chaos-Skip"    // "true" for no chaos at all
+)
+
+type overrideKey struct{}
+
+// Override is the decision the control headers asked for. It's applied once,
+// by the first chaos middleware the request passes. Inner layers, like pool
+// backends, add nothing on top.
+type Override struct {
+	decision Decision
+	taken    atomic.Bool
+}
+
+// ParseOverride reads the control headers from h, nil when there are none
+func ParseOverride(h http.Header) (*Override, error) {
+	force, latency, skip := h.Get(HeaderForce), h.Get(HeaderLatency), h.Get(HeaderSkip)
+	if force == "" && latency == "" && skip == "" {
+		return nil, nil
+	}
+
+	o := &Override{}
+	if skip != "" {
+		skipped, err := strconv.ParseBool(skip)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q", HeaderSkip, skip)
+		}
+		if skipped {
+			return o, nil
+		}
+	}
+
+	if latency != "" {
+		d, err := time.ParseDuration(latency)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid %s: %q", HeaderLatency, latency)
+		}
+		o.decision.Latency = d
+	}
+
+	for _, fault := range strings.Split(force, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(fault), "=")
+		if name == "" {
+			continue
+		}
+		if err := o.force(name, value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", HeaderForce, err)
+		}
+	}
+	return o, nil
+}
+
+func (o *Override) force(name, value string) error {
+	d := &o.decision
+	number := func(lo, hi int) (int, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < lo || n > hi {
+			return 0, fmt.Errorf("%s needs a number between %d and %d, got %q", name, lo, hi, value)
+		}
+		return n, nil
+	}
+
+	switch name {
+	case FaultDrop:
+		d.Drop = true
+	case FaultError:
+		d.ReturnError, d.ErrorCode = true, 500
+		if value != "" {
+			code, err := number(100, 599)
+			if err != nil {
+				return err
+			}
+			d.ErrorCode = code
+		}
+	case FaultCorrupt:
+		d.Corrupt = true
+	case FaultStale:
+		d.Stale, d.StaleVersions = true, 1
+		if value != "" {
+			n, err := number(1, 15)
+			if err != nil {
+				return err
+			}
+			d.StaleVersions = n
+		}
+	case FaultDuplicate:
+		d.Duplicates = 1
+		if value != "" {
+			n, err := number(2, 10)
+			if err != nil {
+				return err
+			}
+			d.Duplicates = n - 1
+		}
+	case FaultPostFailure:
+		d.PostFailure, d.ErrorCode = PostFailureError, 500
+		switch value {
+		case "", PostFailureError:
+		case PostFailureTimeout, PostFailureReset:
+			d.PostFailure = value
+		default:
+			return fmt.Errorf("post_failure must be error, timeout or reset, got %q", value)
+		}
+	case FaultReorder:
+		d.Reorder, d.ReorderWindow, d.ReorderOrder = true, time.Second, ReorderShuffle
+	default:
+		return fmt.Errorf("unknown fault %q", name)
+	}
+	return nil
+}
+
+// Take returns the forced decision the first time it's called and an empty
+// one after that
+func (o *Override) Take() Decision {
+	if o.taken.Swap(true) {
+		return Decision{}
+	}
+	return o.decision
+}
+
+// WithOverride attaches o to ctx
+func WithOverride(ctx context.Context, o *Override) context.Context {
+	return context.WithValue(ctx, overrideKey{}, o)
+}
+
+// OverrideFrom returns the override attached to ctx, nil if there is none
+func OverrideFrom(ctx context.Context) *Override {
+	o, _ := ctx.Value(overrideKey{}).(*Override)
+	return o
+}
@@ -0,0 +1,69 @@
+package chaos
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseOverride(t *testing.T) {
+	h := http.Header{}
+	if o, err := ParseOverride(h); o != nil || err != nil {
+		t.Fatalf("Expected no override without headers, got %v, %v", o, err)
+	}
+
+	h.Set(HeaderForce, "error=503, duplicate=3")
+	h.Set(HeaderLatency, "2s")
+	o, err := ParseOverride(h)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	d := o.Take()
+	if !d.ReturnError || d.ErrorCode != 503 {
+		t.Errorf("Expected a forced 503, got %+v", d)
+	}
+	if d.Duplicates != 2 || d.Latency != 2*time.Second {
+		t.Errorf("Expected 2 extra copies after 2s, got %d after %v", d.Duplicates, d.Latency)
+	}
+	if d.Corrupt || d.Drop {
+		t.Errorf("Expected nothing that wasn't asked for, got %+v", d)
+	}
+
+	// Inner layers add nothing
+	if d := o.Take(); d != (Decision{}) {
+		t.Errorf("Expected an empty decision the second time, got %+v", d)
+	}
+}
+
+func TestParseOverride_Skip(t *testing.T) {
+	h := http.Header{}
+	h.Set(HeaderSkip, "true")
+	h.Set(HeaderForce, "drop")
+
+	o, err := ParseOverride(h)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if d := o.Take(); d != (Decision{}) {
+		t.Errorf("Expected skip to win, got %+v", d)
+	}
+}
+
+func TestParseOverride_Invalid(t *testing.T) {
+	tests := map[string][2]string{
+		"unknown fault":     {HeaderForce, "meteor"},
+		"invalid code":      {HeaderForce, "error=abc"},
+		"code out of range": {HeaderForce, "error=999"},
+		"invalid mode":      {HeaderForce, "post_failure=explode"},
+		"invalid latency":   {HeaderLatency, "soon"},
+		"invalid skip":      {HeaderSkip, "maybe"},
+	}
+	for name, header := range tests {
+		h := http.Header{}
+		h.Set(header[0], header[1])
+		if _, err := ParseOverride(h); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package chaos
+
+import (
+	"context"
+	"sync"
+)
+
+type reportKey struct{}
+
+// Report collects every decision applied to one request, so exporters can
+// show what was injected. A request passes one chaos middleware per layer,
+// e.g. route and pool backend, so there can be more than one.
+type Report struct {
+	mu             sync.Mutex
+	decisions      []Decision
+	route          string
+	upstreamStatus int
+}
+
+// WithReport attaches an empty report to ctx
+func WithReport(ctx context.Context) (context.Context, *Report) {
+	report := &Report{}
+	return context.WithValue(ctx, reportKey{}, report), report
+}
+
+// WithoutReport detaches ctx's report, for requests that aren't the
+// client's own like duplicates
+func WithoutReport(ctx context.Context) context.Context {
+	return context.WithValue(ctx, reportKey{}, (*Report)(nil))
+}
+
+// ReportFrom returns the report attached to ctx, nil if there is none
+func ReportFrom(ctx context.Context) *Report {
+	report, _ := ctx.Value(reportKey{}).(*Report)
+	return report
+}
+
+func (r *Report) Add(d Decision) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decisions = append(r.decisions, d)
+}
+
+// Decisions returns the decisions in the order they were applied
+func (r *Report) Decisions() []Decision {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Decision(nil), r.decisions...)
+}
+
+// SetRoute records the name of the route the request took
+func (r *Report) SetRoute(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.route = name
+}
+
+// Route returns the route the request took, empty for the proxy's own upstream
+func (r *Report) Route() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.route
+}
+
+// SetUpstreamStatus records the status the upstream answered with
+func (r *Report) SetUpstreamStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.upstreamStatus = status
+}
+
+// UpstreamStatus returns the status the upstream answered with, 0 when it
+// never answered
+func (r *Report) UpstreamStatus() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.upstreamStatus
+}
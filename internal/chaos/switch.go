@@ -0,0 +1,22 @@
+package chaos
+
+import "sync/atomic"
+
+// Switch turns one of ProxyFaults off at runtime. Those faults aren't picked
+// by an engine, every place injecting them reads the proxy's switch. A nil
+// Switch is always on.
+type Switch struct {
+	off atomic.Bool
+}
+
+func NewSwitch() *Switch {
+	return &Switch{}
+}
+
+func (s *Switch) On() bool {
+	return s == nil || !s.off.Load()
+}
+
+func (s *Switch) Set(on bool) {
+	s.off.Store(!on)
+}
@@ -1,6 +1,10 @@
 package chaos
 
-import "time"
+import (
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/match"
+)
 
 // Final decision for the request
 type Decision struct {
@@ -9,8 +13,72 @@ type Decision struct {
 	ErrorCode   int
 	Latency     time.Duration
 	Corrupt     bool
+	Rule        string // Name of the matched rule, empty for the default config
+
+	CorruptStrategy string // Filled in by the middleware once the body was corrupted
+
+	// Stale responses. The parameters are set whenever stale responses are
+	// configured, so the middleware knows to keep track of responses.
+	Stale            bool
+	StaleVersions    int
+	StaleAge         time.Duration
+	StaleKeepHeaders bool
+
+	Duplicates     int           // Extra copies of the request sent upstream
+	DuplicateDelay time.Duration // Between copies, all at once when 0
+
+	PostFailure string // One of the PostFailure modes, empty when the upstream's response goes through
+
+	// Held back and released with other requests in a different order
+	Reorder       bool
+	ReorderWindow time.Duration
+	ReorderCount  int
+	ReorderOrder  string
+}
+
+// Faults returns the names of the faults d applies, in the order of Faults
+func (d Decision) Faults() []string {
+	var faults []string
+	if d.Drop {
+		faults = append(faults, FaultDrop)
+	}
+	if d.ReturnError {
+		faults = append(faults, FaultError)
+	}
+	if d.Latency > 0 {
+		faults = append(faults, FaultLatency)
+	}
+	if d.Corrupt {
+		faults = append(faults, FaultCorrupt)
+	}
+	if d.Stale {
+		faults = append(faults, FaultStale)
+	}
+	if d.Duplicates > 0 {
+		faults = append(faults, FaultDuplicate)
+	}
+	if d.PostFailure != "" {
+		faults = append(faults, FaultPostFailure)
+	}
+	if d.Reorder {
+		faults = append(faults, FaultReorder)
+	}
+	return faults
 }
 
+// What the client sees after the upstream already handled the request
+const (
+	PostFailureError   = "error"   // An error status instead of the real response
+	PostFailureTimeout = "timeout" // Nothing, until the client gives up
+	PostFailureReset   = "reset"   // A reset connection
+)
+
+// Order held requests are released in
+const (
+	ReorderShuffle = "shuffle"
+	ReorderReverse = "reverse"
+)
+
 // Values for each error which will give the decision
 type ChaosConfig struct {
 	ErrorRate   float64       //0-100 percentage
@@ -20,4 +88,32 @@ type ChaosConfig struct {
 	LatencyMin  time.Duration // Min random latency
 	LatencyMax  time.Duration // Max random latency
 	CorruptRate float64       //0-100 percentage
+	Rules       []Rule        // Checked in order, the first match replaces this config
+
+	StaleRate        float64       //0-100 percentage
+	StaleVersions    int           // Serve the response from this many versions ago...
+	StaleAge         time.Duration // ...or the newest one at least this old
+	StaleKeepHeaders bool          // Keep the current response's headers
+
+	DuplicateRate  float64       //0-100 percentage
+	DuplicateCount int           // Total deliveries of a duplicated request, at least 2
+	DuplicateDelay time.Duration // Between deliveries, all at once when 0
+
+	PostFailureRate float64 //0-100 percentage
+	PostFailureMode string  // PostFailureError by default, the error uses ErrorCode
+
+	ReorderRate   float64       //0-100 percentage
+	ReorderWindow time.Duration // Held requests are released this long after the first one, 1s by default
+	ReorderCount  int           // ...or as soon as this many are held
+	ReorderOrder  string        // ReorderShuffle by default
+
+	ActiveUntil time.Time // No chaos after this, never expires when zero
+	Deadline    *Deadline // The proxy's expiry, applies when ActiveUntil is zero
+}
+
+// Rule overrides the chaos config for requests it matches
+type Rule struct {
+	Name string
+	match.Matcher
+	Config ChaosConfig
 }
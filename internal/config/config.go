@@ -2,18 +2,55 @@ package config
 
 import (
 	"fmt"
-	"log/slog"
 	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	ModeReverse = "reverse"
+	ModeForward = "forward"
+)
+
 type Config struct {
-	Listen   string     `yaml:"listen"`
-	Upstream string     `yaml:"upstream"`
-	Chaos    FileConfig `yaml:"chaos"`
+	Mode        string `yaml:"mode"`   // "reverse" (default) or "forward"
+	Listen      string `yaml:"listen"` // host:port or unix:///path/to.sock
+	SocketMode  string `yaml:"socket_mode"`
+	Upstream    string `yaml:"upstream"`
+	PoolConfig  `yaml:",inline"`
+	Chaos       FileConfig         `yaml:"chaos"`
+	Rules       []RuleConfig       `yaml:"rules"`
+	Routes      []RouteConfig      `yaml:"routes"`
+	ListenTLS   *ListenTLSConfig   `yaml:"listen_tls"`
+	UpstreamTLS *UpstreamTLSConfig `yaml:"upstream_tls"`
+	Forward     ForwardConfig      `yaml:"forward"`
+	Transport   TransportConfig    `yaml:"transport_chaos"`
+	Recording   *RecordingConfig   `yaml:"recording"`
+	HAR         *HARConfig         `yaml:"har"`
+	RateLimit   *RateLimitConfig   `yaml:"rate_limit"`
+	Control     *ControlConfig     `yaml:"control_headers"`
+
+	// Run several listeners from one process instead of the fields above
+	Proxies []ProxyConfig `yaml:"proxies"`
+
+	// HTTP API for changing chaos at runtime, shared by all proxies
+	Admin *AdminConfig `yaml:"admin"`
+
+	// Turns off all chaos in the process, shared by all proxies
+	KillSwitch *KillSwitchConfig `yaml:"kill_switch"`
+
+	// Time-boxed chaos started through the admin API
+	Experiments []ExperimentConfig `yaml:"experiments"`
+
+	// Probes that turn chaos off when the system stops being healthy
+	SteadyState *SteadyStateConfig `yaml:"steady_state"`
+
+	// Spans for every request, exported to an OpenTelemetry collector
+	Tracing *TracingConfig `yaml:"tracing"`
 
 	UpstreamURL *url.URL `yaml:"-"`
 }
@@ -26,12 +63,463 @@ type FileConfig struct {
 	LatencyMin  string  `yaml:"latency_min"`
 	LatencyMax  string  `yaml:"latency_max"`
 	CorruptRate float64 `yaml:"corrupt_rate"`
+
+	StaleRate        float64 `yaml:"stale_rate"`
+	StaleVersions    int     `yaml:"stale_versions"`     // Serve the response from N versions ago (default 1)...
+	StaleAge         string  `yaml:"stale_age"`          // ...or the newest one at least this old
+	StaleKeepHeaders bool    `yaml:"stale_keep_headers"` // Keep the current response's headers
+
+	DuplicateRate  float64 `yaml:"duplicate_rate"`
+	DuplicateCount int     `yaml:"duplicate_count"` // Total deliveries, 2 by default
+	DuplicateDelay string  `yaml:"duplicate_delay"` // Between deliveries, all at once when empty
+
+	PostFailureRate float64 `yaml:"post_failure_rate"`
+	PostFailureMode string  `yaml:"post_failure_mode"` // error (default), timeout or reset
+
+	ReorderRate   float64 `yaml:"reorder_rate"`
+	ReorderWindow string  `yaml:"reorder_window"` // Release held requests this long after the first, 1s by default
+	ReorderCount  int     `yaml:"reorder_count"`  // Or once this many are held
+	ReorderOrder  string  `yaml:"reorder_order"`  // shuffle (default) or reverse
+
+	ExpiresAfter string `yaml:"expires_after"` // No chaos this long after the config is loaded, e.g. 30m
+	ActiveUntil  string `yaml:"active_until"`  // ...or after this RFC 3339 time
+}
+
+// Request selector shared by rules and routes. Empty fields match everything.
+type MatchConfig struct {
+	Host        string `yaml:"host"` // Exact host or "*.example.com"
+	PathPrefix  string `yaml:"path_prefix"`
+	Method      string `yaml:"method"`
+	Header      string `yaml:"header"`
+	HeaderValue string `yaml:"header_value"` // Any value when empty
+}
+
+// Chaos settings for matching requests. The first matching rule replaces the
+// top-level chaos config.
+type RuleConfig struct {
+	Name        string `yaml:"name"`
+	MatchConfig `yaml:",inline"`
+	Chaos       FileConfig `yaml:"chaos"`
+}
+
+// Backend in an upstream pool, with chaos that only applies when it's picked
+type BackendConfig struct {
+	Name  string     `yaml:"name"`
+	URL   string     `yaml:"url"`
+	Chaos FileConfig `yaml:"chaos"`
+
+	BackendURL *url.URL `yaml:"-"`
+}
+
+// Load-balanced upstream pool, used instead of a single upstream
+type PoolConfig struct {
+	Upstreams  []BackendConfig `yaml:"upstreams"`
+	Balance    string          `yaml:"balance"`     // round_robin (default), random, least_conn or consistent_hash
+	HashHeader string          `yaml:"hash_header"` // consistent_hash key, client IP when empty
+}
+
+func (pc *PoolConfig) validate() error {
+	switch pc.Balance {
+	case "":
+		pc.Balance = "round_robin"
+	case "round_robin", "random", "least_conn", "consistent_hash":
+	default:
+		return fmt.Errorf("unsupported balance strategy %q", pc.Balance)
+	}
+
+	for i := range pc.Upstreams {
+		b := &pc.Upstreams[i]
+		if b.Name == "" {
+			b.Name = fmt.Sprintf("backend-%d", i+1)
+		}
+		if b.URL == "" {
+			return fmt.Errorf("upstream %q: url is required", b.Name)
+		}
+		backendURL, err := url.Parse(b.URL)
+		if err != nil {
+			return fmt.Errorf("upstream %q: invalid URL: %w", b.Name, err)
+		}
+		b.BackendURL = backendURL
+	}
+
+	return nil
+}
+
+// describe summarises where requests go, for PrintConfiguration
+func (pc PoolConfig) describe(upstream string) string {
+	if len(pc.Upstreams) == 0 {
+		return upstream
+	}
+	urls := make([]string, len(pc.Upstreams))
+	for i, b := range pc.Upstreams {
+		urls[i] = b.URL
+	}
+	return fmt.Sprintf("%s [%s]", pc.Balance, strings.Join(urls, ", "))
+}
+
+// Virtual route to its own upstream. The first matching route wins, requests
+// matching none go to the proxy's own upstream if it has one.
+type RouteConfig struct {
+	Name        string `yaml:"name"`
+	MatchConfig `yaml:",inline"`
+	StripPrefix bool   `yaml:"strip_prefix"` // Remove path_prefix before forwarding
+	Upstream    string `yaml:"upstream"`
+	PoolConfig  `yaml:",inline"`
+	Respond     *StubConfig `yaml:"respond"` // Answer from the proxy instead of an upstream
+	Chaos       FileConfig  `yaml:"chaos"`
+
+	UpstreamURL *url.URL `yaml:"-"`
+}
+
+// Canned response for routes without a live upstream
+type StubConfig struct {
+	Status   int               `yaml:"status"` // 200 when empty
+	Headers  map[string]string `yaml:"headers"`
+	Body     string            `yaml:"body"`
+	BodyFile string            `yaml:"body_file"` // Read instead of body
+	Template bool              `yaml:"template"`  // Render the body as a Go template with request data
+}
+
+func (sc *StubConfig) validate() error {
+	if sc.Status == 0 {
+		sc.Status = 200
+	}
+	if sc.Status < 100 || sc.Status > 599 {
+		return fmt.Errorf("respond: invalid status %d", sc.Status)
+	}
+	if sc.Body != "" && sc.BodyFile != "" {
+		return fmt.Errorf("respond: use either body or body_file, not both")
+	}
+	return nil
+}
+
+// Forward-proxy settings, only used when mode is "forward"
+type ForwardConfig struct {
+	MITM    bool   `yaml:"mitm"`     // Intercept CONNECT tunnels with a local CA
+	CertDir string `yaml:"cert_dir"` // Where the MITM CA is stored
+}
+
+// TLS termination on the listener. Either a cert/key pair or an
+// auto-generated CA (written to CertDir) must be configured.
+type ListenTLSConfig struct {
+	CertFile string   `yaml:"cert_file"`
+	KeyFile  string   `yaml:"key_file"`
+	AutoCert bool     `yaml:"auto_cert"`
+	CertDir  string   `yaml:"cert_dir"`
+	Hosts    []string `yaml:"hosts"` // Names used when the client sends no SNI
+
+	Faults TLSFaultsConfig `yaml:"faults"`
+}
+
+// Handshake faults injected on the TLS listener, rates are 0-100 percentages
+type TLSFaultsConfig struct {
+	DelayRate        float64 `yaml:"delay_rate"`
+	Delay            string  `yaml:"delay"`
+	AbortRate        float64 `yaml:"abort_rate"`
+	AlertRate        float64 `yaml:"alert_rate"`
+	ExpiredRate      float64 `yaml:"expired_cert_rate"`
+	SelfSignedRate   float64 `yaml:"self_signed_rate"`
+	WrongHostRate    float64 `yaml:"wrong_host_rate"`
+	DowngradeRate    float64 `yaml:"downgrade_rate"`
+	DowngradeVersion string  `yaml:"downgrade_version"` // "1.0", "1.1" or "1.2"
+
+	DelayDuration time.Duration `yaml:"-"`
+	MaxVersion    uint16        `yaml:"-"`
+}
+
+// Connection-level faults on the proxy's own upstream connections, rates are
+// 0-100 percentages. Failures surface as a 502 from the proxy, like a real
+// outage would.
+type TransportConfig struct {
+	DNSErrorRate   float64 `yaml:"dns_error_rate"`
+	DialErrorRate  float64 `yaml:"dial_error_rate"`
+	TLSErrorRate   float64 `yaml:"tls_error_rate"`   // Only affects https upstreams
+	ResetReuseRate float64 `yaml:"reset_reuse_rate"` // Reset pooled keep-alive connections on reuse
+	SlowDialRate   float64 `yaml:"slow_dial_rate"`
+	SlowDial       string  `yaml:"slow_dial"`
+
+	SlowDialDuration time.Duration `yaml:"-"`
+}
+
+// Record upstream traffic to disk, or replay it instead of calling the upstream
+type RecordingConfig struct {
+	Mode      string `yaml:"mode"`       // "record" or "replay"
+	Dir       string `yaml:"dir"`        // "recordings" by default
+	MatchBody bool   `yaml:"match_body"` // Also match on the request body
+}
+
+// HAR capture of proxied traffic, annotated with the chaos applied
+type HARConfig struct {
+	File       string `yaml:"file"`        // Written shortly after requests complete and on shutdown
+	Endpoint   string `yaml:"endpoint"`    // Path on the listener serving the capture, e.g. /_chaos/har
+	Bodies     bool   `yaml:"bodies"`      // Capture request and response bodies
+	MaxEntries int    `yaml:"max_entries"` // Oldest entries are dropped beyond this, 1000 by default
+}
+
+// Admin API listener
+type AdminConfig struct {
+	Listen string `yaml:"listen"` // e.g. 127.0.0.1:9000, keep it off public interfaces
+	Token  string `yaml:"token"`  // Required as a bearer token when set
+}
+
+func (ac *AdminConfig) validate() error {
+	if ac.Listen == "" {
+		return fmt.Errorf("admin: listen is required")
+	}
+	return nil
+}
+
+// Sentinel file for the kill switch, chaos is off while it exists
+type KillSwitchConfig struct {
+	File string `yaml:"file"`
+}
+
+func (kc *KillSwitchConfig) validate() error {
+	if kc.File == "" {
+		return fmt.Errorf("kill_switch: file is required")
+	}
+	return nil
+}
+
+// OTLP/HTTP export of a span per request through the proxies
+type TracingConfig struct {
+	Endpoint    string            `yaml:"endpoint"`     // Collector's traces URL, e.g. http://localhost:4318/v1/traces
+	ServiceName string            `yaml:"service_name"` // "chaos-proxy" by default
+	Headers     map[string]string `yaml:"headers"`      // Sent with every export, e.g. an API key
+}
+
+func (tc *TracingConfig) validate() error {
+	if tc.Endpoint == "" {
+		return fmt.Errorf("tracing: endpoint is required")
+	}
+	u, err := url.Parse(tc.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("tracing: endpoint must be an http or https URL")
+	}
+	if tc.ServiceName == "" {
+		tc.ServiceName = "chaos-proxy"
+	}
+	return nil
+}
+
+// Named set of faults applied to one proxy for a fixed time. The proxy's
+// own chaos settings are restored when it ends.
+type ExperimentConfig struct {
+	Name       string     `yaml:"name"`
+	Proxy      string     `yaml:"proxy"`       // May be omitted with a single proxy
+	Duration   string     `yaml:"duration"`    // e.g. 15m
+	Chaos      FileConfig `yaml:"chaos"`       // Replaces the proxy's chaos settings while running
+	SummaryDir string     `yaml:"summary_dir"` // Where the summary is written, "experiments" by default
+
+	Length time.Duration `yaml:"-"`
+}
+
+func (ec *ExperimentConfig) validate(proxies []ProxyConfig) error {
+	if ec.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if ec.Duration == "" {
+		return fmt.Errorf("experiment %q: duration is required", ec.Name)
+	}
+	d, err := time.ParseDuration(ec.Duration)
+	if err != nil {
+		return fmt.Errorf("experiment %q: invalid duration: %w", ec.Name, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("experiment %q: duration must be positive", ec.Name)
+	}
+	ec.Length = d
+
+	if ec.Proxy == "" {
+		if len(proxies) != 1 {
+			return fmt.Errorf("experiment %q: proxy is required with more than one proxy", ec.Name)
+		}
+		ec.Proxy = proxies[0].Name
+	}
+	if !slices.ContainsFunc(proxies, func(p ProxyConfig) bool { return p.Name == ec.Proxy }) {
+		return fmt.Errorf("experiment %q: no proxy named %q", ec.Name, ec.Proxy)
+	}
+
+	if ec.SummaryDir == "" {
+		ec.SummaryDir = "experiments"
+	}
+	return nil
+}
+
+// Steady-state hypothesis, checked every interval. When a probe keeps
+// failing, the kill switch is engaged and running experiments are aborted.
+type SteadyStateConfig struct {
+	Interval string        `yaml:"interval"` // "5s" by default
+	Probes   []ProbeConfig `yaml:"probes"`
+
+	IntervalDuration time.Duration `yaml:"-"`
+}
+
+// One check of the steady state, either a health URL or the traffic of a proxy
+type ProbeConfig struct {
+	Name string `yaml:"name"`
+
+	URL          string `yaml:"url"`           // GET, healthy when it answers expect_status
+	ExpectStatus int    `yaml:"expect_status"` // Any 2xx when empty
+	Timeout      string `yaml:"timeout"`       // "5s" by default
+
+	Proxy          string  `yaml:"proxy"`            // Responses of this proxy over window...
+	MinSuccessRate float64 `yaml:"min_success_rate"` // ...at least this percentage not 5xx or dropped
+	MaxP99         string  `yaml:"max_p99"`          // ...and/or a p99 response time of at most this
+	Window         string  `yaml:"window"`           // "30s" by default
+
+	For string `yaml:"for"` // How long the probe has to keep failing, the first failure counts when empty
+
+	TimeoutDuration time.Duration `yaml:"-"`
+	MaxP99Duration  time.Duration `yaml:"-"`
+	WindowDuration  time.Duration `yaml:"-"`
+	ForDuration     time.Duration `yaml:"-"`
+}
+
+func (sc *SteadyStateConfig) validate(proxies []ProxyConfig) error {
+	var err error
+	if sc.IntervalDuration, err = duration(sc.Interval, 5*time.Second); err != nil || sc.IntervalDuration <= 0 {
+		return fmt.Errorf("steady_state: invalid interval %q", sc.Interval)
+	}
+	if len(sc.Probes) == 0 {
+		return fmt.Errorf("steady_state: at least one probe is required")
+	}
+
+	for i := range sc.Probes {
+		if err := sc.Probes[i].validate(proxies); err != nil {
+			return fmt.Errorf("steady_state: probes[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (pc *ProbeConfig) validate(proxies []ProxyConfig) error {
+	if pc.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	var err error
+	if pc.ForDuration, err = duration(pc.For, 0); err != nil {
+		return fmt.Errorf("probe %q: invalid for: %w", pc.Name, err)
+	}
+
+	switch {
+	case pc.URL != "" && pc.Proxy != "":
+		return fmt.Errorf("probe %q: use either url or proxy, not both", pc.Name)
+	case pc.URL != "":
+		u, err := url.Parse(pc.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("probe %q: url must be http or https", pc.Name)
+		}
+		if pc.TimeoutDuration, err = duration(pc.Timeout, 5*time.Second); err != nil {
+			return fmt.Errorf("probe %q: invalid timeout: %w", pc.Name, err)
+		}
+	case pc.Proxy != "":
+		if !slices.ContainsFunc(proxies, func(p ProxyConfig) bool { return p.Name == pc.Proxy }) {
+			return fmt.Errorf("probe %q: no proxy named %q", pc.Name, pc.Proxy)
+		}
+		if pc.MinSuccessRate == 0 && pc.MaxP99 == "" {
+			return fmt.Errorf("probe %q: min_success_rate or max_p99 is required", pc.Name)
+		}
+		if pc.MinSuccessRate < 0 || pc.MinSuccessRate > 100 {
+			return fmt.Errorf("probe %q: min_success_rate must be between 0 and 100", pc.Name)
+		}
+		if pc.MaxP99Duration, err = duration(pc.MaxP99, 0); err != nil {
+			return fmt.Errorf("probe %q: invalid max_p99: %w", pc.Name, err)
+		}
+		if pc.WindowDuration, err = duration(pc.Window, 30*time.Second); err != nil || pc.WindowDuration <= 0 {
+			return fmt.Errorf("probe %q: invalid window %q", pc.Name, pc.Window)
+		}
+	default:
+		return fmt.Errorf("probe %q: url or proxy is required", pc.Name)
+	}
+	return nil
+}
+
+// duration parses s, def when it's empty
+func duration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Per-request chaos picked by X-Chaos-* headers, for requests that know the secret
+type ControlConfig struct {
+	Secret string `yaml:"secret"` // Sent in X-Chaos-Secret
+}
+
+// Rate limiting like an API gateway, requests over the limit get a 429
+type RateLimitConfig struct {
+	Algorithm string `yaml:"algorithm"` // "token_bucket" (default) or "sliding_window"
+	Limit     int    `yaml:"limit"`     // Requests per window
+	Window    string `yaml:"window"`    // "1s" by default
+	Burst     int    `yaml:"burst"`     // Token bucket capacity, limit by default
+	Key       string `yaml:"key"`       // "ip" (default), "header" or "route"
+	Header    string `yaml:"header"`    // Header counted by with key: header, e.g. X-API-Key
+
+	WindowDuration time.Duration `yaml:"-"`
+}
+
+func (rl *RateLimitConfig) validate() error {
+	switch rl.Algorithm {
+	case "":
+		rl.Algorithm = "token_bucket"
+	case "token_bucket", "sliding_window":
+	default:
+		return fmt.Errorf("rate_limit: algorithm must be token_bucket or sliding_window, got %q", rl.Algorithm)
+	}
+	switch rl.Key {
+	case "":
+		rl.Key = "ip"
+	case "ip", "route":
+	case "header":
+		if rl.Header == "" {
+			return fmt.Errorf("rate_limit: header is required with key: header")
+		}
+	default:
+		return fmt.Errorf("rate_limit: key must be ip, header or route, got %q", rl.Key)
+	}
+	if rl.Limit <= 0 {
+		return fmt.Errorf("rate_limit: limit must be positive")
+	}
+	if rl.Burst < 0 {
+		return fmt.Errorf("rate_limit: burst must not be negative")
+	}
+
+	window := rl.Window
+	if window == "" {
+		window = "1s"
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil {
+		return fmt.Errorf("rate_limit: invalid window: %w", err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("rate_limit: window must be positive")
+	}
+	rl.WindowDuration = d
+	return nil
+}
+
+// TLS settings for connections from the proxy to the upstream
+type UpstreamTLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
 }
 
 type Latencies struct {
 	Latency    time.Duration
 	LatencyMin time.Duration
 	LatencyMax time.Duration
+	StaleAge   time.Duration
+
+	DuplicateDelay time.Duration
+	ReorderWindow  time.Duration
+	ExpiresAfter   time.Duration
 }
 
 func Load() (*Config, error) {
@@ -54,61 +542,201 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file %w", err)
 	}
 
-	if cfg.Upstream == "" {
-		return nil, fmt.Errorf("upstream URL is required")
+	if len(cfg.Proxies) == 0 {
+		// Top-level listen/upstream describe the one and only proxy
+		single := cfg.single()
+		if err := single.validate(); err != nil {
+			return nil, err
+		}
+		cfg.Mode = single.Mode
+		cfg.Listen = single.Listen
+		cfg.UpstreamURL = single.UpstreamURL
+		cfg.Forward = single.Forward
+		cfg.Transport = single.Transport
+		cfg.Proxies = []ProxyConfig{single}
+	} else if err := cfg.validateProxies(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Admin != nil {
+		if err := cfg.Admin.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.KillSwitch != nil {
+		if err := cfg.KillSwitch.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.SteadyState != nil {
+		if err := cfg.SteadyState.validate(cfg.Proxies); err != nil {
+			return nil, err
+		}
 	}
-	if cfg.Listen == "" {
-		slog.Warn("listening port not defined, using default :8080")
-		cfg.Listen = ":8080"
+	if cfg.Tracing != nil {
+		if err := cfg.Tracing.validate(); err != nil {
+			return nil, err
+		}
 	}
 
-	upstreamURL, err := url.Parse((cfg.Upstream))
-	if err != nil {
-		return nil, fmt.Errorf("invalid upstream URL: %w", err)
+	experiments := make(map[string]bool)
+	for i := range cfg.Experiments {
+		ec := &cfg.Experiments[i]
+		if err := ec.validate(cfg.Proxies); err != nil {
+			return nil, fmt.Errorf("experiments[%d]: %w", i, err)
+		}
+		if experiments[ec.Name] {
+			return nil, fmt.Errorf("experiments[%d]: duplicate name %q", i, ec.Name)
+		}
+		experiments[ec.Name] = true
 	}
-	cfg.UpstreamURL = upstreamURL
 
 	return &cfg, nil
 }
 
+func (cfg *Config) validateProxies() error {
+	if cfg.Listen != "" || cfg.Upstream != "" || len(cfg.Upstreams) > 0 {
+		return fmt.Errorf("use either top-level listen/upstream or proxies, not both")
+	}
+
+	names := make(map[string]bool)
+	listens := make(map[string]bool)
+	for i := range cfg.Proxies {
+		p := &cfg.Proxies[i]
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("proxies[%d]: %w", i, err)
+		}
+		if p.Name == "" {
+			p.Name = p.Listen
+		}
+		if names[p.Name] {
+			return fmt.Errorf("proxies[%d]: duplicate name %q", i, p.Name)
+		}
+		if listens[p.Listen] {
+			return fmt.Errorf("proxies[%d]: listen address %s is already used", i, p.Listen)
+		}
+		names[p.Name] = true
+		listens[p.Listen] = true
+	}
+
+	return nil
+}
+
+// single turns the top-level fields into a proxy entry
+func (cfg *Config) single() ProxyConfig {
+	return ProxyConfig{
+		Name:        "default",
+		Mode:        cfg.Mode,
+		Listen:      cfg.Listen,
+		SocketMode:  cfg.SocketMode,
+		Upstream:    cfg.Upstream,
+		PoolConfig:  cfg.PoolConfig,
+		Chaos:       cfg.Chaos,
+		Rules:       cfg.Rules,
+		Routes:      cfg.Routes,
+		ListenTLS:   cfg.ListenTLS,
+		UpstreamTLS: cfg.UpstreamTLS,
+		Forward:     cfg.Forward,
+		Transport:   cfg.Transport,
+		Recording:   cfg.Recording,
+		HAR:         cfg.HAR,
+		RateLimit:   cfg.RateLimit,
+		Control:     cfg.Control,
+	}
+}
+
+func (m MatchConfig) String() string {
+	var parts []string
+	if m.Method != "" {
+		parts = append(parts, "method="+m.Method)
+	}
+	if m.Host != "" {
+		parts = append(parts, "host="+m.Host)
+	}
+	if m.PathPrefix != "" {
+		parts = append(parts, "path_prefix="+m.PathPrefix)
+	}
+	if m.Header != "" {
+		parts = append(parts, "header="+m.Header+":"+m.HeaderValue)
+	}
+	if len(parts) == 0 {
+		return "any request"
+	}
+	return strings.Join(parts, " ")
+}
+
 func (cfg *Config) ParseDurations() (Latencies, error) {
+	return cfg.Chaos.ParseDurations()
+}
+
+func (fc FileConfig) ParseDurations() (Latencies, error) {
 	var lat Latencies
 
-	if cfg.Chaos.Latency != "" {
-		d, err := time.ParseDuration(cfg.Chaos.Latency)
+	if fc.Latency != "" {
+		d, err := time.ParseDuration(fc.Latency)
 		if err != nil {
 			return Latencies{}, fmt.Errorf("invalid latency: %w", err)
 		}
 		lat.Latency = d
-	} else {
-		latencyMin, err := time.ParseDuration(cfg.Chaos.LatencyMin)
+	} else if fc.LatencyMin != "" || fc.LatencyMax != "" {
+		latencyMin, err := time.ParseDuration(fc.LatencyMin)
 		if err != nil {
 			return Latencies{}, fmt.Errorf("invalid latency: %w", err)
 		}
-		latencyMax, err := time.ParseDuration(cfg.Chaos.LatencyMax)
+		latencyMax, err := time.ParseDuration(fc.LatencyMax)
 		if err != nil {
 			return Latencies{}, fmt.Errorf("invalid latency: %w", err)
 		}
+		if latencyMax < latencyMin {
+			return Latencies{}, fmt.Errorf("latency_max can't be less than latency_min")
+		}
 		lat.LatencyMin = latencyMin
 		lat.LatencyMax = latencyMax
 	}
 
-	return lat, nil
-}
+	if fc.StaleAge != "" {
+		d, err := time.ParseDuration(fc.StaleAge)
+		if err != nil {
+			return Latencies{}, fmt.Errorf("invalid stale_age: %w", err)
+		}
+		lat.StaleAge = d
+	}
 
-func (cfg *Config) PrintConfiguration() {
-	fmt.Println("Chaos configuration")
-	fmt.Printf("- Error rate: %v%%\n", cfg.Chaos.ErrorRate)
-	fmt.Printf("- Error code: %v\n", cfg.Chaos.ErrorCode)
-	fmt.Printf("- Drop rate: %v%%\n", cfg.Chaos.DropRate)
+	if fc.DuplicateDelay != "" {
+		d, err := time.ParseDuration(fc.DuplicateDelay)
+		if err != nil {
+			return Latencies{}, fmt.Errorf("invalid duplicate_delay: %w", err)
+		}
+		lat.DuplicateDelay = d
+	}
 
-	if cfg.Chaos.Latency != "" {
-		fmt.Printf("- Fixed latency: %v\n", cfg.Chaos.Latency)
-	} else {
-		fmt.Printf("- Minimum latency: %v\n", cfg.Chaos.LatencyMin)
-		fmt.Printf("- Maximum latency: %v\n", cfg.Chaos.LatencyMax)
+	if fc.ReorderWindow != "" {
+		d, err := time.ParseDuration(fc.ReorderWindow)
+		if err != nil {
+			return Latencies{}, fmt.Errorf("invalid reorder_window: %w", err)
+		}
+		lat.ReorderWindow = d
+	}
 
+	if fc.ExpiresAfter != "" {
+		d, err := time.ParseDuration(fc.ExpiresAfter)
+		if err != nil {
+			return Latencies{}, fmt.Errorf("invalid expires_after: %w", err)
+		}
+		lat.ExpiresAfter = d
 	}
 
-	fmt.Printf("- Corrupt rate: %v%%\n", cfg.Chaos.CorruptRate)
+	return lat, nil
+}
+
+func (cfg *Config) PrintConfiguration() {
+	if len(cfg.Proxies) == 0 {
+		single := cfg.single()
+		single.PrintConfiguration()
+		return
+	}
+	for _, p := range cfg.Proxies {
+		p.PrintConfiguration()
+	}
 }
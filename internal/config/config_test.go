@@ -1,6 +1,7 @@
 package config
 
 import (
+	"crypto/tls"
 	"os"
 	"path/filepath"
 	"testing"
@@ -255,6 +256,20 @@ func TestParseDurations_InvalidMaxLatency(t *testing.T) {
 	}
 }
 
+func TestParseDurations_MaxBelowMinLatency(t *testing.T) {
+	cfg := &Config{
+		Chaos: FileConfig{
+			LatencyMin: "500ms",
+			LatencyMax: "100ms",
+		},
+	}
+
+	_, err := cfg.ParseDurations()
+	if err == nil {
+		t.Error("Expected error for latency_max below latency_min, got nil")
+	}
+}
+
 func TestPrintConfiguration(t *testing.T) {
 	cfg := &Config{
 		Chaos: FileConfig{
@@ -286,3 +301,1427 @@ func TestPrintConfiguration_RandomLatency(t *testing.T) {
 	// This test just ensures PrintConfiguration doesn't panic with random latency
 	cfg.PrintConfiguration()
 }
+
+func TestLoad_TLSConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `upstream: "https://localhost:8443"
+listen_tls:
+  auto_cert: true
+upstream_tls:
+  ca_file: "ca.pem"
+  server_name: "api.internal"
+  insecure_skip_verify: true
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if cfg.ListenTLS == nil || !cfg.ListenTLS.AutoCert {
+		t.Fatal("Expected listen_tls.auto_cert to be parsed")
+	}
+	if cfg.ListenTLS.CertDir != "certs" {
+		t.Errorf("Expected default cert_dir to be 'certs', got '%s'", cfg.ListenTLS.CertDir)
+	}
+	if cfg.UpstreamTLS == nil {
+		t.Fatal("Expected upstream_tls to be parsed")
+	}
+	if cfg.UpstreamTLS.ServerName != "api.internal" {
+		t.Errorf("Expected server_name to be 'api.internal', got '%s'", cfg.UpstreamTLS.ServerName)
+	}
+	if !cfg.UpstreamTLS.InsecureSkipVerify {
+		t.Error("Expected insecure_skip_verify to be true")
+	}
+}
+
+func TestLoad_InvalidTLSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "listener without cert or auto_cert",
+			content: `upstream: "http://localhost:8080"
+listen_tls:
+  hosts: ["localhost"]
+`,
+		},
+		{
+			name: "listener cert without key",
+			content: `upstream: "http://localhost:8080"
+listen_tls:
+  cert_file: "tls.crt"
+`,
+		},
+		{
+			name: "upstream client key without cert",
+			content: `upstream: "http://localhost:8080"
+upstream_tls:
+  key_file: "client.key"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			err := os.WriteFile(configPath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			_, err = Load()
+			if err == nil {
+				t.Error("Expected error for invalid TLS config, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_TLSFaults(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `upstream: "http://localhost:8080"
+listen_tls:
+  auto_cert: true
+  faults:
+    delay_rate: 20
+    delay: "2s"
+    expired_cert_rate: 5
+    downgrade_rate: 10
+    downgrade_version: "1.1"
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	f := cfg.ListenTLS.Faults
+	if f.DelayDuration != 2*time.Second {
+		t.Errorf("Expected delay to be 2s, got %v", f.DelayDuration)
+	}
+	if f.ExpiredRate != 5 {
+		t.Errorf("Expected expired_cert_rate to be 5, got %v", f.ExpiredRate)
+	}
+	if f.MaxVersion != tls.VersionTLS11 {
+		t.Errorf("Expected downgrade version TLS 1.1, got %x", f.MaxVersion)
+	}
+}
+
+func TestLoad_InvalidTLSFaults(t *testing.T) {
+	for _, faults := range []string{`delay: "soon"`, `downgrade_version: "0.9"`} {
+		t.Run(faults, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := "upstream: \"http://localhost:8080\"\nlisten_tls:\n  auto_cert: true\n  faults:\n    " + faults + "\n"
+
+			err := os.WriteFile(configPath, []byte(configContent), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			_, err = Load()
+			if err == nil {
+				t.Error("Expected error for invalid TLS faults, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_ForwardModeWithRules(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `mode: forward
+forward:
+  mitm: true
+rules:
+  - name: stripe
+    host: "*.stripe.com"
+    chaos:
+      error_rate: 50
+      latency: "1s"
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error without upstream in forward mode, got: %v", err)
+	}
+
+	if cfg.Mode != ModeForward {
+		t.Errorf("Expected mode to be 'forward', got '%s'", cfg.Mode)
+	}
+	if cfg.UpstreamURL != nil {
+		t.Error("Expected UpstreamURL to be nil in forward mode")
+	}
+	if cfg.Forward.CertDir != "certs" {
+		t.Errorf("Expected default cert_dir to be 'certs', got '%s'", cfg.Forward.CertDir)
+	}
+	if len(cfg.Rules) != 1 || cfg.Rules[0].Host != "*.stripe.com" {
+		t.Fatalf("Expected one rule for *.stripe.com, got %+v", cfg.Rules)
+	}
+	if cfg.Rules[0].Chaos.ErrorRate != 50 {
+		t.Errorf("Expected rule error_rate to be 50, got %v", cfg.Rules[0].Chaos.ErrorRate)
+	}
+}
+
+func TestLoad_InvalidMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	err := os.WriteFile(configPath, []byte("mode: sideways\nupstream: \"http://localhost:8080\"\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	_, err = Load()
+	if err == nil {
+		t.Error("Expected error for unsupported mode, got nil")
+	}
+}
+
+func TestParseDurations_NoLatency(t *testing.T) {
+	cfg := &Config{
+		Chaos: FileConfig{
+			ErrorRate: 10,
+		},
+	}
+
+	latencies, err := cfg.ParseDurations()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if latencies != (Latencies{}) {
+		t.Errorf("Expected zero latencies, got %+v", latencies)
+	}
+}
+
+func TestLoad_Proxies(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `proxies:
+  - name: users
+    listen: ":9001"
+    upstream: "http://users.internal"
+    chaos:
+      error_rate: 10
+  - listen: ":9002"
+    upstream: "http://orders.internal"
+    rules:
+      - name: slow-checkout
+        path_prefix: "/checkout"
+        chaos:
+          latency: "2s"
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(cfg.Proxies) != 2 {
+		t.Fatalf("Expected 2 proxies, got %d", len(cfg.Proxies))
+	}
+	if cfg.Proxies[0].Name != "users" || cfg.Proxies[0].Chaos.ErrorRate != 10 {
+		t.Errorf("Unexpected first proxy: %+v", cfg.Proxies[0])
+	}
+	if cfg.Proxies[1].Name != ":9002" {
+		t.Errorf("Expected unnamed proxy to be named after its listen address, got '%s'", cfg.Proxies[1].Name)
+	}
+	if cfg.Proxies[1].UpstreamURL == nil || cfg.Proxies[1].UpstreamURL.Host != "orders.internal" {
+		t.Error("Expected proxy upstream URL to be parsed")
+	}
+	if cfg.Proxies[1].Mode != ModeReverse {
+		t.Errorf("Expected default mode to be 'reverse', got '%s'", cfg.Proxies[1].Mode)
+	}
+}
+
+func TestLoad_SingleProxyShorthand(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	err := os.WriteFile(configPath, []byte("upstream: \"http://localhost:8080\"\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(cfg.Proxies) != 1 {
+		t.Fatalf("Expected top-level fields to become one proxy, got %d", len(cfg.Proxies))
+	}
+	if cfg.Proxies[0].Name != "default" || cfg.Proxies[0].Listen != ":8080" {
+		t.Errorf("Unexpected proxy: %+v", cfg.Proxies[0])
+	}
+}
+
+func TestLoad_InvalidProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "mixed with top-level upstream",
+			content: `upstream: "http://localhost:8080"
+proxies:
+  - listen: ":9001"
+    upstream: "http://localhost:8081"
+`,
+		},
+		{
+			name: "duplicate name",
+			content: `proxies:
+  - name: a
+    listen: ":9001"
+    upstream: "http://localhost:8081"
+  - name: a
+    listen: ":9002"
+    upstream: "http://localhost:8082"
+`,
+		},
+		{
+			name: "duplicate listen",
+			content: `proxies:
+  - listen: ":9001"
+    name: a
+    upstream: "http://localhost:8081"
+  - listen: ":9001"
+    name: b
+    upstream: "http://localhost:8082"
+`,
+		},
+		{
+			name: "missing upstream",
+			content: `proxies:
+  - listen: ":9001"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			err := os.WriteFile(configPath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			_, err = Load()
+			if err == nil {
+				t.Error("Expected error for invalid proxies, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_Routes(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `routes:
+  - name: users
+    host: "users.example.com"
+    upstream: "http://users.internal"
+  - path_prefix: "/orders"
+    strip_prefix: true
+    upstream: "http://orders.internal"
+    chaos:
+      error_rate: 25
+  - header: "X-Service"
+    header_value: "billing"
+    upstream: "http://billing.internal"
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected routes to replace the top-level upstream, got: %v", err)
+	}
+
+	routes := cfg.Proxies[0].Routes
+	if len(routes) != 3 {
+		t.Fatalf("Expected 3 routes, got %d", len(routes))
+	}
+	if routes[0].Host != "users.example.com" || routes[0].UpstreamURL.Host != "users.internal" {
+		t.Errorf("Unexpected first route: %+v", routes[0])
+	}
+	if routes[1].Name != "route-1" {
+		t.Errorf("Expected unnamed route to get a default name, got '%s'", routes[1].Name)
+	}
+	if !routes[1].StripPrefix || routes[1].Chaos.ErrorRate != 25 {
+		t.Errorf("Unexpected second route: %+v", routes[1])
+	}
+	if routes[2].Header != "X-Service" || routes[2].HeaderValue != "billing" {
+		t.Errorf("Unexpected third route: %+v", routes[2])
+	}
+}
+
+func TestLoad_InvalidRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "missing upstream",
+			content: `routes:
+  - path_prefix: "/users"
+`,
+		},
+		{
+			name: "strip without prefix",
+			content: `routes:
+  - host: "users.example.com"
+    strip_prefix: true
+    upstream: "http://users.internal"
+`,
+		},
+		{
+			name: "forward mode",
+			content: `mode: forward
+routes:
+  - path_prefix: "/users"
+    upstream: "http://users.internal"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			err := os.WriteFile(configPath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			_, err = Load()
+			if err == nil {
+				t.Error("Expected error for invalid routes, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_UpstreamPool(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `balance: consistent_hash
+hash_header: "X-User-ID"
+upstreams:
+  - url: "http://app-1:8080"
+  - name: slow
+    url: "http://app-2:8080"
+    chaos:
+      latency: "3s"
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	pool := cfg.Proxies[0].PoolConfig
+	if pool.Balance != "consistent_hash" || pool.HashHeader != "X-User-ID" {
+		t.Errorf("Unexpected pool settings: %+v", pool)
+	}
+	if len(pool.Upstreams) != 2 {
+		t.Fatalf("Expected 2 backends, got %d", len(pool.Upstreams))
+	}
+	if pool.Upstreams[0].Name != "backend-1" || pool.Upstreams[0].BackendURL.Host != "app-1:8080" {
+		t.Errorf("Unexpected first backend: %+v", pool.Upstreams[0])
+	}
+	if pool.Upstreams[1].Chaos.Latency != "3s" {
+		t.Errorf("Expected backend chaos to be parsed, got %+v", pool.Upstreams[1].Chaos)
+	}
+}
+
+func TestLoad_InvalidUpstreamPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "both upstream and upstreams",
+			content: `upstream: "http://app:8080"
+upstreams:
+  - url: "http://app-1:8080"
+`,
+		},
+		{
+			name: "unknown strategy",
+			content: `balance: fastest
+upstreams:
+  - url: "http://app-1:8080"
+`,
+		},
+		{
+			name: "backend without url",
+			content: `upstreams:
+  - name: nowhere
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			err := os.WriteFile(configPath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			_, err = Load()
+			if err == nil {
+				t.Error("Expected error for invalid upstream pool, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_TransportChaos(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `upstream: "http://localhost:3000"
+transport_chaos:
+  dial_error_rate: 5
+  reset_reuse_rate: 10
+  slow_dial_rate: 20
+  slow_dial: "2s"
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	tc := cfg.Proxies[0].Transport
+	if tc.DialErrorRate != 5 || tc.ResetReuseRate != 10 || tc.SlowDialRate != 20 {
+		t.Errorf("Unexpected transport chaos: %+v", tc)
+	}
+	if tc.SlowDialDuration != 2*time.Second {
+		t.Errorf("Expected slow dial 2s, got %v", tc.SlowDialDuration)
+	}
+}
+
+func TestLoad_InvalidTransportChaos(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `upstream: "http://localhost:3000"
+transport_chaos:
+  slow_dial_rate: 20
+  slow_dial: "soon"
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for invalid slow_dial, got nil")
+	}
+}
+
+func TestLoad_UnixSocketListen(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `listen: "unix:///run/chaos.sock"
+socket_mode: "0600"
+upstream: "unix:///var/run/app.sock"
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	p := cfg.Proxies[0]
+	if p.SocketPerm != 0600 {
+		t.Errorf("Expected socket permissions 0600, got %o", p.SocketPerm)
+	}
+	if p.UpstreamURL.Scheme != "unix" || p.UpstreamURL.Path != "/var/run/app.sock" {
+		t.Errorf("Expected unix upstream, got %s", p.UpstreamURL)
+	}
+}
+
+func TestLoad_InvalidUnixSocket(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "bad socket mode",
+			content: `listen: "unix:///run/chaos.sock"
+socket_mode: "rw-rw----"
+upstream: "http://localhost:3000"
+`,
+		},
+		{
+			name: "socket mode on tcp listener",
+			content: `listen: ":8080"
+socket_mode: "0600"
+upstream: "http://localhost:3000"
+`,
+		},
+		{
+			name: "missing socket path",
+			content: `listen: "unix://"
+upstream: "http://localhost:3000"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			err := os.WriteFile(configPath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			_, err = Load()
+			if err == nil {
+				t.Error("Expected error for invalid unix socket config, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_StubRoutes(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `routes:
+  - name: users
+    path_prefix: /users
+    respond:
+      status: 201
+      headers:
+        Content-Type: application/json
+      body: '{"id": 1}'
+  - name: orders
+    path_prefix: /orders
+    respond:
+      body_file: orders.json
+      template: true
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	routes := cfg.Proxies[0].Routes
+	if r := routes[0].Respond; r.Status != 201 || r.Headers["Content-Type"] != "application/json" || r.Body != `{"id": 1}` {
+		t.Errorf("Unexpected stub: %+v", r)
+	}
+	if r := routes[1].Respond; r.Status != 200 || r.BodyFile != "orders.json" || !r.Template {
+		t.Errorf("Expected default status 200 and body_file, got %+v", r)
+	}
+}
+
+func TestLoad_InvalidStubRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "stub with upstream",
+			content: `routes:
+  - path_prefix: /users
+    upstream: "http://users:8080"
+    respond:
+      body: "hi"
+`,
+		},
+		{
+			name: "body and body_file",
+			content: `routes:
+  - path_prefix: /users
+    respond:
+      body: "hi"
+      body_file: users.json
+`,
+		},
+		{
+			name: "invalid status",
+			content: `routes:
+  - path_prefix: /users
+    respond:
+      status: 999
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			err := os.WriteFile(configPath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			_, err = Load()
+			if err == nil {
+				t.Error("Expected error for invalid stub route, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_Recording(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `upstream: "http://localhost:3000"
+recording:
+  mode: replay
+  match_body: true
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	rc := cfg.Proxies[0].Recording
+	if rc == nil || rc.Mode != "replay" || !rc.MatchBody {
+		t.Fatalf("Unexpected recording config: %+v", rc)
+	}
+	if rc.Dir != "recordings" {
+		t.Errorf("Expected default dir 'recordings', got '%s'", rc.Dir)
+	}
+}
+
+func TestLoad_InvalidRecording(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "unknown mode",
+			content: `upstream: "http://localhost:3000"
+recording:
+  mode: rewind
+`,
+		},
+		{
+			name: "forward mode",
+			content: `mode: forward
+recording:
+  mode: record
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			err := os.WriteFile(configPath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			_, err = Load()
+			if err == nil {
+				t.Error("Expected error for invalid recording config, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_HAR(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `upstream: "http://localhost:3000"
+har:
+  file: "capture.har"
+  endpoint: "/_chaos/har"
+  bodies: true
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	h := cfg.Proxies[0].HAR
+	if h == nil || h.File != "capture.har" || h.Endpoint != "/_chaos/har" || !h.Bodies {
+		t.Fatalf("Unexpected HAR config: %+v", h)
+	}
+	if h.MaxEntries != 1000 {
+		t.Errorf("Expected default max_entries 1000, got %d", h.MaxEntries)
+	}
+}
+
+func TestLoad_InvalidHAR(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "no output",
+			content: `upstream: "http://localhost:3000"
+har:
+  bodies: true
+`,
+		},
+		{
+			name: "relative endpoint",
+			content: `upstream: "http://localhost:3000"
+har:
+  endpoint: "har"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			err := os.WriteFile(configPath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			_, err = Load()
+			if err == nil {
+				t.Error("Expected error for invalid HAR config, got nil")
+			}
+		})
+	}
+}
+
+func TestParseDurations_StaleAge(t *testing.T) {
+	cfg := &Config{
+		Chaos: FileConfig{
+			StaleRate: 10,
+			StaleAge:  "30s",
+		},
+	}
+
+	latencies, err := cfg.ParseDurations()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if latencies.StaleAge != 30*time.Second {
+		t.Errorf("Expected StaleAge to be 30s, got %v", latencies.StaleAge)
+	}
+
+	cfg.Chaos.StaleAge = "yesterday"
+	if _, err := cfg.ParseDurations(); err == nil {
+		t.Error("Expected error for invalid stale_age, got nil")
+	}
+}
+
+func TestParseDurations_DuplicateDelay(t *testing.T) {
+	cfg := &Config{
+		Chaos: FileConfig{
+			DuplicateRate:  10,
+			DuplicateDelay: "250ms",
+		},
+	}
+
+	latencies, err := cfg.ParseDurations()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if latencies.DuplicateDelay != 250*time.Millisecond {
+		t.Errorf("Expected DuplicateDelay to be 250ms, got %v", latencies.DuplicateDelay)
+	}
+
+	cfg.Chaos.DuplicateDelay = "soon"
+	if _, err := cfg.ParseDurations(); err == nil {
+		t.Error("Expected error for invalid duplicate_delay, got nil")
+	}
+}
+
+func TestParseDurations_ReorderWindow(t *testing.T) {
+	cfg := &Config{
+		Chaos: FileConfig{
+			ReorderRate:   10,
+			ReorderWindow: "2s",
+		},
+	}
+
+	latencies, err := cfg.ParseDurations()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if latencies.ReorderWindow != 2*time.Second {
+		t.Errorf("Expected ReorderWindow to be 2s, got %v", latencies.ReorderWindow)
+	}
+
+	cfg.Chaos.ReorderWindow = "a while"
+	if _, err := cfg.ParseDurations(); err == nil {
+		t.Error("Expected error for invalid reorder_window, got nil")
+	}
+}
+
+func TestLoad_RateLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `upstream: "http://localhost:3000"
+rate_limit:
+  limit: 10
+`
+
+	err := os.WriteFile(configPath, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	rl := cfg.Proxies[0].RateLimit
+	if rl == nil || rl.Limit != 10 {
+		t.Fatalf("Unexpected rate limit config: %+v", rl)
+	}
+	if rl.Algorithm != "token_bucket" || rl.Key != "ip" || rl.WindowDuration != time.Second {
+		t.Errorf("Expected token_bucket per ip every 1s by default, got %s per %s every %v", rl.Algorithm, rl.Key, rl.WindowDuration)
+	}
+}
+
+func TestLoad_InvalidRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "no limit",
+			content: `upstream: "http://localhost:3000"
+rate_limit:
+  window: "1m"
+`,
+		},
+		{
+			name: "unknown algorithm",
+			content: `upstream: "http://localhost:3000"
+rate_limit:
+  algorithm: leaky_bucket
+  limit: 10
+`,
+		},
+		{
+			name: "header key without header",
+			content: `upstream: "http://localhost:3000"
+rate_limit:
+  limit: 10
+  key: header
+`,
+		},
+		{
+			name: "invalid window",
+			content: `upstream: "http://localhost:3000"
+rate_limit:
+  limit: 10
+  window: "hourly"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			err := os.WriteFile(configPath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			_, err = Load()
+			if err == nil {
+				t.Error("Expected error for invalid rate limit config, got nil")
+			}
+		})
+	}
+}
+
+func TestParseDurations_ExpiresAfter(t *testing.T) {
+	cfg := &Config{
+		Upstream: "http://localhost:3000",
+		Chaos: FileConfig{
+			ExpiresAfter: "30m",
+		},
+	}
+
+	latencies, err := cfg.ParseDurations()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if latencies.ExpiresAfter != 30*time.Minute {
+		t.Errorf("Expected ExpiresAfter to be 30m, got %v", latencies.ExpiresAfter)
+	}
+
+	cfg.Chaos.ExpiresAfter = "soon"
+	if _, err := cfg.ParseDurations(); err == nil {
+		t.Error("Expected error for invalid expires_after, got nil")
+	}
+}
+
+func TestLoad_KillSwitch(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	configContent := `upstream: "http://localhost:3000"
+kill_switch:
+  file: "/tmp/chaos-off"
+`
+	if err := os.WriteFile("config.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.KillSwitch == nil || cfg.KillSwitch.File != "/tmp/chaos-off" {
+		t.Errorf("Unexpected kill switch config: %+v", cfg.KillSwitch)
+	}
+
+	if err := os.WriteFile("config.yaml", []byte("upstream: \"http://localhost:3000\"\nkill_switch: {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for kill_switch without file, got nil")
+	}
+}
+
+func TestLoad_Experiments(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	configContent := `upstream: "http://localhost:3000"
+experiments:
+  - name: "checkout-outage"
+    duration: "15m"
+    chaos:
+      error_rate: 50
+`
+	if err := os.WriteFile("config.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(cfg.Experiments) != 1 {
+		t.Fatalf("Expected 1 experiment, got %d", len(cfg.Experiments))
+	}
+	ec := cfg.Experiments[0]
+	if ec.Proxy != "default" || ec.Length != 15*time.Minute || ec.SummaryDir != "experiments" || ec.Chaos.ErrorRate != 50 {
+		t.Errorf("Unexpected experiment config: %+v", ec)
+	}
+}
+
+func TestLoad_InvalidExperiments(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "missing duration",
+			content: "upstream: \"http://localhost:3000\"\nexperiments:\n  - name: a\n",
+		},
+		{
+			name:    "invalid duration",
+			content: "upstream: \"http://localhost:3000\"\nexperiments:\n  - name: a\n    duration: forever\n",
+		},
+		{
+			name:    "unknown proxy",
+			content: "upstream: \"http://localhost:3000\"\nexperiments:\n  - name: a\n    duration: 1m\n    proxy: nope\n",
+		},
+		{
+			name:    "duplicate name",
+			content: "upstream: \"http://localhost:3000\"\nexperiments:\n  - name: a\n    duration: 1m\n  - name: a\n    duration: 2m\n",
+		},
+		{
+			name:    "proxy required with several proxies",
+			content: "proxies:\n  - listen: \":8080\"\n    upstream: \"http://localhost:3000\"\n  - listen: \":8081\"\n    upstream: \"http://localhost:3001\"\nexperiments:\n  - name: a\n    duration: 1m\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			if err := os.WriteFile("config.yaml", []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			if _, err := Load(); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_SteadyState(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	configContent := `upstream: "http://localhost:3000"
+steady_state:
+  probes:
+    - name: "health"
+      url: "http://localhost:3000/health"
+    - name: "success"
+      proxy: "default"
+      min_success_rate: 95
+      max_p99: "500ms"
+      for: "30s"
+`
+	if err := os.WriteFile("config.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	ss := cfg.SteadyState
+	if ss == nil || ss.IntervalDuration != 5*time.Second || len(ss.Probes) != 2 {
+		t.Fatalf("Unexpected steady state config: %+v", ss)
+	}
+	if ss.Probes[0].TimeoutDuration != 5*time.Second {
+		t.Errorf("Expected the default timeout of 5s, got %v", ss.Probes[0].TimeoutDuration)
+	}
+	p := ss.Probes[1]
+	if p.WindowDuration != 30*time.Second || p.ForDuration != 30*time.Second || p.MaxP99Duration != 500*time.Millisecond {
+		t.Errorf("Unexpected probe config: %+v", p)
+	}
+}
+
+func TestLoad_InvalidSteadyState(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "no probes",
+			content: "upstream: \"http://localhost:3000\"\nsteady_state:\n  interval: 1s\n",
+		},
+		{
+			name:    "url and proxy",
+			content: "upstream: \"http://localhost:3000\"\nsteady_state:\n  probes:\n    - name: a\n      url: http://x\n      proxy: default\n",
+		},
+		{
+			name:    "neither url nor proxy",
+			content: "upstream: \"http://localhost:3000\"\nsteady_state:\n  probes:\n    - name: a\n",
+		},
+		{
+			name:    "unknown proxy",
+			content: "upstream: \"http://localhost:3000\"\nsteady_state:\n  probes:\n    - name: a\n      proxy: nope\n      min_success_rate: 90\n",
+		},
+		{
+			name:    "proxy without threshold",
+			content: "upstream: \"http://localhost:3000\"\nsteady_state:\n  probes:\n    - name: a\n      proxy: default\n",
+		},
+		{
+			name:    "invalid for",
+			content: "upstream: \"http://localhost:3000\"\nsteady_state:\n  probes:\n    - name: a\n      url: http://x\n      for: ages\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalWd, _ := os.Getwd()
+			defer os.Chdir(originalWd)
+			os.Chdir(tmpDir)
+
+			if err := os.WriteFile("config.yaml", []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			if _, err := Load(); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_Admin(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	configContent := `upstream: "http://localhost:3000"
+admin:
+  listen: "127.0.0.1:9000"
+  token: "secret"
+`
+	if err := os.WriteFile("config.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.Admin == nil || cfg.Admin.Listen != "127.0.0.1:9000" || cfg.Admin.Token != "secret" {
+		t.Errorf("Unexpected admin config: %+v", cfg.Admin)
+	}
+
+	if err := os.WriteFile("config.yaml", []byte("upstream: \"http://localhost:3000\"\nadmin:\n  token: \"secret\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for admin without listen, got nil")
+	}
+}
+
+func TestLoad_ControlHeadersRequireSecret(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	configContent := `upstream: "http://localhost:3000"
+control_headers: {}
+`
+	if err := os.WriteFile("config.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for control headers without a secret, got nil")
+	}
+}
+
+func TestLoad_Tracing(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	os.Chdir(tmpDir)
+
+	configContent := `upstream: "http://localhost:3000"
+tracing:
+  endpoint: "http://localhost:4318/v1/traces"
+  headers:
+    x-api-key: "secret"
+`
+	if err := os.WriteFile("config.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.Tracing == nil || cfg.Tracing.Endpoint != "http://localhost:4318/v1/traces" || cfg.Tracing.Headers["x-api-key"] != "secret" {
+		t.Fatalf("Unexpected tracing config: %+v", cfg.Tracing)
+	}
+	if cfg.Tracing.ServiceName != "chaos-proxy" {
+		t.Errorf("Expected service name chaos-proxy, got %q", cfg.Tracing.ServiceName)
+	}
+
+	for _, content := range []string{
+		"upstream: \"http://localhost:3000\"\ntracing: {}\n",
+		"upstream: \"http://localhost:3000\"\ntracing:\n  endpoint: \"localhost:4318\"\n",
+	} {
+		if err := os.WriteFile("config.yaml", []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		if _, err := Load(); err == nil {
+			t.Errorf("Expected error for %q, got nil", content)
+		}
+	}
+}
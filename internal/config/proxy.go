@@ -0,0 +1,358 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProxyConfig is a single listener with its own upstream, chaos settings and
+// rules. Every entry under `proxies` is one of these.
+type ProxyConfig struct {
+	Name        string `yaml:"name"`
+	Mode        string `yaml:"mode"`
+	Listen      string `yaml:"listen"`      // host:port or unix:///path/to.sock
+	SocketMode  string `yaml:"socket_mode"` // Permissions of a unix listen socket, 0660 by default
+	Upstream    string `yaml:"upstream"`
+	PoolConfig  `yaml:",inline"`
+	Chaos       FileConfig         `yaml:"chaos"`
+	Rules       []RuleConfig       `yaml:"rules"`
+	Routes      []RouteConfig      `yaml:"routes"`
+	ListenTLS   *ListenTLSConfig   `yaml:"listen_tls"`
+	UpstreamTLS *UpstreamTLSConfig `yaml:"upstream_tls"`
+	Forward     ForwardConfig      `yaml:"forward"`
+	Transport   TransportConfig    `yaml:"transport_chaos"`
+	Recording   *RecordingConfig   `yaml:"recording"`
+	HAR         *HARConfig         `yaml:"har"`
+	RateLimit   *RateLimitConfig   `yaml:"rate_limit"`
+	Control     *ControlConfig     `yaml:"control_headers"`
+
+	UpstreamURL *url.URL    `yaml:"-"`
+	SocketPerm  fs.FileMode `yaml:"-"`
+}
+
+func (p *ProxyConfig) validate() error {
+	switch p.Mode {
+	case "":
+		p.Mode = ModeReverse
+	case ModeReverse, ModeForward:
+	default:
+		return fmt.Errorf("unsupported mode %q", p.Mode)
+	}
+
+	if p.Upstream == "" && len(p.Upstreams) == 0 && p.Mode == ModeReverse && len(p.Routes) == 0 {
+		return fmt.Errorf("upstream URL is required")
+	}
+	if p.Upstream != "" && len(p.Upstreams) > 0 {
+		return fmt.Errorf("use either upstream or upstreams, not both")
+	}
+	if len(p.Upstreams) > 0 && p.Mode != ModeReverse {
+		return fmt.Errorf("upstreams are only supported in reverse mode")
+	}
+	if err := p.PoolConfig.validate(); err != nil {
+		return err
+	}
+	if len(p.Routes) > 0 && p.Mode != ModeReverse {
+		return fmt.Errorf("routes are only supported in reverse mode")
+	}
+	if p.Listen == "" {
+		slog.Warn("listening port not defined, using default :8080")
+		p.Listen = ":8080"
+	}
+	if err := p.validateSocket(); err != nil {
+		return err
+	}
+
+	if p.Upstream != "" {
+		upstreamURL, err := url.Parse((p.Upstream))
+		if err != nil {
+			return fmt.Errorf("invalid upstream URL: %w", err)
+		}
+		p.UpstreamURL = upstreamURL
+	}
+
+	for i := range p.Routes {
+		route := &p.Routes[i]
+		if route.Name == "" {
+			route.Name = fmt.Sprintf("route-%d", i)
+		}
+		if route.Respond != nil {
+			if route.Upstream != "" || len(route.Upstreams) > 0 {
+				return fmt.Errorf("route %q: use either respond or an upstream, not both", route.Name)
+			}
+			if err := route.Respond.validate(); err != nil {
+				return fmt.Errorf("route %q: %w", route.Name, err)
+			}
+			continue
+		}
+		if route.Upstream == "" && len(route.Upstreams) == 0 {
+			return fmt.Errorf("route %q: upstream URL is required", route.Name)
+		}
+		if route.Upstream != "" && len(route.Upstreams) > 0 {
+			return fmt.Errorf("route %q: use either upstream or upstreams, not both", route.Name)
+		}
+		if route.StripPrefix && route.PathPrefix == "" {
+			return fmt.Errorf("route %q: strip_prefix requires path_prefix", route.Name)
+		}
+		if err := route.PoolConfig.validate(); err != nil {
+			return fmt.Errorf("route %q: %w", route.Name, err)
+		}
+		if route.Upstream != "" {
+			upstreamURL, err := url.Parse(route.Upstream)
+			if err != nil {
+				return fmt.Errorf("route %q: invalid upstream URL: %w", route.Name, err)
+			}
+			route.UpstreamURL = upstreamURL
+		}
+	}
+
+	if p.Forward.MITM && p.Forward.CertDir == "" {
+		p.Forward.CertDir = "certs"
+	}
+
+	if rc := p.Recording; rc != nil {
+		switch rc.Mode {
+		case "record", "replay":
+		default:
+			return fmt.Errorf("recording: mode must be record or replay, got %q", rc.Mode)
+		}
+		if p.Mode != ModeReverse {
+			return fmt.Errorf("recording is only supported in reverse mode")
+		}
+		if rc.Dir == "" {
+			rc.Dir = "recordings"
+		}
+	}
+
+	if h := p.HAR; h != nil {
+		if h.File == "" && h.Endpoint == "" {
+			return fmt.Errorf("har: file or endpoint is required")
+		}
+		if h.Endpoint != "" && !strings.HasPrefix(h.Endpoint, "/") {
+			return fmt.Errorf("har: endpoint must start with /")
+		}
+		if h.MaxEntries < 0 {
+			return fmt.Errorf("har: max_entries must not be negative")
+		}
+		if h.MaxEntries == 0 {
+			h.MaxEntries = 1000
+		}
+	}
+
+	if rl := p.RateLimit; rl != nil {
+		if err := rl.validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.Control != nil && p.Control.Secret == "" {
+		return fmt.Errorf("control_headers: secret is required")
+	}
+
+	if p.Transport.SlowDial != "" {
+		d, err := time.ParseDuration(p.Transport.SlowDial)
+		if err != nil {
+			return fmt.Errorf("transport_chaos: invalid slow_dial: %w", err)
+		}
+		p.Transport.SlowDialDuration = d
+	}
+
+	return p.validateTLS()
+}
+
+func (p *ProxyConfig) validateSocket() error {
+	if !strings.HasPrefix(p.Listen, "unix://") {
+		if p.SocketMode != "" {
+			return fmt.Errorf("socket_mode requires a unix:// listen address")
+		}
+		return nil
+	}
+	if strings.TrimPrefix(p.Listen, "unix://") == "" {
+		return fmt.Errorf("listen: socket path is required")
+	}
+
+	mode := p.SocketMode
+	if mode == "" {
+		mode = "0660"
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0o777 {
+		return fmt.Errorf("invalid socket_mode %q", p.SocketMode)
+	}
+	p.SocketPerm = fs.FileMode(perm)
+	return nil
+}
+
+func (p *ProxyConfig) validateTLS() error {
+	if t := p.ListenTLS; t != nil {
+		if (t.CertFile == "") != (t.KeyFile == "") {
+			return fmt.Errorf("listen_tls: cert_file and key_file must be set together")
+		}
+		if t.CertFile == "" && !t.AutoCert {
+			return fmt.Errorf("listen_tls: either cert_file/key_file or auto_cert is required")
+		}
+		if t.AutoCert && t.CertDir == "" {
+			t.CertDir = "certs"
+		}
+
+		if t.Faults.Delay != "" {
+			d, err := time.ParseDuration(t.Faults.Delay)
+			if err != nil {
+				return fmt.Errorf("listen_tls.faults: invalid delay: %w", err)
+			}
+			t.Faults.DelayDuration = d
+		}
+
+		switch t.Faults.DowngradeVersion {
+		case "", "1.0":
+			t.Faults.MaxVersion = tls.VersionTLS10
+		case "1.1":
+			t.Faults.MaxVersion = tls.VersionTLS11
+		case "1.2":
+			t.Faults.MaxVersion = tls.VersionTLS12
+		default:
+			return fmt.Errorf("listen_tls.faults: unsupported downgrade_version %q", t.Faults.DowngradeVersion)
+		}
+	}
+
+	if t := p.UpstreamTLS; t != nil {
+		if (t.CertFile == "") != (t.KeyFile == "") {
+			return fmt.Errorf("upstream_tls: cert_file and key_file must be set together")
+		}
+	}
+
+	return nil
+}
+
+func (p ProxyConfig) PrintConfiguration() {
+	fmt.Printf("Chaos configuration (%s)\n", p.Name)
+	if p.SocketPerm != 0 {
+		fmt.Printf("- Listen socket: %s (%04o)\n", strings.TrimPrefix(p.Listen, "unix://"), p.SocketPerm)
+	}
+	fmt.Printf("- Error rate: %v%%\n", p.Chaos.ErrorRate)
+	fmt.Printf("- Error code: %v\n", p.Chaos.ErrorCode)
+	fmt.Printf("- Drop rate: %v%%\n", p.Chaos.DropRate)
+
+	if p.Chaos.Latency != "" {
+		fmt.Printf("- Fixed latency: %v\n", p.Chaos.Latency)
+	} else {
+		fmt.Printf("- Minimum latency: %v\n", p.Chaos.LatencyMin)
+		fmt.Printf("- Maximum latency: %v\n", p.Chaos.LatencyMax)
+
+	}
+
+	fmt.Printf("- Corrupt rate: %v%%\n", p.Chaos.CorruptRate)
+	if p.Chaos.StaleRate > 0 {
+		if p.Chaos.StaleAge != "" {
+			fmt.Printf("- Stale rate: %v%% (at least %s old)\n", p.Chaos.StaleRate, p.Chaos.StaleAge)
+		} else {
+			fmt.Printf("- Stale rate: %v%% (%d versions ago)\n", p.Chaos.StaleRate, max(p.Chaos.StaleVersions, 1))
+		}
+	}
+	if p.Chaos.DuplicateRate > 0 {
+		fmt.Printf("- Duplicate rate: %v%% (%d deliveries)\n", p.Chaos.DuplicateRate, max(p.Chaos.DuplicateCount, 2))
+	}
+	if p.Chaos.PostFailureRate > 0 {
+		mode := p.Chaos.PostFailureMode
+		if mode == "" {
+			mode = "error"
+		}
+		fmt.Printf("- Post-upstream failure rate: %v%% (%s)\n", p.Chaos.PostFailureRate, mode)
+	}
+	if p.Chaos.ReorderRate > 0 {
+		order := p.Chaos.ReorderOrder
+		if order == "" {
+			order = "shuffle"
+		}
+		fmt.Printf("- Reorder rate: %v%% (%s)\n", p.Chaos.ReorderRate, order)
+	}
+	if p.Chaos.ExpiresAfter != "" {
+		fmt.Printf("- Chaos expires after: %s\n", p.Chaos.ExpiresAfter)
+	} else if p.Chaos.ActiveUntil != "" {
+		fmt.Printf("- Chaos active until: %s\n", p.Chaos.ActiveUntil)
+	}
+
+	for _, rule := range p.Rules {
+		fmt.Printf("- Rule %q: %s\n", rule.Name, rule.MatchConfig)
+	}
+	for _, b := range p.Upstreams {
+		fmt.Printf("- Backend %q (%s): %s\n", b.Name, p.Balance, b.URL)
+	}
+	for _, route := range p.Routes {
+		if route.Respond != nil {
+			fmt.Printf("- Route %q: %s -> stub %d\n", route.Name, route.MatchConfig, route.Respond.Status)
+			continue
+		}
+		fmt.Printf("- Route %q: %s -> %s\n", route.Name, route.MatchConfig, route.PoolConfig.describe(route.Upstream))
+	}
+	if p.Mode == ModeForward && p.Forward.MITM {
+		fmt.Printf("- Forward proxy MITM: CA in %s\n", p.Forward.CertDir)
+	}
+
+	if p.ListenTLS != nil {
+		if p.ListenTLS.AutoCert {
+			fmt.Printf("- Listener TLS: auto-generated CA in %s\n", p.ListenTLS.CertDir)
+		} else {
+			fmt.Printf("- Listener TLS: %s\n", p.ListenTLS.CertFile)
+		}
+
+		f := p.ListenTLS.Faults
+		if f.DelayRate > 0 {
+			fmt.Printf("- TLS handshake delay: %v%% (%v)\n", f.DelayRate, f.Delay)
+		}
+		if f.AbortRate > 0 {
+			fmt.Printf("- TLS abort rate: %v%%\n", f.AbortRate)
+		}
+		if f.AlertRate > 0 {
+			fmt.Printf("- TLS alert rate: %v%%\n", f.AlertRate)
+		}
+		if f.ExpiredRate > 0 {
+			fmt.Printf("- TLS expired certificate rate: %v%%\n", f.ExpiredRate)
+		}
+		if f.SelfSignedRate > 0 {
+			fmt.Printf("- TLS self-signed certificate rate: %v%%\n", f.SelfSignedRate)
+		}
+		if f.WrongHostRate > 0 {
+			fmt.Printf("- TLS wrong hostname rate: %v%%\n", f.WrongHostRate)
+		}
+		if f.DowngradeRate > 0 {
+			fmt.Printf("- TLS downgrade rate: %v%%\n", f.DowngradeRate)
+		}
+	}
+	if t := p.Transport; t != (TransportConfig{}) {
+		fmt.Printf("- Upstream DNS/dial/TLS error rate: %v%%/%v%%/%v%%\n", t.DNSErrorRate, t.DialErrorRate, t.TLSErrorRate)
+		fmt.Printf("- Upstream reused connection reset rate: %v%%\n", t.ResetReuseRate)
+		if t.SlowDialRate > 0 {
+			fmt.Printf("- Upstream slow dial: %v%% (%v)\n", t.SlowDialRate, t.SlowDial)
+		}
+	}
+	if rc := p.Recording; rc != nil {
+		if rc.Mode == "replay" {
+			fmt.Printf("- Replaying recordings from %s (upstream is not called)\n", rc.Dir)
+		} else {
+			fmt.Printf("- Recording upstream traffic to %s\n", rc.Dir)
+		}
+	}
+	if h := p.HAR; h != nil {
+		if h.File != "" {
+			fmt.Printf("- HAR capture: %s (last %d requests)\n", h.File, h.MaxEntries)
+		}
+		if h.Endpoint != "" {
+			fmt.Printf("- HAR capture: served at %s (last %d requests)\n", h.Endpoint, h.MaxEntries)
+		}
+	}
+	if rl := p.RateLimit; rl != nil {
+		fmt.Printf("- Rate limit: %d requests per %v by %s (%s)\n", rl.Limit, rl.WindowDuration, rl.Key, rl.Algorithm)
+	}
+	if p.Control != nil {
+		fmt.Println("- Control headers: enabled")
+	}
+	if p.UpstreamTLS != nil && p.UpstreamTLS.InsecureSkipVerify {
+		fmt.Println("- Upstream TLS: certificate verification disabled")
+	}
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// Event is one request through a proxy and the chaos applied to it
+type Event struct {
+	Proxy          string
+	Route          string // Empty for the proxy's own upstream
+	Method         string
+	Host           string
+	Path           string
+	Query          string
+	Client         string // Remote address of the client
+	RequestID      string // From X-Request-Id, to find the request on the client's side
+	Status         int    // What the client got, 0 when nothing was sent, e.g. a dropped request
+	UpstreamStatus int    // What the upstream answered, 0 when it never did
+	Start          time.Time
+	Duration       time.Duration
+	Decisions      []chaos.Decision // One per chaos layer the request passed
+}
+
+// Faults returns the names of every fault applied to the request
+func (e Event) Faults() []string {
+	var faults []string
+	for _, d := range e.Decisions {
+		faults = append(faults, d.Faults()...)
+	}
+	return faults
+}
+
+// InjectedLatency returns the latency added by chaos
+func (e Event) InjectedLatency() time.Duration {
+	var total time.Duration
+	for _, d := range e.Decisions {
+		total += d.Latency
+	}
+	return total
+}
+
+// Upstream returns how long the request took without the injected latency.
+// ok is false when the request never reached the upstream.
+func (e Event) Upstream() (d time.Duration, ok bool) {
+	for _, decision := range e.Decisions {
+		if decision.Drop || decision.ReturnError {
+			return 0, false
+		}
+	}
+	return max(e.Duration-e.InjectedLatency(), 0), true
+}
+
+// Subscribers of the whole process, every proxy publishes to them
+var (
+	mu     sync.RWMutex
+	subs   = make(map[int]func(Event))
+	nextID int
+)
+
+// Subscribe calls fn with every event until cancel is called. fn runs on the
+// request's goroutine once its response is done, so it has to be quick.
+func Subscribe(fn func(Event)) (cancel func()) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	id := nextID
+	nextID++
+	subs[id] = fn
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(subs, id)
+	}
+}
+
+// Subscribed reports whether anyone listens, so requests can skip the work
+func Subscribed() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(subs) > 0
+}
+
+func Publish(e Event) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, fn := range subs {
+		fn(e)
+	}
+}
@@ -0,0 +1,52 @@
+package events
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+func TestEvent_Faults(t *testing.T) {
+	e := Event{Decisions: []chaos.Decision{
+		{Latency: time.Second, Corrupt: true},
+		{Duplicates: 1},
+	}}
+
+	want := []string{chaos.FaultLatency, chaos.FaultCorrupt, chaos.FaultDuplicate}
+	if got := e.Faults(); !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestEvent_Upstream(t *testing.T) {
+	e := Event{Duration: 3 * time.Second, Decisions: []chaos.Decision{{Latency: time.Second}, {Latency: 500 * time.Millisecond}}}
+	if d, ok := e.Upstream(); !ok || d != 1500*time.Millisecond {
+		t.Errorf("Expected 1.5s upstream, got %v %v", d, ok)
+	}
+
+	e.Decisions = append(e.Decisions, chaos.Decision{ReturnError: true})
+	if _, ok := e.Upstream(); ok {
+		t.Error("Expected no upstream latency for an injected error")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	var got []string
+	cancel := Subscribe(func(e Event) { got = append(got, e.Path) })
+
+	if !Subscribed() {
+		t.Fatal("Expected a subscriber")
+	}
+	Publish(Event{Path: "/one"})
+	cancel()
+	Publish(Event{Path: "/two"})
+
+	if !slices.Equal(got, []string{"/one"}) {
+		t.Errorf("Expected only events before cancel, got %v", got)
+	}
+	if Subscribed() {
+		t.Error("Expected no subscribers after cancel")
+	}
+}
@@ -0,0 +1,377 @@
+package experiment
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+	"github.com/khizar-sudo/chaos-proxy/internal/events"
+	"github.com/khizar-sudo/chaos-proxy/internal/proxy"
+)
+
+const (
+	StatusIdle      = "idle" // Never started
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusAborted   = "aborted"
+)
+
+// Upstream latency samples kept per run, enough for hours of a game day
+const maxSamples = 100000
+
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrRunning    = errors.New("already running")
+	ErrNotRunning = errors.New("not running")
+)
+
+// Latency of the upstream as seen through the proxy, without the injected
+// latency
+type Latency struct {
+	Count int           `yaml:"count"`
+	Mean  time.Duration `yaml:"mean"`
+	P50   time.Duration `yaml:"p50"`
+	P95   time.Duration `yaml:"p95"`
+	P99   time.Duration `yaml:"p99"`
+	Max   time.Duration `yaml:"max"`
+}
+
+// Summary of one run of an experiment
+type Summary struct {
+	Name     string            `yaml:"name"`
+	Proxy    string            `yaml:"proxy"`
+	Status   string            `yaml:"status"`
+	Reason   string            `yaml:"reason,omitempty"` // Why it was aborted
+	Started  time.Time         `yaml:"started,omitempty"`
+	Ended    time.Time         `yaml:"ended,omitempty"`
+	Duration string            `yaml:"duration"` // Planned
+	Chaos    config.FileConfig `yaml:"chaos"`
+	File     string            `yaml:"file,omitempty"`   // Where the summary was written
+	Routes   []string          `yaml:"routes,omitempty"` // Routes of the proxy that keep their own chaos
+
+	Requests int            `yaml:"requests"`
+	Faulted  int            `yaml:"faulted"`  // Requests with at least one fault
+	Faults   map[string]int `yaml:"faults"`   // Requests per fault
+	Statuses map[string]int `yaml:"statuses"` // Responses per status code, "none" when nothing was sent
+	Upstream Latency        `yaml:"upstream_latency"`
+}
+
+// Runner runs the configured experiments on the proxies of a manager, at
+// most one per proxy at a time
+type Runner struct {
+	manager *proxy.Manager
+
+	mu      sync.Mutex
+	configs []config.ExperimentConfig
+	runs    map[string]*run // Latest run of each experiment
+	busy    map[string]*run // Running experiment of each proxy
+}
+
+type run struct {
+	cfg         config.ExperimentConfig
+	srv         *proxy.Server
+	previous    proxy.ChaosSnapshot // The proxy's chaos settings before the experiment
+	timer       *time.Timer
+	unsubscribe func()
+
+	mu      sync.Mutex
+	summary Summary
+	samples []time.Duration
+}
+
+func NewRunner(manager *proxy.Manager) *Runner {
+	return &Runner{
+		manager: manager,
+		runs:    make(map[string]*run),
+		busy:    make(map[string]*run),
+	}
+}
+
+// SetExperiments replaces the experiments that can be started. Running ones
+// keep going as they were started.
+func (r *Runner) SetExperiments(cfgs []config.ExperimentConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.configs = cfgs
+}
+
+// List returns the latest run of every experiment, in config order
+func (r *Runner) List() []Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summaries := make([]Summary, 0, len(r.configs))
+	for _, cfg := range r.configs {
+		summaries = append(summaries, r.latest(cfg))
+	}
+	return summaries
+}
+
+// Get returns the latest run of the experiment name, live while it runs
+func (r *Runner) Get(name string) (Summary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if run, ok := r.runs[name]; ok {
+		return run.summarize(), nil
+	}
+	cfg, ok := r.config(name)
+	if !ok {
+		return Summary{}, fmt.Errorf("experiment %q: %w", name, ErrNotFound)
+	}
+	return r.latest(cfg), nil
+}
+
+// Start applies the experiment's chaos to its proxy until its duration is up
+func (r *Runner) Start(name string) (Summary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, ok := r.config(name)
+	if !ok {
+		return Summary{}, fmt.Errorf("experiment %q: %w", name, ErrNotFound)
+	}
+	if other, ok := r.busy[cfg.Proxy]; ok {
+		return Summary{}, fmt.Errorf("experiment %q is %w on proxy %q", other.cfg.Name, ErrRunning, cfg.Proxy)
+	}
+	srv, ok := r.manager.Get(cfg.Proxy)
+	if !ok {
+		return Summary{}, fmt.Errorf("proxy %q: %w", cfg.Proxy, ErrNotFound)
+	}
+
+	// Routes have their own chaos instead of the proxy's, an experiment
+	// only reaches the requests that fall through to its upstream
+	proxyConfig := srv.Config()
+	var routes []string
+	for _, rc := range proxyConfig.Routes {
+		routes = append(routes, rc.Name)
+	}
+	if len(routes) > 0 && proxyConfig.UpstreamURL == nil && len(proxyConfig.Upstreams) == 0 {
+		return Summary{}, fmt.Errorf("experiment %q: every request to proxy %q goes to one of its routes, which keep their own chaos", name, cfg.Proxy)
+	}
+
+	previous := srv.SnapshotChaos()
+	if err := srv.SetChaos(cfg.Chaos); err != nil {
+		return Summary{}, fmt.Errorf("experiment %q: %w", name, err)
+	}
+
+	run := &run{
+		cfg:      cfg,
+		srv:      srv,
+		previous: previous,
+		summary: Summary{
+			Name:     cfg.Name,
+			Proxy:    cfg.Proxy,
+			Status:   StatusRunning,
+			Started:  time.Now(),
+			Duration: cfg.Duration,
+			Chaos:    cfg.Chaos,
+			Routes:   routes,
+			Faults:   make(map[string]int),
+			Statuses: make(map[string]int),
+		},
+	}
+	run.unsubscribe = events.Subscribe(func(e events.Event) {
+		if e.Proxy == cfg.Proxy {
+			run.add(e)
+		}
+	})
+	run.timer = time.AfterFunc(cfg.Length, func() {
+		r.finish(run, StatusCompleted, "")
+	})
+	r.runs[name] = run
+	r.busy[cfg.Proxy] = run
+
+	fmt.Printf("[EXPERIMENT] %s started on %s for %s\n", name, cfg.Proxy, cfg.Duration)
+	if len(routes) > 0 {
+		fmt.Printf("[EXPERIMENT] %s doesn't apply to routes %s, they keep their own chaos\n", name, strings.Join(routes, ", "))
+	}
+	return run.summarize(), nil
+}
+
+// Abort ends the experiment early, restoring its proxy right away
+func (r *Runner) Abort(name, reason string) (Summary, error) {
+	r.mu.Lock()
+	run, ok := r.runs[name]
+	_, exists := r.config(name)
+	r.mu.Unlock()
+	if !ok {
+		if !exists {
+			return Summary{}, fmt.Errorf("experiment %q: %w", name, ErrNotFound)
+		}
+		return Summary{}, fmt.Errorf("experiment %q: %w", name, ErrNotRunning)
+	}
+	return r.finish(run, StatusAborted, reason)
+}
+
+// AbortAll aborts every running experiment
+func (r *Runner) AbortAll(reason string) {
+	r.mu.Lock()
+	running := slices.Collect(maps.Values(r.busy))
+	r.mu.Unlock()
+
+	for _, run := range running {
+		r.finish(run, StatusAborted, reason)
+	}
+}
+
+// Shutdown aborts every running experiment, writing their summaries
+func (r *Runner) Shutdown() {
+	r.AbortAll("chaos-proxy shut down")
+}
+
+// finish ends run, puts the proxy's chaos settings back and writes the
+// summary
+func (r *Runner) finish(run *run, status, reason string) (Summary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.busy[run.cfg.Proxy] != run {
+		return Summary{}, fmt.Errorf("experiment %q: %w", run.cfg.Name, ErrNotRunning)
+	}
+	delete(r.busy, run.cfg.Proxy)
+	run.timer.Stop()
+	run.unsubscribe()
+
+	// A proxy reloaded from the config file meanwhile is already back to it
+	if current, ok := r.manager.Get(run.cfg.Proxy); ok && current == run.srv {
+		if err := run.srv.RestoreChaos(run.previous); err != nil {
+			slog.Error("failed to restore chaos settings", "proxy", run.cfg.Proxy, "error", err)
+		}
+	}
+
+	run.mu.Lock()
+	run.summary.Status = status
+	run.summary.Reason = reason
+	run.summary.Ended = time.Now()
+	file, err := run.write()
+	if err != nil {
+		slog.Error("failed to write experiment summary", "experiment", run.cfg.Name, "error", err)
+	} else {
+		run.summary.File = file
+	}
+	run.mu.Unlock()
+
+	if reason != "" {
+		fmt.Printf("[EXPERIMENT] %s %s (%s), %s is back to its chaos settings\n", run.cfg.Name, status, reason, run.cfg.Proxy)
+	} else {
+		fmt.Printf("[EXPERIMENT] %s %s, %s is back to its chaos settings\n", run.cfg.Name, status, run.cfg.Proxy)
+	}
+	return run.summarize(), nil
+}
+
+// config looks up the experiment name, r.mu must be held
+func (r *Runner) config(name string) (config.ExperimentConfig, bool) {
+	for _, cfg := range r.configs {
+		if cfg.Name == name {
+			return cfg, true
+		}
+	}
+	return config.ExperimentConfig{}, false
+}
+
+// latest returns the latest run of cfg, r.mu must be held
+func (r *Runner) latest(cfg config.ExperimentConfig) Summary {
+	if run, ok := r.runs[cfg.Name]; ok {
+		return run.summarize()
+	}
+	return Summary{
+		Name:     cfg.Name,
+		Proxy:    cfg.Proxy,
+		Status:   StatusIdle,
+		Duration: cfg.Duration,
+		Chaos:    cfg.Chaos,
+	}
+}
+
+func (run *run) add(e events.Event) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	s := &run.summary
+	s.Requests++
+	faults := e.Faults()
+	if len(faults) > 0 {
+		s.Faulted++
+	}
+	for _, fault := range slices.Compact(slices.Sorted(slices.Values(faults))) {
+		s.Faults[fault]++
+	}
+	status := "none"
+	if e.Status != 0 {
+		status = strconv.Itoa(e.Status)
+	}
+	s.Statuses[status]++
+
+	if d, ok := e.Upstream(); ok && len(run.samples) < maxSamples {
+		run.samples = append(run.samples, d)
+	}
+}
+
+// summarize returns a copy of the summary with the latency so far
+func (run *run) summarize() Summary {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	s := run.summary
+	s.Faults = maps.Clone(s.Faults)
+	s.Statuses = maps.Clone(s.Statuses)
+	s.Upstream = latency(run.samples)
+	return s
+}
+
+// write saves the summary in the experiment's summary dir, run.mu must be
+// held
+func (run *run) write() (string, error) {
+	s := run.summary
+	s.Upstream = latency(run.samples)
+
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(run.cfg.SummaryDir, 0o750); err != nil {
+		return "", err
+	}
+	file := filepath.Join(run.cfg.SummaryDir, fmt.Sprintf("%s-%s.yaml", filepath.Base(s.Name), s.Started.Format("20060102-150405")))
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+func latency(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	sorted := slices.Sorted(slices.Values(samples))
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	// Nearest rank
+	percentile := func(p int) time.Duration {
+		return sorted[(len(sorted)*p+99)/100-1]
+	}
+	return Latency{
+		Count: len(sorted),
+		Mean:  total / time.Duration(len(sorted)),
+		P50:   percentile(50),
+		P95:   percentile(95),
+		P99:   percentile(99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
@@ -0,0 +1,236 @@
+package experiment
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+	"github.com/khizar-sudo/chaos-proxy/internal/proxy"
+)
+
+// setup runs one proxy named api with a 1% error rate in front of a healthy
+// upstream, with an experiment named outage on it
+func setup(t *testing.T, length time.Duration) (*Runner, *proxy.Manager, string) {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	u, _ := url.Parse(upstream.URL)
+	manager := proxy.NewManager()
+	err := manager.Apply([]config.ProxyConfig{{
+		Name:        "api",
+		Mode:        config.ModeReverse,
+		Listen:      "127.0.0.1:0",
+		Upstream:    upstream.URL,
+		UpstreamURL: u,
+		Chaos:       config.FileConfig{ErrorRate: 1},
+	}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	t.Cleanup(manager.Shutdown)
+
+	dir := t.TempDir()
+	runner := NewRunner(manager)
+	runner.SetExperiments([]config.ExperimentConfig{{
+		Name:       "outage",
+		Proxy:      "api",
+		Duration:   length.String(),
+		Length:     length,
+		Chaos:      config.FileConfig{ErrorRate: 100, ErrorCode: 503},
+		SummaryDir: dir,
+	}})
+	t.Cleanup(runner.Shutdown)
+	return runner, manager, dir
+}
+
+func get(t *testing.T, manager *proxy.Manager) int {
+	t.Helper()
+	srv, _ := manager.Get("api")
+	resp, err := http.Get("http://" + srv.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRunner_Abort(t *testing.T) {
+	runner, manager, _ := setup(t, time.Hour)
+
+	if _, err := runner.Start("outage"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if code := get(t, manager); code != 503 {
+			t.Errorf("Expected the experiment's chaos, got %d", code)
+		}
+	}
+
+	// Events are published once the handler returned, after the client got its response
+	waitFor(t, runner, func(s Summary) bool { return s.Requests == 3 })
+
+	summary, err := runner.Abort("outage", "enough")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if summary.Status != StatusAborted || summary.Reason != "enough" {
+		t.Errorf("Expected aborted with the reason, got %s (%s)", summary.Status, summary.Reason)
+	}
+	if summary.Requests != 3 || summary.Faulted != 3 || summary.Faults["error"] != 3 || summary.Statuses["503"] != 3 {
+		t.Errorf("Unexpected counts: %+v", summary)
+	}
+
+	srv, _ := manager.Get("api")
+	if srv.Live().Chaos.ErrorRate != 1 {
+		t.Errorf("Expected the previous chaos settings back, got %+v", srv.Live().Chaos)
+	}
+
+	if _, err := runner.Abort("outage", ""); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning, got %v", err)
+	}
+}
+
+func TestRunner_Completes(t *testing.T) {
+	runner, manager, dir := setup(t, 50*time.Millisecond)
+
+	if _, err := runner.Start("outage"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := runner.Start("outage"); !errors.Is(err, ErrRunning) {
+		t.Errorf("Expected ErrRunning for a second start, got %v", err)
+	}
+
+	waitFor(t, runner, func(s Summary) bool { return s.Status == StatusCompleted })
+
+	if code := get(t, manager); code != 200 {
+		t.Errorf("Expected the previous chaos settings back, got %d", code)
+	}
+
+	summary, _ := runner.Get("outage")
+	data, err := os.ReadFile(summary.File)
+	if err != nil {
+		t.Fatalf("Expected the summary in %s, got: %v", dir, err)
+	}
+	var written Summary
+	if err := yaml.Unmarshal(data, &written); err != nil {
+		t.Fatalf("Expected a YAML summary, got: %v", err)
+	}
+	if written.Name != "outage" || written.Status != StatusCompleted || written.Chaos.ErrorCode != 503 {
+		t.Errorf("Unexpected summary: %+v", written)
+	}
+}
+
+func TestRunner_Unknown(t *testing.T) {
+	runner, _, _ := setup(t, time.Hour)
+
+	if _, err := runner.Start("nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if summary, err := runner.Get("outage"); err != nil || summary.Status != StatusIdle {
+		t.Errorf("Expected an idle experiment, got %v %v", summary.Status, err)
+	}
+}
+
+func TestRunner_Routes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	t.Cleanup(upstream.Close)
+	u, _ := url.Parse(upstream.URL)
+	users := config.RouteConfig{Name: "users", MatchConfig: config.MatchConfig{PathPrefix: "/users"}, Upstream: upstream.URL, UpstreamURL: u}
+
+	start := func(pc config.ProxyConfig) (*Runner, *proxy.Manager, Summary, error) {
+		manager := proxy.NewManager()
+		if err := manager.Apply([]config.ProxyConfig{pc}); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		t.Cleanup(manager.Shutdown)
+		runner := NewRunner(manager)
+		runner.SetExperiments([]config.ExperimentConfig{{
+			Name:       "outage",
+			Proxy:      "api",
+			Duration:   "1h",
+			Length:     time.Hour,
+			Chaos:      config.FileConfig{ErrorRate: 100, ErrorCode: 503},
+			SummaryDir: t.TempDir(),
+		}})
+		t.Cleanup(runner.Shutdown)
+		summary, err := runner.Start("outage")
+		return runner, manager, summary, err
+	}
+
+	// Nothing reaches the proxy's own chaos without an upstream of its own
+	_, _, _, err := start(config.ProxyConfig{Name: "api", Mode: config.ModeReverse, Listen: "127.0.0.1:0", Routes: []config.RouteConfig{users}})
+	if err == nil {
+		t.Error("Expected an error for a proxy with only routes")
+	}
+
+	_, manager, summary, err := start(config.ProxyConfig{
+		Name:        "api",
+		Mode:        config.ModeReverse,
+		Listen:      "127.0.0.1:0",
+		Upstream:    upstream.URL,
+		UpstreamURL: u,
+		Routes:      []config.RouteConfig{users},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(summary.Routes) != 1 || summary.Routes[0] != "users" {
+		t.Errorf("Expected the users route to be listed, got %v", summary.Routes)
+	}
+	if code := get(t, manager); code != 503 {
+		t.Errorf("Expected the experiment's chaos, got %d", code)
+	}
+	srv, _ := manager.Get("api")
+	resp, err := http.Get("http://" + srv.Addr().String() + "/users")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected the route to keep its own chaos, got %d", resp.StatusCode)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	var samples []time.Duration
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+
+	l := latency(samples)
+	if l.Count != 100 || l.P50 != 50*time.Millisecond || l.P99 != 99*time.Millisecond || l.Max != 100*time.Millisecond {
+		t.Errorf("Unexpected latency: %+v", l)
+	}
+	if l.Mean != 50500*time.Microsecond {
+		t.Errorf("Expected mean 50.5ms, got %v", l.Mean)
+	}
+}
+
+func waitFor(t *testing.T, runner *Runner, done func(Summary) bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		summary, _ := runner.Get("outage")
+		if done(summary) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the experiment, got %+v", summary)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,202 @@
+package forward
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/tlsutil"
+)
+
+// Proxy is an HTTP forward proxy. Clients reach it through HTTP_PROXY /
+// HTTPS_PROXY and send either absolute-form requests or CONNECT tunnels.
+type Proxy struct {
+	proxy  *httputil.ReverseProxy
+	dialer *net.Dialer
+	ca     *tlsutil.CA // Non-nil enables MITM of CONNECT tunnels
+}
+
+// New creates a forward proxy using transport for outgoing requests. When ca
+// is set, CONNECT tunnels are decrypted with certificates issued by it.
+func New(transport http.RoundTripper, ca *tlsutil.CA) *Proxy {
+	return &Proxy{
+		proxy: &httputil.ReverseProxy{
+			// Absolute-form requests already carry the target in the URL
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.Out.Header.Del("Proxy-Connection")
+				pr.Out.Header.Del("Proxy-Authorization")
+				pr.Out.Header.Set("User-Agent", "chaos-proxy/1.0")
+			},
+			// Before any chaos changes what the client gets
+			ModifyResponse: func(resp *http.Response) error {
+				if report := chaos.ReportFrom(resp.Request.Context()); report != nil {
+					report.SetUpstreamStatus(resp.StatusCode)
+				}
+				return nil
+			},
+			Transport: transport,
+		},
+		dialer: &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		ca:     ca,
+	}
+}
+
+// ServeHTTP forwards absolute-form requests and opens plain CONNECT tunnels
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "chaos-proxy is running in forward mode, requests must be in absolute form", http.StatusBadRequest)
+		return
+	}
+
+	fmt.Printf("[PROXY] %s %s\n", r.Method, r.URL.String())
+	p.proxy.ServeHTTP(w, r)
+}
+
+// Handler returns the entry point for the listener. next is the full
+// middleware chain ending in p. With MITM enabled, CONNECT requests bypass
+// next and every request decrypted from the tunnel is sent through it
+// instead, so HTTP-level chaos applies inside TLS.
+func (p *Proxy) Handler(next http.Handler) http.Handler {
+	if p.ca == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			p.intercept(w, r, next)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	fmt.Printf("[PROXY] CONNECT %s\n", r.Host)
+
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to reach %s: %v", r.Host, err), http.StatusBadGateway)
+		return
+	}
+
+	client, err := hijack(w)
+	if err != nil {
+		upstream.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go pipe(upstream, client, &wg)
+	go pipe(client, upstream, &wg)
+	wg.Wait()
+}
+
+func (p *Proxy) intercept(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	host := r.Host
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname = host
+	}
+
+	client, err := hijack(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tlsConn := tls.Server(client, &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: p.ca.GetCertificate([]string{hostname}),
+	})
+	if err := tlsConn.HandshakeContext(r.Context()); err != nil {
+		slog.Warn("MITM handshake failed", "host", host, "error", err)
+		tlsConn.Close()
+		return
+	}
+
+	// Requests inside the tunnel are origin-form, point them back at the target
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Scheme = "https"
+		r.URL.Host = host
+		next.ServeHTTP(w, r)
+	})
+
+	ln := newConnListener(tlsConn)
+	srv := &http.Server{
+		Handler:           inner,
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				ln.Close()
+			}
+		},
+	}
+	_ = srv.Serve(ln)
+}
+
+// hijack takes over the client connection and confirms the tunnel
+func hijack(w http.ResponseWriter) (net.Conn, error) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("connection does not support tunnelling: %w", err)
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func pipe(dst, src net.Conn, wg *sync.WaitGroup) {
+	defer wg.Done()
+	_, _ = io.Copy(dst, src)
+	// Unblock the other direction once this side is done
+	_ = dst.Close()
+	_ = src.Close()
+}
+
+// connListener hands out a single connection, then blocks until closed
+type connListener struct {
+	conn   net.Conn
+	once   sync.Once
+	served chan struct{}
+	closed chan struct{}
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	l := &connListener{conn: conn, served: make(chan struct{}, 1), closed: make(chan struct{})}
+	l.served <- struct{}{}
+	return l
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.served:
+		return l.conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
@@ -0,0 +1,166 @@
+package forward
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/match"
+	"github.com/khizar-sudo/chaos-proxy/internal/middleware"
+	"github.com/khizar-sudo/chaos-proxy/internal/tlsutil"
+)
+
+func newUpstream(t *testing.T, tlsEnabled bool) *httptest.Server {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+		w.Write([]byte("hello from upstream"))
+	})
+
+	var srv *httptest.Server
+	if tlsEnabled {
+		srv = httptest.NewTLSServer(handler)
+	} else {
+		srv = httptest.NewServer(handler)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// clientVia returns a client that sends all traffic through proxyURL
+func clientVia(proxyURL string, roots *x509.CertPool) *http.Client {
+	u, _ := url.Parse(proxyURL)
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(u),
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	return string(body)
+}
+
+func TestProxy_AbsoluteForm(t *testing.T) {
+	upstream := newUpstream(t, false)
+
+	p := New(http.DefaultTransport, nil)
+	proxySrv := httptest.NewServer(p.Handler(middleware.LoggingMiddleware(p)))
+	defer proxySrv.Close()
+
+	resp, err := clientVia(proxySrv.URL, nil).Get(upstream.URL + "/users/1")
+	if err != nil {
+		t.Fatalf("Expected request to succeed, got: %v", err)
+	}
+
+	if body := readBody(t, resp); body != "hello from upstream" {
+		t.Errorf("Expected upstream body, got '%s'", body)
+	}
+	if got := resp.Header.Get("X-Upstream-Path"); got != "/users/1" {
+		t.Errorf("Expected upstream to see /users/1, got '%s'", got)
+	}
+}
+
+func TestProxy_RejectsOriginForm(t *testing.T) {
+	p := New(http.DefaultTransport, nil)
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestProxy_ConnectTunnel(t *testing.T) {
+	upstream := newUpstream(t, true)
+	roots := x509.NewCertPool()
+	roots.AddCert(upstream.Certificate())
+
+	p := New(http.DefaultTransport, nil)
+	// Logging and chaos wrap the writer, hijacking has to see through them
+	engine := chaos.NewEngine(chaos.ChaosConfig{})
+	proxySrv := httptest.NewServer(p.Handler(middleware.LoggingMiddleware(middleware.ChaosMiddleware(p, engine))))
+	defer proxySrv.Close()
+
+	resp, err := clientVia(proxySrv.URL, roots).Get(upstream.URL + "/secure")
+	if err != nil {
+		t.Fatalf("Expected tunnelled request to succeed, got: %v", err)
+	}
+	if body := readBody(t, resp); body != "hello from upstream" {
+		t.Errorf("Expected upstream body, got '%s'", body)
+	}
+}
+
+func TestProxy_ConnectChaosByHost(t *testing.T) {
+	upstream := newUpstream(t, true)
+	roots := x509.NewCertPool()
+	roots.AddCert(upstream.Certificate())
+
+	engine := chaos.NewEngine(chaos.ChaosConfig{
+		Rules: []chaos.Rule{{Name: "local", Matcher: match.Matcher{Host: "127.0.0.1"}, Config: chaos.ChaosConfig{ErrorRate: 100, ErrorCode: 503}}},
+	})
+
+	p := New(http.DefaultTransport, nil)
+	proxySrv := httptest.NewServer(p.Handler(middleware.ChaosMiddleware(p, engine)))
+	defer proxySrv.Close()
+
+	// Without MITM the error is returned for the CONNECT itself
+	if _, err := clientVia(proxySrv.URL, roots).Get(upstream.URL); err == nil {
+		t.Error("Expected CONNECT to fail with injected error")
+	}
+}
+
+func TestProxy_MITM(t *testing.T) {
+	upstream := newUpstream(t, true)
+
+	ca, _, err := tlsutil.NewCA()
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	// The proxy itself has to trust the upstream's test certificate
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = upstream.Client().Transport.(*http.Transport).TLSClientConfig
+
+	engine := chaos.NewEngine(chaos.ChaosConfig{
+		Rules: []chaos.Rule{{Name: "broken", Matcher: match.Matcher{PathPrefix: "/broken"}, Config: chaos.ChaosConfig{ErrorRate: 100, ErrorCode: 418}}},
+	})
+
+	p := New(transport, ca)
+	proxySrv := httptest.NewServer(p.Handler(middleware.ChaosMiddleware(p, engine)))
+	defer proxySrv.Close()
+
+	// Clients trust the local CA instead of the upstream certificate
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	client := clientVia(proxySrv.URL, roots)
+
+	resp, err := client.Get(upstream.URL + "/ok")
+	if err != nil {
+		t.Fatalf("Expected intercepted request to succeed, got: %v", err)
+	}
+	if body := readBody(t, resp); body != "hello from upstream" {
+		t.Errorf("Expected upstream body, got '%s'", body)
+	}
+
+	resp, err = client.Get(upstream.URL + "/broken")
+	if err != nil {
+		t.Fatalf("Expected intercepted request to succeed, got: %v", err)
+	}
+	readBody(t, resp)
+	if resp.StatusCode != 418 {
+		t.Errorf("Expected chaos error 418 inside the tunnel, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,158 @@
+package har
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// HAR 1.2 document, see http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"` // Total milliseconds
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+
+	// Custom field, what chaos did to this request
+	Chaos []Decision `json:"_chaos"`
+}
+
+type Request struct {
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	HTTPVersion string    `json:"httpVersion"`
+	Cookies     []Cookie  `json:"cookies"`
+	Headers     []NV      `json:"headers"`
+	QueryString []NV      `json:"queryString"`
+	PostData    *PostData `json:"postData,omitempty"`
+	HeadersSize int       `json:"headersSize"`
+	BodySize    int64     `json:"bodySize"`
+}
+
+type Response struct {
+	Status      int      `json:"status"`
+	StatusText  string   `json:"statusText"`
+	HTTPVersion string   `json:"httpVersion"`
+	Cookies     []Cookie `json:"cookies"`
+	Headers     []NV     `json:"headers"`
+	Content     Content  `json:"content"`
+	RedirectURL string   `json:"redirectURL"`
+	HeadersSize int      `json:"headersSize"`
+	BodySize    int64    `json:"bodySize"`
+}
+
+// NV is a name/value pair, used for headers and query parameters
+type NV struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Cookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type Content struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Timings in milliseconds, -1 for phases the proxy can't observe
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// Decision is a chaos.Decision as it appears in the _chaos field
+type Decision struct {
+	Rule            string  `json:"rule,omitempty"`
+	Drop            bool    `json:"drop"`
+	Error           bool    `json:"error"`
+	ErrorCode       int     `json:"errorCode,omitempty"`
+	LatencyMs       float64 `json:"latencyMs"`
+	Corrupt         bool    `json:"corrupt"`
+	CorruptStrategy string  `json:"corruptStrategy,omitempty"`
+	PostFailure     string  `json:"postFailure,omitempty"`
+}
+
+func newDecision(d chaos.Decision) Decision {
+	return Decision{
+		Rule:            d.Rule,
+		Drop:            d.Drop,
+		Error:           d.ReturnError,
+		ErrorCode:       d.ErrorCode,
+		LatencyMs:       millis(d.Latency),
+		Corrupt:         d.Corrupt,
+		CorruptStrategy: d.CorruptStrategy,
+		PostFailure:     d.PostFailure,
+	}
+}
+
+func headers(h http.Header) []NV {
+	return pairs(h)
+}
+
+func queryString(q url.Values) []NV {
+	return pairs(q)
+}
+
+// pairs flattens a multi-value map, sorted by name so entries are stable
+func pairs(m map[string][]string) []NV {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nvs := []NV{}
+	for _, name := range names {
+		for _, v := range m[name] {
+			nvs = append(nvs, NV{Name: name, Value: v})
+		}
+	}
+	return nvs
+}
+
+func cookies(cs []*http.Cookie) []Cookie {
+	out := []Cookie{}
+	for _, c := range cs {
+		out = append(out, Cookie{Name: c.Name, Value: c.Value})
+	}
+	return out
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
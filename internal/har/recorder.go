@@ -0,0 +1,279 @@
+package har
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// Bodies are cut off at this size when captured
+const maxBodySize = 1 << 20
+
+// How long new entries wait before the file is rewritten
+const flushDelay = time.Second
+
+type Options struct {
+	File       string // Rewritten shortly after new entries arrive, empty to disable
+	Bodies     bool   // Capture request and response bodies
+	MaxEntries int    // Oldest entries are dropped beyond this
+}
+
+// Recorder captures proxied traffic as HAR entries annotated with the chaos
+// decisions applied to each request
+type Recorder struct {
+	opts Options
+
+	mu      sync.Mutex
+	entries []Entry
+	pending *time.Timer
+}
+
+func NewRecorder(opts Options) *Recorder {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	return &Recorder{opts: opts}
+}
+
+// Middleware records every request passing through next
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		report := chaos.ReportFrom(r.Context())
+		if report == nil {
+			var ctx context.Context
+			ctx, report = chaos.WithReport(r.Context())
+			r = r.WithContext(ctx)
+		}
+
+		var reqBody []byte
+		if rec.opts.Bodies && r.Body != nil && r.Body != http.NoBody {
+			// Read up to the limit and put it back in front of the rest
+			reqBody, _ = io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+		}
+
+		cw := &captureWriter{ResponseWriter: w, bodies: rec.opts.Bodies}
+		next.ServeHTTP(cw, r)
+		end := time.Now()
+
+		rec.add(rec.entry(r, reqBody, cw, report, start, end))
+	})
+}
+
+// ServeHTTP returns the captured HAR, DELETE clears it
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="chaos-proxy.har"`)
+		json.NewEncoder(w).Encode(rec.HAR())
+	case http.MethodDelete:
+		rec.mu.Lock()
+		rec.entries = nil
+		rec.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HAR returns a snapshot of everything captured so far
+func (rec *Recorder) HAR() HAR {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return HAR{Log: Log{
+		Version: "1.2",
+		Creator: Creator{Name: "chaos-proxy", Version: "1.0"},
+		Entries: append([]Entry{}, rec.entries...),
+	}}
+}
+
+// Close writes any pending entries to the file
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	if rec.pending != nil {
+		rec.pending.Stop()
+		rec.pending = nil
+	}
+	rec.mu.Unlock()
+
+	if rec.opts.File == "" {
+		return nil
+	}
+	return rec.writeFile()
+}
+
+func (rec *Recorder) add(e Entry) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.entries = append(rec.entries, e)
+	if len(rec.entries) > rec.opts.MaxEntries {
+		rec.entries = rec.entries[len(rec.entries)-rec.opts.MaxEntries:]
+	}
+
+	// Batch writes instead of rewriting the file for every request
+	if rec.opts.File != "" && rec.pending == nil {
+		rec.pending = time.AfterFunc(flushDelay, func() {
+			rec.mu.Lock()
+			rec.pending = nil
+			rec.mu.Unlock()
+
+			if err := rec.writeFile(); err != nil {
+				slog.Error("failed to write HAR file", "file", rec.opts.File, "error", err)
+			}
+		})
+	}
+}
+
+func (rec *Recorder) writeFile() error {
+	data, err := json.MarshalIndent(rec.HAR(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename, so readers never see half a file
+	tmp, err := os.CreateTemp(filepath.Dir(rec.opts.File), ".har-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), rec.opts.File)
+}
+
+func (rec *Recorder) entry(r *http.Request, reqBody []byte, cw *captureWriter, report *chaos.Report, start, end time.Time) Entry {
+	firstByte := cw.firstByte
+	if firstByte.IsZero() {
+		firstByte = end
+	}
+
+	e := Entry{
+		StartedDateTime: start,
+		Time:            millis(end.Sub(start)),
+		Request: Request{
+			Method:      r.Method,
+			URL:         requestURL(r),
+			HTTPVersion: r.Proto,
+			Cookies:     cookies(r.Cookies()),
+			Headers:     headers(r.Header),
+			QueryString: queryString(r.URL.Query()),
+			HeadersSize: -1,
+			BodySize:    r.ContentLength,
+		},
+		Response: Response{
+			Status:      cw.status,
+			StatusText:  http.StatusText(cw.status),
+			HTTPVersion: r.Proto,
+			Cookies:     cookies((&http.Response{Header: cw.Header()}).Cookies()),
+			Headers:     headers(cw.Header()),
+			Content: Content{
+				Size:     cw.size,
+				MimeType: cw.Header().Get("Content-Type"),
+			},
+			HeadersSize: -1,
+			BodySize:    cw.size,
+		},
+		Timings: Timings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			SSL:     -1,
+			Wait:    millis(firstByte.Sub(start)),
+			Receive: millis(end.Sub(firstByte)),
+		},
+		Chaos: []Decision{},
+	}
+
+	if rec.opts.Bodies {
+		if len(reqBody) > 0 {
+			e.Request.PostData = &PostData{MimeType: r.Header.Get("Content-Type"), Text: string(reqBody)}
+		}
+		body := cw.body.Bytes()
+		if utf8.Valid(body) {
+			e.Response.Content.Text = string(body)
+		} else {
+			e.Response.Content.Text = base64.StdEncoding.EncodeToString(body)
+			e.Response.Content.Encoding = "base64"
+		}
+	}
+
+	for _, d := range report.Decisions() {
+		e.Chaos = append(e.Chaos, newDecision(d))
+	}
+	return e
+}
+
+// requestURL rebuilds the URL the client asked for. Forward proxy requests
+// already carry an absolute URL.
+func requestURL(r *http.Request) string {
+	if r.URL.IsAbs() {
+		return r.URL.String()
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// captureWriter records status, size, time to first byte and optionally the
+// body of what was sent to the client
+type captureWriter struct {
+	http.ResponseWriter
+	bodies    bool
+	status    int
+	size      int64
+	firstByte time.Time
+	body      bytes.Buffer
+}
+
+func (cw *captureWriter) WriteHeader(code int) {
+	if cw.status == 0 {
+		cw.status = code
+		cw.firstByte = time.Now()
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+		cw.firstByte = time.Now()
+	}
+	n, err := cw.ResponseWriter.Write(b)
+	cw.size += int64(n)
+	if cw.bodies && cw.body.Len() < maxBodySize {
+		cw.body.Write(b[:min(n, maxBodySize-cw.body.Len())])
+	}
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,157 @@
+package har
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/middleware"
+)
+
+func upstream() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": "hello from upstream"}`))
+	})
+}
+
+func TestRecorder_CapturesEntry(t *testing.T) {
+	rec := NewRecorder(Options{Bodies: true})
+	handler := rec.Middleware(upstream())
+
+	req := httptest.NewRequest("POST", "http://api.example.com/users?id=1", strings.NewReader("payload"))
+	req.Header.Set("Content-Type", "text/plain")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := rec.HAR().Log.Entries
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+
+	if e.Request.Method != "POST" || e.Request.URL != "http://api.example.com/users?id=1" {
+		t.Errorf("Unexpected request: %s %s", e.Request.Method, e.Request.URL)
+	}
+	if len(e.Request.QueryString) != 1 || e.Request.QueryString[0] != (NV{Name: "id", Value: "1"}) {
+		t.Errorf("Unexpected query string: %+v", e.Request.QueryString)
+	}
+	if e.Request.PostData == nil || e.Request.PostData.Text != "payload" {
+		t.Errorf("Expected request body to be captured, got %+v", e.Request.PostData)
+	}
+	if e.Response.Status != 200 || e.Response.Content.MimeType != "application/json" {
+		t.Errorf("Unexpected response: %d %s", e.Response.Status, e.Response.Content.MimeType)
+	}
+	if e.Response.Content.Text != `{"message": "hello from upstream"}` {
+		t.Errorf("Expected response body to be captured, got '%s'", e.Response.Content.Text)
+	}
+	if len(e.Chaos) != 0 {
+		t.Errorf("Expected no chaos decisions without chaos middleware, got %+v", e.Chaos)
+	}
+}
+
+func TestRecorder_NoBodies(t *testing.T) {
+	rec := NewRecorder(Options{})
+	rec.Middleware(upstream()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+
+	e := rec.HAR().Log.Entries[0]
+	if e.Request.PostData != nil || e.Response.Content.Text != "" {
+		t.Errorf("Expected bodies to be left out, got %+v / '%s'", e.Request.PostData, e.Response.Content.Text)
+	}
+	if e.Response.Content.Size == 0 {
+		t.Error("Expected response size to be recorded anyway")
+	}
+}
+
+func TestRecorder_ChaosAnnotations(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{
+		CorruptRate: 100,
+		Rules:       []chaos.Rule{{Name: "broken", Config: chaos.ChaosConfig{ErrorRate: 100, ErrorCode: 503}}},
+	})
+	rec := NewRecorder(Options{})
+	rec.Middleware(middleware.ChaosMiddleware(upstream(), engine)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	e := rec.HAR().Log.Entries[0]
+	if len(e.Chaos) != 1 {
+		t.Fatalf("Expected 1 chaos decision, got %d", len(e.Chaos))
+	}
+	d := e.Chaos[0]
+	if d.Rule != "broken" || !d.Error || d.ErrorCode != 503 {
+		t.Errorf("Unexpected decision: %+v", d)
+	}
+	if e.Response.Status != 503 {
+		t.Errorf("Expected status 503, got %d", e.Response.Status)
+	}
+}
+
+func TestRecorder_CorruptStrategy(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{CorruptRate: 100})
+	rec := NewRecorder(Options{})
+	rec.Middleware(middleware.ChaosMiddleware(upstream(), engine)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	d := rec.HAR().Log.Entries[0].Chaos[0]
+	if !d.Corrupt || d.CorruptStrategy == "" {
+		t.Errorf("Expected corruption strategy to be recorded, got %+v", d)
+	}
+}
+
+func TestRecorder_MaxEntries(t *testing.T) {
+	rec := NewRecorder(Options{MaxEntries: 2})
+	handler := rec.Middleware(upstream())
+	for _, path := range []string{"/1", "/2", "/3"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	entries := rec.HAR().Log.Entries
+	if len(entries) != 2 || !strings.HasSuffix(entries[0].Request.URL, "/2") {
+		t.Errorf("Expected the last 2 entries to be kept, got %d", len(entries))
+	}
+}
+
+func TestRecorder_WritesFileOnClose(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "capture.har")
+	rec := NewRecorder(Options{File: file})
+	rec.Middleware(upstream()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Expected HAR file, got: %v", err)
+	}
+	var doc HAR
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v", err)
+	}
+	if doc.Log.Version != "1.2" || len(doc.Log.Entries) != 1 {
+		t.Errorf("Unexpected HAR: version %s, %d entries", doc.Log.Version, len(doc.Log.Entries))
+	}
+}
+
+func TestRecorder_Endpoint(t *testing.T) {
+	rec := NewRecorder(Options{})
+	rec.Middleware(upstream()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	w := httptest.NewRecorder()
+	rec.ServeHTTP(w, httptest.NewRequest("GET", "/_chaos/har", nil))
+
+	var doc HAR
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v", err)
+	}
+	if len(doc.Log.Entries) != 1 {
+		t.Errorf("Expected 1 entry, got %d", len(doc.Log.Entries))
+	}
+
+	w = httptest.NewRecorder()
+	rec.ServeHTTP(w, httptest.NewRequest("DELETE", "/_chaos/har", nil))
+	if w.Code != http.StatusNoContent || len(rec.HAR().Log.Entries) != 0 {
+		t.Errorf("Expected DELETE to clear the capture, got %d with %d entries", w.Code, len(rec.HAR().Log.Entries))
+	}
+}
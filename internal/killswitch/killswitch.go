@@ -0,0 +1,93 @@
+package killswitch
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// The kill switch turns off all chaos in the process. While it's engaged
+// requests pass through untouched, whatever the config says. It's engaged by
+// hand (signal or admin API) or by the sentinel file existing.
+var (
+	manual atomic.Bool
+	file   atomic.Bool
+)
+
+// Engaged reports whether chaos is off
+func Engaged() bool {
+	return manual.Load() || file.Load()
+}
+
+// Set engages or releases the switch by hand. The sentinel file keeps chaos
+// off regardless.
+func Set(engaged bool) {
+	if manual.Swap(engaged) != engaged {
+		logState("manual")
+	}
+}
+
+// Toggle flips the manual switch and returns whether it's now engaged
+func Toggle() bool {
+	for {
+		old := manual.Load()
+		if manual.CompareAndSwap(old, !old) {
+			logState("manual")
+			return !old
+		}
+	}
+}
+
+// State returns what engaged the switch
+func State() (byHand, byFile bool) {
+	return manual.Load(), file.Load()
+}
+
+// WatchFile engages the switch while path exists, checking every interval.
+// Call stop to stop watching, which releases the file's hold on the switch.
+func WatchFile(path string, interval time.Duration) (stop func()) {
+	check := func() {
+		_, err := os.Stat(path)
+		exists := err == nil
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("failed to check kill switch file", "file", path, "error", err)
+			return
+		}
+		if file.Swap(exists) != exists {
+			logState("file " + path)
+		}
+	}
+	check()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				check()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		if file.Swap(false) {
+			logState("file " + path)
+		}
+	}
+}
+
+func logState(by string) {
+	if Engaged() {
+		slog.Warn("kill switch engaged, all chaos is off", "by", by)
+	} else {
+		slog.Info("kill switch released, chaos is back on", "by", by)
+	}
+}
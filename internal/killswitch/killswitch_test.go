@@ -0,0 +1,88 @@
+package killswitch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSet(t *testing.T) {
+	t.Cleanup(func() { Set(false) })
+
+	Set(true)
+	if !Engaged() {
+		t.Error("Expected the switch to be engaged")
+	}
+	Set(false)
+	if Engaged() {
+		t.Error("Expected the switch to be released")
+	}
+}
+
+func TestToggle(t *testing.T) {
+	t.Cleanup(func() { Set(false) })
+
+	if !Toggle() || !Engaged() {
+		t.Error("Expected the first toggle to engage the switch")
+	}
+	if Toggle() || Engaged() {
+		t.Error("Expected the second toggle to release the switch")
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chaos-off")
+	stop := WatchFile(path, 10*time.Millisecond)
+	defer stop()
+
+	if Engaged() {
+		t.Fatal("Expected the switch to be released without the file")
+	}
+
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	waitFor(t, true)
+	if byHand, byFile := State(); byHand || !byFile {
+		t.Errorf("Expected the file to engage the switch, got manual=%v file=%v", byHand, byFile)
+	}
+
+	// Releasing by hand doesn't override the file
+	Set(false)
+	if !Engaged() {
+		t.Error("Expected the file to keep the switch engaged")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	waitFor(t, false)
+}
+
+func TestWatchFile_Stop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chaos-off")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	stop := WatchFile(path, time.Hour)
+	if !Engaged() {
+		t.Fatal("Expected the file to be checked right away")
+	}
+	stop()
+	if Engaged() {
+		t.Error("Expected stopping the watch to release the switch")
+	}
+}
+
+func waitFor(t *testing.T, engaged bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for Engaged() != engaged {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected engaged to become %v", engaged)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,71 @@
+package match
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Matcher selects requests by target host, path prefix, method and header.
+// Empty fields match everything.
+type Matcher struct {
+	Host        string // Exact host or "*.example.com", port is ignored
+	PathPrefix  string
+	Method      string
+	Header      string // Header that must be present...
+	HeaderValue string // ...with this value, when set
+}
+
+// Matches reports whether the request satisfies every field that is set
+func (m Matcher) Matches(r *http.Request) bool {
+	if m.Method != "" && !strings.EqualFold(m.Method, r.Method) {
+		return false
+	}
+	if m.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, m.PathPrefix) {
+		return false
+	}
+	if m.Host != "" && !matchHost(m.Host, RequestHost(r)) {
+		return false
+	}
+	if m.Header != "" {
+		values, ok := r.Header[http.CanonicalHeaderKey(m.Header)]
+		if !ok {
+			return false
+		}
+		if m.HeaderValue != "" && !containsValue(values, m.HeaderValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestHost returns the target host without port, lowercased. For
+// forward-proxied and CONNECT requests this is the host the client wants to
+// reach.
+func RequestHost(r *http.Request) string {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+func matchHost(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return host == suffix || strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+func containsValue(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
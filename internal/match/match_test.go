@@ -0,0 +1,61 @@
+package match
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMatcher_Matches(t *testing.T) {
+	tests := []struct {
+		name   string
+		m      Matcher
+		method string
+		url    string
+		host   string
+		want   bool
+	}{
+		{"empty matcher matches everything", Matcher{}, "GET", "http://example.com/a", "", true},
+		{"exact host", Matcher{Host: "api.example.com"}, "GET", "http://api.example.com/", "", true},
+		{"host is case insensitive", Matcher{Host: "API.example.com"}, "GET", "http://api.example.com/", "", true},
+		{"host ignores port", Matcher{Host: "api.example.com"}, "GET", "http://api.example.com:8443/", "", true},
+		{"different host", Matcher{Host: "api.example.com"}, "GET", "http://example.com/", "", false},
+		{"wildcard subdomain", Matcher{Host: "*.example.com"}, "GET", "http://a.b.example.com/", "", true},
+		{"wildcard apex", Matcher{Host: "*.example.com"}, "GET", "http://example.com/", "", true},
+		{"wildcard lookalike", Matcher{Host: "*.example.com"}, "GET", "http://badexample.com/", "", false},
+		{"connect authority", Matcher{Host: "api.stripe.com"}, "CONNECT", "http://x/", "api.stripe.com:443", true},
+		{"path prefix", Matcher{PathPrefix: "/v1"}, "GET", "http://example.com/v1/users", "", true},
+		{"path prefix miss", Matcher{PathPrefix: "/v1"}, "GET", "http://example.com/v2/users", "", false},
+		{"method", Matcher{Method: "post"}, "POST", "http://example.com/", "", true},
+		{"method miss", Matcher{Method: "POST"}, "GET", "http://example.com/", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if got := tt.m.Matches(req); got != tt.want {
+				t.Errorf("Expected Matches to be %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMatcher_Header(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Service", "users")
+
+	if !(Matcher{Header: "x-service"}).Matches(req) {
+		t.Error("Expected header presence to match")
+	}
+	if !(Matcher{Header: "X-Service", HeaderValue: "users"}).Matches(req) {
+		t.Error("Expected header value to match")
+	}
+	if (Matcher{Header: "X-Service", HeaderValue: "orders"}).Matches(req) {
+		t.Error("Expected different header value not to match")
+	}
+	if (Matcher{Header: "X-Tenant"}).Matches(req) {
+		t.Error("Expected missing header not to match")
+	}
+}
@@ -0,0 +1,244 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/events"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
+)
+
+// Upper bounds of the latency histograms in seconds, Prometheus' defaults
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// The metrics of the whole process. They live as long as it does, so
+// counters don't restart when the admin API or a proxy is reloaded.
+var (
+	requests = newVec("chaos_proxy_requests_total", "counter",
+		"Requests handled, by proxy, route and status (none when nothing was sent).",
+		"proxy", "route", "status")
+	faults = newVec("chaos_proxy_faults_total", "counter",
+		"Faults injected, by proxy, route, fault, response status and corruption strategy.",
+		"proxy", "route", "fault", "status", "corrupt_strategy")
+	injectedLatency = newHistogramVec("chaos_proxy_injected_latency_seconds",
+		"Latency added by chaos per request, 0 for requests without any.",
+		"proxy", "route")
+	upstreamLatency = newHistogramVec("chaos_proxy_upstream_latency_seconds",
+		"Time spent on requests without the injected latency, for requests that reached the upstream.",
+		"proxy", "route")
+	inFlight = newVec("chaos_proxy_requests_in_flight", "gauge",
+		"Requests being handled right now.",
+		"proxy")
+	reloads = newVec("chaos_proxy_config_reloads_total", "counter",
+		"Config file reloads, by result.",
+		"result")
+)
+
+// Collect keeps the request metrics up to date until stop is called
+func Collect() (stop func()) {
+	return events.Subscribe(Observe)
+}
+
+// Observe counts one finished request
+func Observe(e events.Event) {
+	status := "none"
+	if e.Status != 0 {
+		status = strconv.Itoa(e.Status)
+	}
+	requests.add(1, e.Proxy, e.Route, status)
+
+	for _, d := range e.Decisions {
+		for _, fault := range d.Faults() {
+			strategy := ""
+			if fault == chaos.FaultCorrupt {
+				strategy = d.CorruptStrategy
+			}
+			faults.add(1, e.Proxy, e.Route, fault, status, strategy)
+		}
+	}
+
+	injectedLatency.observe(e.InjectedLatency(), e.Proxy, e.Route)
+	if d, ok := e.Upstream(); ok {
+		upstreamLatency.observe(d, e.Proxy, e.Route)
+	}
+}
+
+// RequestStarted counts a request of proxy as in flight until done is called
+func RequestStarted(proxy string) (done func()) {
+	inFlight.add(1, proxy)
+	return func() { inFlight.add(-1, proxy) }
+}
+
+// ConfigReloaded counts a reload of the config file, ok is false when it
+// failed and the previous configuration was kept
+func ConfigReloaded(ok bool) {
+	result := "success"
+	if !ok {
+		result = "failure"
+	}
+	reloads.add(1, result)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// Write writes every metric in the Prometheus text format
+func Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	requests.write(out)
+	faults.write(out)
+	injectedLatency.write(out)
+	upstreamLatency.write(out)
+	inFlight.write(out)
+	reloads.write(out)
+
+	engaged := 0
+	if killswitch.Engaged() {
+		engaged = 1
+	}
+	fmt.Fprint(out, "# HELP chaos_proxy_kill_switch_engaged Whether the kill switch has turned all chaos off.\n")
+	fmt.Fprint(out, "# TYPE chaos_proxy_kill_switch_engaged gauge\n")
+	fmt.Fprintf(out, "chaos_proxy_kill_switch_engaged %d\n", engaged)
+
+	return out.Flush()
+}
+
+// vec is a counter or gauge with labels
+type vec struct {
+	name, kind, help string
+	labels           []string
+
+	mu     sync.Mutex
+	values map[string]float64 // By label values, see key
+}
+
+func newVec(name, kind, help string, labels ...string) *vec {
+	return &vec{name: name, kind: kind, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (v *vec) add(n float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[key(values)] += n
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	for _, k := range slices.Sorted(maps.Keys(v.values)) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, labelSet(v.labels, k, "", ""), formatFloat(v.values[k]))
+	}
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// histogramVec is a histogram of durations with labels
+type histogramVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, values: make(map[string]*histogram)}
+}
+
+func (v *histogramVec) observe(d time.Duration, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	k := key(values)
+	h, ok := v.values[k]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		v.values[k] = h
+	}
+	seconds := d.Seconds()
+	if i, _ := slices.BinarySearch(latencyBuckets, seconds); i < len(latencyBuckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func (v *histogramVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name)
+	for _, k := range slices.Sorted(maps.Keys(v.values)) {
+		h := v.values[k]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, labelSet(v.labels, k, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, labelSet(v.labels, k, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, labelSet(v.labels, k, "", ""), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, labelSet(v.labels, k, "", ""), h.count)
+	}
+}
+
+// key joins label values into a map key. \xff can't be in valid UTF-8.
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// labelSet renders {name="value",...} for the label values in k, with an
+// extra label when extraName isn't empty
+func labelSet(names []string, k, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	if len(names) > 0 {
+		for i, value := range strings.Split(k, "\xff") {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s=\"%s\"", names[i], escape(value))
+		}
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extraName, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escape(value string) string {
+	return escaper.Replace(value)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
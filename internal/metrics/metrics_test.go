@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/events"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	var out strings.Builder
+	if err := Write(&out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	return out.String()
+}
+
+func TestObserve(t *testing.T) {
+	Observe(events.Event{
+		Proxy:    "observe",
+		Route:    "users",
+		Status:   200,
+		Duration: 300 * time.Millisecond,
+		Decisions: []chaos.Decision{
+			{Latency: 250 * time.Millisecond, Corrupt: true, CorruptStrategy: "truncate"},
+		},
+	})
+	Observe(events.Event{Proxy: "observe", Decisions: []chaos.Decision{{Drop: true}}})
+
+	out := scrape(t)
+	for _, want := range []string{
+		`chaos_proxy_requests_total{proxy="observe",route="users",status="200"} 1`,
+		`chaos_proxy_requests_total{proxy="observe",route="",status="none"} 1`,
+		`chaos_proxy_faults_total{proxy="observe",route="users",fault="latency",status="200",corrupt_strategy=""} 1`,
+		`chaos_proxy_faults_total{proxy="observe",route="users",fault="corrupt",status="200",corrupt_strategy="truncate"} 1`,
+		`chaos_proxy_faults_total{proxy="observe",route="",fault="drop",status="none",corrupt_strategy=""} 1`,
+		`chaos_proxy_injected_latency_seconds_bucket{proxy="observe",route="users",le="0.1"} 0`,
+		`chaos_proxy_injected_latency_seconds_bucket{proxy="observe",route="users",le="0.25"} 1`,
+		`chaos_proxy_injected_latency_seconds_sum{proxy="observe",route="users"} 0.25`,
+		`chaos_proxy_upstream_latency_seconds_bucket{proxy="observe",route="users",le="0.05"} 1`,
+		`chaos_proxy_upstream_latency_seconds_count{proxy="observe",route="users"} 1`,
+		"# TYPE chaos_proxy_faults_total counter",
+		"# TYPE chaos_proxy_upstream_latency_seconds histogram",
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+
+	// A dropped request never reached the upstream
+	if strings.Contains(out, `chaos_proxy_upstream_latency_seconds_count{proxy="observe",route=""}`) {
+		t.Errorf("Expected no upstream latency for the dropped request, got:\n%s", out)
+	}
+}
+
+func TestRequestStarted(t *testing.T) {
+	done := RequestStarted("inflight")
+	if out := scrape(t); !strings.Contains(out, `chaos_proxy_requests_in_flight{proxy="inflight"} 1`+"\n") {
+		t.Errorf("Expected 1 request in flight, got:\n%s", out)
+	}
+	done()
+	if out := scrape(t); !strings.Contains(out, `chaos_proxy_requests_in_flight{proxy="inflight"} 0`+"\n") {
+		t.Errorf("Expected no request in flight, got:\n%s", out)
+	}
+}
+
+func TestConfigReloaded(t *testing.T) {
+	ConfigReloaded(true)
+	ConfigReloaded(false)
+	ConfigReloaded(false)
+
+	out := scrape(t)
+	if !strings.Contains(out, `chaos_proxy_config_reloads_total{result="success"} 1`+"\n") {
+		t.Errorf("Expected 1 successful reload, got:\n%s", out)
+	}
+	if !strings.Contains(out, `chaos_proxy_config_reloads_total{result="failure"} 2`+"\n") {
+		t.Errorf("Expected 2 failed reloads, got:\n%s", out)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	got := labelSet([]string{"path"}, key([]string{"a\"b\\c\nd"}), "", "")
+	if want := `{path="a\"b\\c\nd"}`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
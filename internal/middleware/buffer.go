@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// responseBuffer holds a complete response without sending anything, for
+// faults that decide what the client gets after the upstream is done
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header)}
+}
+
+func (rb *responseBuffer) Header() http.Header {
+	return rb.header
+}
+
+func (rb *responseBuffer) WriteHeader(statusCode int) {
+	if rb.status == 0 {
+		rb.status = statusCode
+	}
+}
+
+func (rb *responseBuffer) Write(b []byte) (int, error) {
+	if rb.status == 0 {
+		rb.status = http.StatusOK
+	}
+	return rb.body.Write(b)
+}
+
+// statusCode returns the status sent by the handler, 200 if it sent nothing
+func (rb *responseBuffer) statusCode() int {
+	if rb.status == 0 {
+		return http.StatusOK
+	}
+	return rb.status
+}
+
+// writeTo sends the buffered response to w
+func (rb *responseBuffer) writeTo(w http.ResponseWriter) {
+	writeResponse(w, rb.statusCode(), rb.header, rb.body.Bytes())
+}
+
+func writeResponse(w http.ResponseWriter, status int, header http.Header, body []byte) {
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// discardWriter throws the response away, only the status is kept
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (dw *discardWriter) Header() http.Header {
+	if dw.header == nil {
+		dw.header = make(http.Header)
+	}
+	return dw.header
+}
+
+func (dw *discardWriter) WriteHeader(code int) {
+	if dw.status == 0 {
+		dw.status = code
+	}
+}
+
+func (dw *discardWriter) Write(b []byte) (int, error) {
+	if dw.status == 0 {
+		dw.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (dw *discardWriter) statusCode() int {
+	if dw.status == 0 {
+		return http.StatusOK
+	}
+	return dw.status
+}
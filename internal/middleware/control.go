@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// ControlHeaders lets requests carrying secret in X-Chaos-Secret pick their
+// own chaos with the X-Chaos-* headers. The headers are removed before the
+// request goes any further, so they never reach the upstream.
+func ControlHeaders(secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		override, err := chaos.ParseOverride(r.Header)
+		given := r.Header.Get(chaos.HeaderSecret)
+		if override == nil && err == nil && given == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		for _, h := range []string{chaos.HeaderSecret, chaos.HeaderForce, chaos.HeaderLatency, chaos.HeaderSkip} {
+			r.Header.Del(h)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+			http.Error(w, "invalid chaos control secret", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if override != nil {
+			fmt.Printf("[CHAOS] Control headers override chaos for %s %s\n", r.Method, r.URL.Path)
+			r = r.WithContext(chaos.WithOverride(r.Context(), override))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
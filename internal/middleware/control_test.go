@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// headerUpstream answers with the X-Chaos-* headers it received
+func headerUpstream() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, h := range []string{chaos.HeaderSecret, chaos.HeaderForce, chaos.HeaderLatency, chaos.HeaderSkip} {
+			if v := r.Header.Get(h); v != "" {
+				w.Write([]byte(h + ": " + v + "\n"))
+			}
+		}
+	})
+}
+
+func controlled(handler http.Handler, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestControlHeaders_Force(t *testing.T) {
+	handler := ControlHeaders("secret", ChaosMiddleware(headerUpstream(), chaos.NewEngine(chaos.ChaosConfig{})))
+
+	rec := controlled(handler, map[string]string{chaos.HeaderSecret: "secret", chaos.HeaderForce: "error=503"})
+	if rec.Code != 503 {
+		t.Errorf("Expected forced status 503, got %d", rec.Code)
+	}
+}
+
+func TestControlHeaders_Skip(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{ErrorRate: 100})
+	handler := ControlHeaders("secret", ChaosMiddleware(headerUpstream(), engine))
+
+	rec := controlled(handler, map[string]string{chaos.HeaderSecret: "secret", chaos.HeaderSkip: "true"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected no chaos, got %d", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected control headers to be stripped, upstream got '%s'", rec.Body.String())
+	}
+}
+
+func TestControlHeaders_OnlyOuterLayer(t *testing.T) {
+	// Like a route in front of a pool backend
+	inner := ChaosMiddleware(headerUpstream(), chaos.NewEngine(chaos.ChaosConfig{ErrorRate: 100, ErrorCode: 502}))
+	handler := ControlHeaders("secret", ChaosMiddleware(inner, chaos.NewEngine(chaos.ChaosConfig{})))
+
+	rec := controlled(handler, map[string]string{chaos.HeaderSecret: "secret", chaos.HeaderLatency: "1ms"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the inner layer to add no chaos, got %d", rec.Code)
+	}
+}
+
+func TestControlHeaders_Secret(t *testing.T) {
+	handler := ControlHeaders("secret", ChaosMiddleware(headerUpstream(), chaos.NewEngine(chaos.ChaosConfig{})))
+
+	if rec := controlled(handler, map[string]string{chaos.HeaderForce: "error"}); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 without the secret, got %d", rec.Code)
+	}
+	if rec := controlled(handler, map[string]string{chaos.HeaderSecret: "guess", chaos.HeaderForce: "error"}); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 with a wrong secret, got %d", rec.Code)
+	}
+	if rec := controlled(handler, map[string]string{chaos.HeaderSecret: "secret", chaos.HeaderForce: "meteor"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown fault, got %d", rec.Code)
+	}
+	if rec := controlled(handler, nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected requests without control headers to pass, got %d", rec.Code)
+	}
+}
@@ -31,7 +31,12 @@ func (cw *corruptingWriter) WriteHeader(statusCode int) {
 	cw.statusCode = statusCode
 }
 
-func (cw *corruptingWriter) flush() {
+func (cw *corruptingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// flush writes the corrupted response and returns the strategy used
+func (cw *corruptingWriter) flush() string {
 	body := cw.buf.Bytes()
 
 	// Randomly select corruption strategy
@@ -70,6 +75,7 @@ func (cw *corruptingWriter) flush() {
 	if _, err := cw.ResponseWriter.Write(corrupted); err != nil {
 		fmt.Printf("[CHAOS] Error writing corrupted response: %v\n", err)
 	}
+	return strategyName
 }
 
 // Strategy 1: Random Byte Corruption
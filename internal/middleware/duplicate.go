@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+const (
+	maxDuplicateBody = 10 << 20         // Bigger bodies aren't buffered, the request is sent once
+	duplicateTimeout = 60 * time.Second // Copies outlive the client's request, but not forever
+)
+
+// duplicate sends extra copies of r to next in the background and returns r
+// with a body that can still be read. The copies' responses are discarded,
+// the client only ever sees the response to r.
+func duplicate(r *http.Request, next http.Handler, decsion chaos.Decision) *http.Request {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxDuplicateBody+1))
+		if err != nil {
+			fmt.Printf("[CHAOS] Not duplicating request, failed to read body: %v\n", err)
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			return r
+		}
+		if len(body) > maxDuplicateBody {
+			fmt.Println("[CHAOS] Not duplicating request, body too large")
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			return r
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if decsion.DuplicateDelay > 0 {
+		fmt.Printf("[CHAOS] Duplicating request: %d extra copies, %v apart\n", decsion.Duplicates, decsion.DuplicateDelay)
+	} else {
+		fmt.Printf("[CHAOS] Duplicating request: %d extra concurrent copies\n", decsion.Duplicates)
+	}
+
+	for i := 1; i <= decsion.Duplicates; i++ {
+		// The copies' answers aren't the client's, they stay out of its report
+		ctx, cancel := context.WithTimeout(chaos.WithoutReport(context.WithoutCancel(r.Context())), duplicateTimeout+time.Duration(i)*decsion.DuplicateDelay)
+		dup := r.Clone(ctx)
+		if body != nil {
+			dup.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		go func(delay time.Duration) {
+			defer cancel()
+			defer func() {
+				// Nobody is serving this copy, so a panic would take the proxy down.
+				// ReverseProxy panics with ErrAbortHandler when the upstream breaks
+				// off a response.
+				if err := recover(); err != nil && err != http.ErrAbortHandler {
+					fmt.Printf("[CHAOS] Duplicate request failed: %v\n", err)
+				}
+			}()
+			if delay > 0 {
+				time.Sleep(delay)
+			}
+			next.ServeHTTP(&discardWriter{}, dup)
+		}(time.Duration(i) * decsion.DuplicateDelay)
+	}
+
+	return r
+}
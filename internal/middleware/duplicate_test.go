@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// recordingUpstream sends every request body it receives on bodies
+func recordingUpstream(bodies chan<- string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		w.Write([]byte("ok"))
+	})
+}
+
+func receive(t *testing.T, bodies <-chan string) string {
+	t.Helper()
+	select {
+	case body := <-bodies:
+		return body
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the upstream to receive a request")
+		return ""
+	}
+}
+
+func TestChaosMiddleware_Duplicate(t *testing.T) {
+	bodies := make(chan string, 10)
+	engine := chaos.NewEngine(chaos.ChaosConfig{DuplicateRate: 100, DuplicateCount: 3})
+	handler := ChaosMiddleware(recordingUpstream(bodies), engine)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id": 1}`)))
+
+	if rec.Body.String() != "ok" {
+		t.Errorf("Expected the client to get a single response, got '%s'", rec.Body.String())
+	}
+
+	for i := 0; i < 3; i++ {
+		if body := receive(t, bodies); body != `{"id": 1}` {
+			t.Errorf("Expected every delivery to carry the body, got '%s'", body)
+		}
+	}
+
+	select {
+	case <-bodies:
+		t.Error("Expected exactly 3 deliveries")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestChaosMiddleware_DuplicateSkipsConnect(t *testing.T) {
+	bodies := make(chan string, 10)
+	engine := chaos.NewEngine(chaos.ChaosConfig{DuplicateRate: 100, DuplicateCount: 3})
+	handler := ChaosMiddleware(recordingUpstream(bodies), engine)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("CONNECT", "http://example.com:443", nil))
+
+	receive(t, bodies)
+	select {
+	case <-bodies:
+		t.Error("Expected a CONNECT to be sent once")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestChaosMiddleware_DuplicateDelay(t *testing.T) {
+	bodies := make(chan string, 10)
+	engine := chaos.NewEngine(chaos.ChaosConfig{DuplicateRate: 100, DuplicateDelay: 100 * time.Millisecond})
+	handler := ChaosMiddleware(recordingUpstream(bodies), engine)
+
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/orders", strings.NewReader("payload")))
+	receive(t, bodies)
+
+	if elapsed := time.Since(start); elapsed > 90*time.Millisecond {
+		t.Errorf("Expected the client not to wait for the copy, took %v", elapsed)
+	}
+
+	receive(t, bodies)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the copy to arrive after the delay, took %v", elapsed)
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/events"
+	"github.com/khizar-sudo/chaos-proxy/internal/metrics"
+)
+
+// EventsMiddleware publishes an event for every request through next, with
+// the chaos decisions applied to it on the way. CONNECT tunnels aren't
+// published, they have no status and last as long as the connection.
+func EventsMiddleware(proxy string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !events.Subscribed() || r.Method == http.MethodConnect {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		defer metrics.RequestStarted(proxy)()
+
+		start := time.Now()
+		ctx, report := chaos.WithReport(r.Context())
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.statusCode
+		if status == 0 && recorder.written > 0 {
+			status = http.StatusOK
+		}
+		events.Publish(events.Event{
+			Proxy:          proxy,
+			Route:          report.Route(),
+			Method:         r.Method,
+			Host:           r.Host,
+			Path:           r.URL.Path,
+			Query:          r.URL.RawQuery,
+			Client:         r.RemoteAddr,
+			RequestID:      r.Header.Get("X-Request-Id"),
+			Status:         status,
+			UpstreamStatus: report.UpstreamStatus(),
+			Start:          start,
+			Duration:       time.Since(start),
+			Decisions:      report.Decisions(),
+		})
+	})
+}
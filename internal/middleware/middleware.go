@@ -6,11 +6,30 @@ import (
 	"time"
 
 	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
 )
 
 func ChaosMiddleware(next http.Handler, engine *chaos.Engine) http.Handler {
+	// Responses seen so far, for stale responses
+	hist := newHistory()
+	// Requests held back for reordering
+	held := newReorderer()
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		decsion := engine.Decide(r)
+		if killswitch.Engaged() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var decsion chaos.Decision
+		if override := chaos.OverrideFrom(r.Context()); override != nil {
+			decsion = override.Take()
+		} else {
+			decsion = engine.Decide(r)
+		}
+		if report := chaos.ReportFrom(r.Context()); report != nil {
+			defer func() { report.Add(decsion) }()
+		}
 
 		fmt.Println()
 		defer fmt.Println()
@@ -41,15 +60,47 @@ func ChaosMiddleware(next http.Handler, engine *chaos.Engine) http.Handler {
 			return
 		}
 
-		// Corrupt the body of the request
-		if decsion.Corrupt {
+		// Hold the request until its batch is released, the rest of the batch
+		// waits until this response went out
+		if decsion.Reorder && r.Method != http.MethodConnect {
+			done, ok := held.hold(r.Context(), decsion)
+			if !ok {
+				fmt.Println("[CHAOS] Request cancelled while held for reordering")
+				return
+			}
+			defer done()
+		}
+
+		// Let the upstream do the work, then fail anyway
+		if decsion.PostFailure != "" && r.Method != http.MethodConnect {
+			failAfterUpstream(w, r, next, hist, decsion)
+			return
+		}
+
+		// Corrupt the body of the request. Tunnels carry no response body to corrupt.
+		if decsion.Corrupt && r.Method != http.MethodConnect {
 			fmt.Println("[CHAOS] Corrupting response")
 			cw := newCorruptionWriter(w)
-			next.ServeHTTP(cw, r)
-			cw.flush()
+			serve(cw, r, next, hist, decsion)
+			decsion.CorruptStrategy = cw.flush()
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		serve(w, r, next, hist, decsion)
 	})
 }
+
+// serve calls next, applying the faults that need the upstream's response
+func serve(w http.ResponseWriter, r *http.Request, next http.Handler, hist *history, decsion chaos.Decision) {
+	// A duplicated tunnel would dial the target again for nothing
+	if decsion.Duplicates > 0 && r.Method != http.MethodConnect {
+		r = duplicate(r, next, decsion)
+	}
+
+	if decsion.StaleVersions > 0 || decsion.StaleAge > 0 {
+		serveTracked(w, r, next, hist, decsion)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
 )
 
 func TestChaosMiddleware_NoChaos(t *testing.T) {
@@ -222,3 +223,49 @@ func TestChaosMiddleware_ErrorWithLatency(t *testing.T) {
 		t.Errorf("Expected status code %d, got %d", errorCode, rec.Code)
 	}
 }
+
+func TestChaosMiddleware_Report(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{
+		ErrorRate: 100,
+		ErrorCode: 503,
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("success"))
+	})
+
+	ctx, report := chaos.WithReport(context.Background())
+	req := httptest.NewRequest("GET", "http://example.com", nil).WithContext(ctx)
+	ChaosMiddleware(handler, engine).ServeHTTP(httptest.NewRecorder(), req)
+
+	decisions := report.Decisions()
+	if len(decisions) != 1 {
+		t.Fatalf("Expected 1 decision, got %d", len(decisions))
+	}
+	if !decisions[0].ReturnError || decisions[0].ErrorCode != 503 {
+		t.Errorf("Expected the error decision to be reported, got %+v", decisions[0])
+	}
+}
+
+func TestChaosMiddleware_KillSwitch(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{ErrorRate: 100, ErrorCode: 503})
+	handler := ChaosMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("success"))
+	}), engine)
+
+	killswitch.Set(true)
+	t.Cleanup(func() { killswitch.Set(false) })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "success" {
+		t.Errorf("Expected the request to pass through, got %d '%s'", rec.Code, rec.Body.String())
+	}
+
+	killswitch.Set(false)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com", nil))
+	if rec.Code != 503 {
+		t.Errorf("Expected chaos once released, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// failAfterUpstream lets the upstream handle r in full, throws its response
+// away and fails the request towards the client instead. The upstream has
+// committed whatever the request did, the client can't know that.
+func failAfterUpstream(w http.ResponseWriter, r *http.Request, next http.Handler, hist *history, decsion chaos.Decision) {
+	dw := &discardWriter{}
+	serve(dw, r, next, hist, decsion)
+
+	switch decsion.PostFailure {
+	case chaos.PostFailureTimeout:
+		fmt.Printf("[CHAOS] Upstream answered %d, withholding the response\n", dw.statusCode())
+		<-r.Context().Done()
+	case chaos.PostFailureReset:
+		fmt.Printf("[CHAOS] Upstream answered %d, resetting the connection\n", dw.statusCode())
+		resetConn(w)
+	default:
+		fmt.Printf("[CHAOS] Upstream answered %d, injecting error: %d\n", dw.statusCode(), decsion.ErrorCode)
+		http.Error(w, fmt.Sprintf("Chaos injected error %d", decsion.ErrorCode), decsion.ErrorCode)
+	}
+}
+
+// resetConn aborts the client connection with an RST. Connections that can't
+// be hijacked, like HTTP/2 streams, are aborted by the server instead.
+func resetConn(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		// Linger 0 sends an RST instead of a FIN
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
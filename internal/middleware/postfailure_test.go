@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+func TestChaosMiddleware_PostFailureError(t *testing.T) {
+	bodies := make(chan string, 1)
+	engine := chaos.NewEngine(chaos.ChaosConfig{PostFailureRate: 100, ErrorCode: 504})
+	handler := ChaosMiddleware(recordingUpstream(bodies), engine)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id": 1}`)))
+
+	if body := receive(t, bodies); body != `{"id": 1}` {
+		t.Errorf("Expected the upstream to get the request, got '%s'", body)
+	}
+	if rec.Code != 504 {
+		t.Errorf("Expected status 504, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "ok") {
+		t.Error("Expected the upstream's response to be discarded")
+	}
+}
+
+func TestChaosMiddleware_PostFailureTimeout(t *testing.T) {
+	bodies := make(chan string, 1)
+	engine := chaos.NewEngine(chaos.ChaosConfig{PostFailureRate: 100, PostFailureMode: chaos.PostFailureTimeout})
+	handler := ChaosMiddleware(recordingUpstream(bodies), engine)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/orders", nil).WithContext(ctx))
+
+	receive(t, bodies)
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected no response, got '%s'", rec.Body.String())
+	}
+}
+
+func TestChaosMiddleware_PostFailureReset(t *testing.T) {
+	bodies := make(chan string, 1)
+	engine := chaos.NewEngine(chaos.ChaosConfig{PostFailureRate: 100, PostFailureMode: chaos.PostFailureReset})
+	srv := httptest.NewServer(ChaosMiddleware(recordingUpstream(bodies), engine))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("POST", srv.URL+"/orders", strings.NewReader("payload"))
+	req.GetBody = nil // Like a proxied request, so the client doesn't retry
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("Expected the connection to be reset, got status %d", resp.StatusCode)
+	}
+
+	if body := receive(t, bodies); body != "payload" {
+		t.Errorf("Expected the upstream to get the request, got '%s'", body)
+	}
+}
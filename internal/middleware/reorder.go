@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math/rand" // #nosec G404 - math/rand is sufficient for chaos testing, cryptographic randomness not required
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// waiter is one held request
+type waiter struct {
+	release   chan struct{} // Closed when it's this request's turn
+	done      chan struct{} // Closed once its response went out
+	cancelled <-chan struct{}
+}
+
+// batch collects held requests until its window ends or it's full
+type batch struct {
+	order   string
+	waiters []*waiter
+}
+
+// reorderer holds requests back and releases them in batches, one at a time
+// and in a different order than they arrived. Every rule gets its own batch.
+type reorderer struct {
+	mu      sync.Mutex
+	batches map[string]*batch
+}
+
+func newReorderer() *reorderer {
+	return &reorderer{batches: make(map[string]*batch)}
+}
+
+// hold blocks until the request's turn comes. The caller must call done once
+// the response went out, the next request waits for it. ok is false when the
+// client gave up while waiting.
+func (ro *reorderer) hold(ctx context.Context, decsion chaos.Decision) (done func(), ok bool) {
+	w := &waiter{
+		release:   make(chan struct{}),
+		done:      make(chan struct{}),
+		cancelled: ctx.Done(),
+	}
+
+	ro.mu.Lock()
+	b, open := ro.batches[decsion.Rule]
+	if !open {
+		b = &batch{order: decsion.ReorderOrder}
+		ro.batches[decsion.Rule] = b
+		time.AfterFunc(decsion.ReorderWindow, func() { ro.flush(decsion.Rule, b) })
+	}
+	b.waiters = append(b.waiters, w)
+	held := len(b.waiters)
+	ro.mu.Unlock()
+
+	fmt.Printf("[CHAOS] Holding request for reordering (%d held)\n", held)
+	if decsion.ReorderCount > 0 && held >= decsion.ReorderCount {
+		ro.flush(decsion.Rule, b)
+	}
+
+	select {
+	case <-w.release:
+		return func() { close(w.done) }, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// flush releases b unless that already happened
+func (ro *reorderer) flush(key string, b *batch) {
+	ro.mu.Lock()
+	if ro.batches[key] != b {
+		ro.mu.Unlock()
+		return
+	}
+	delete(ro.batches, key)
+	waiters := b.waiters
+	ro.mu.Unlock()
+
+	if b.order == chaos.ReorderReverse {
+		slices.Reverse(waiters)
+	} else {
+		rand.Shuffle(len(waiters), func(i, j int) { // #nosec G404 - chaos testing doesn't need crypto rand
+			waiters[i], waiters[j] = waiters[j], waiters[i]
+		})
+	}
+	fmt.Printf("[CHAOS] Releasing %d held requests in %s order\n", len(waiters), b.order)
+
+	// One at a time, so the upstream and the clients see the new order
+	go func() {
+		for _, w := range waiters {
+			close(w.release)
+			select {
+			case <-w.done:
+			case <-w.cancelled:
+			}
+		}
+	}()
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// waitHeld blocks until n requests wait in rule's batch
+func waitHeld(t *testing.T, ro *reorderer, rule string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		ro.mu.Lock()
+		b := ro.batches[rule]
+		held := b != nil && len(b.waiters) == n
+		ro.mu.Unlock()
+		if held {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d held requests", n)
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestReorderer_Reverse(t *testing.T) {
+	ro := newReorderer()
+	decsion := chaos.Decision{Reorder: true, ReorderCount: 3, ReorderWindow: time.Minute, ReorderOrder: chaos.ReorderReverse}
+
+	released := make(chan string, 3)
+	var wg sync.WaitGroup
+	for i, name := range []string{"1", "2", "3"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, ok := ro.hold(context.Background(), decsion)
+			if !ok {
+				t.Errorf("Expected request %s to be released", name)
+				return
+			}
+			released <- name
+			done()
+		}()
+		// The next one arrives once this one is held, the last one fills the batch
+		if i < 2 {
+			waitHeld(t, ro, "", i+1)
+		}
+	}
+	wg.Wait()
+	close(released)
+
+	var order []string
+	for name := range released {
+		order = append(order, name)
+	}
+	if len(order) != 3 || order[0] != "3" || order[1] != "2" || order[2] != "1" {
+		t.Errorf("Expected the requests to be released 3, 2, 1, got %v", order)
+	}
+}
+
+func TestChaosMiddleware_ReorderWindow(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{ReorderRate: 100, ReorderWindow: 50 * time.Millisecond})
+	handler := ChaosMiddleware(versionedUpstream(), engine)
+
+	start := time.Now()
+	rec := get(handler, "GET")
+
+	if rec.Body.String() != "v1" {
+		t.Errorf("Expected the request to be released, got '%s'", rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the request to be held for the window, took %v", elapsed)
+	}
+}
+
+func TestChaosMiddleware_ReorderCancelled(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{ReorderRate: 100, ReorderWindow: time.Minute})
+	handler := ChaosMiddleware(versionedUpstream(), engine)
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	if resp, err := client.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Error("Expected the request to be held past the client's timeout")
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+const (
+	maxStaleVersions = 16   // Versions kept per request key
+	maxStaleKeys     = 1000 // Request keys tracked, the oldest is forgotten first
+)
+
+// version is one distinct response seen for a request key
+type version struct {
+	status int
+	header http.Header
+	body   []byte
+	seen   time.Time // When this version was first returned by the upstream
+}
+
+// history remembers the last few distinct responses per request key, newest
+// first, so earlier ones can be served as stale responses
+type history struct {
+	mu       sync.Mutex
+	versions map[string][]version
+	keys     []string
+}
+
+func newHistory() *history {
+	return &history{versions: make(map[string][]version)}
+}
+
+// add records v as the current version of key. A response identical to the
+// current version doesn't count as a new one.
+func (h *history) add(key string, v version) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	versions, known := h.versions[key]
+	if len(versions) > 0 && versions[0].status == v.status && bytes.Equal(versions[0].body, v.body) {
+		return
+	}
+
+	if !known {
+		if len(h.keys) >= maxStaleKeys {
+			delete(h.versions, h.keys[0])
+			h.keys = h.keys[1:]
+		}
+		h.keys = append(h.keys, key)
+	}
+
+	versions = append([]version{v}, versions...)
+	if len(versions) > maxStaleVersions {
+		versions = versions[:maxStaleVersions]
+	}
+	h.versions[key] = versions
+}
+
+// stale returns the version from n versions before the current one, or with
+// n == 0 the newest version that is at least maxAge old
+func (h *history) stale(key string, n int, maxAge time.Duration, now time.Time) (version, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	versions := h.versions[key]
+	if n > 0 {
+		if n < len(versions) {
+			return versions[n], true
+		}
+		return version{}, false
+	}
+
+	for _, v := range versions[min(1, len(versions)):] {
+		if now.Sub(v.seen) >= maxAge {
+			return v, true
+		}
+	}
+	return version{}, false
+}
+
+func staleKey(r *http.Request) string {
+	return r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+// serveTracked calls next, remembers its response and sends either that or,
+// when the decision says so, an earlier version. Only GET responses are
+// tracked, like a cache would.
+func serveTracked(w http.ResponseWriter, r *http.Request, next http.Handler, hist *history, decision chaos.Decision) {
+	if r.Method != http.MethodGet {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	buf := newResponseBuffer()
+	next.ServeHTTP(buf, r)
+
+	key := staleKey(r)
+	now := time.Now()
+	hist.add(key, version{
+		status: buf.statusCode(),
+		header: buf.header.Clone(),
+		body:   bytes.Clone(buf.body.Bytes()),
+		seen:   now,
+	})
+
+	if !decision.Stale {
+		buf.writeTo(w)
+		return
+	}
+
+	old, ok := hist.stale(key, decision.StaleVersions, decision.StaleAge, now)
+	if !ok {
+		fmt.Println("[CHAOS] No stale response available yet, serving current one")
+		buf.writeTo(w)
+		return
+	}
+
+	fmt.Printf("[CHAOS] Serving stale response (%v old)\n", now.Sub(old.seen).Round(time.Millisecond))
+	header := old.header
+	if decision.StaleKeepHeaders {
+		header = buf.header
+	}
+	header = header.Clone()
+	header.Del("Content-Length")
+	writeResponse(w, old.status, header, old.body)
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// versionedUpstream returns a new version of its body on every request
+func versionedUpstream() http.Handler {
+	n := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.Header().Set("X-Version", fmt.Sprint(n))
+		w.Write([]byte(fmt.Sprintf("v%d", n)))
+	})
+}
+
+func get(handler http.Handler, method string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, "http://example.com/price", nil))
+	return rec
+}
+
+func TestChaosMiddleware_StaleVersionsAgo(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{StaleRate: 100, StaleVersions: 2})
+	handler := ChaosMiddleware(versionedUpstream(), engine)
+
+	// Nothing older to serve yet
+	if body := get(handler, "GET").Body.String(); body != "v1" {
+		t.Errorf("Expected current response without history, got '%s'", body)
+	}
+	get(handler, "GET")
+
+	rec := get(handler, "GET")
+	if body := rec.Body.String(); body != "v1" {
+		t.Errorf("Expected response from 2 versions ago, got '%s'", body)
+	}
+	if v := rec.Header().Get("X-Version"); v != "1" {
+		t.Errorf("Expected the stale response's headers, got X-Version %s", v)
+	}
+}
+
+func TestChaosMiddleware_StaleKeepHeaders(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{StaleRate: 100, StaleVersions: 1, StaleKeepHeaders: true})
+	handler := ChaosMiddleware(versionedUpstream(), engine)
+
+	get(handler, "GET")
+	rec := get(handler, "GET")
+
+	if body := rec.Body.String(); body != "v1" {
+		t.Errorf("Expected stale body, got '%s'", body)
+	}
+	if v := rec.Header().Get("X-Version"); v != "2" {
+		t.Errorf("Expected current headers, got X-Version %s", v)
+	}
+}
+
+func TestChaosMiddleware_StaleAge(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{StaleRate: 100, StaleAge: 50 * time.Millisecond})
+	handler := ChaosMiddleware(versionedUpstream(), engine)
+
+	get(handler, "GET")
+	// v1 isn't old enough yet
+	if body := get(handler, "GET").Body.String(); body != "v2" {
+		t.Errorf("Expected current response, got '%s'", body)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if body := get(handler, "GET").Body.String(); body != "v2" {
+		t.Errorf("Expected newest response old enough, got '%s'", body)
+	}
+}
+
+func TestChaosMiddleware_StaleOnlyGET(t *testing.T) {
+	engine := chaos.NewEngine(chaos.ChaosConfig{StaleRate: 100})
+	handler := ChaosMiddleware(versionedUpstream(), engine)
+
+	get(handler, "POST")
+	if body := get(handler, "POST").Body.String(); body != "v2" {
+		t.Errorf("Expected POST responses to never be stale, got '%s'", body)
+	}
+}
+
+func TestHistory_IdenticalResponsesAreOneVersion(t *testing.T) {
+	hist := newHistory()
+	now := time.Now()
+	hist.add("k", version{status: 200, body: []byte("a"), seen: now})
+	hist.add("k", version{status: 200, body: []byte("b"), seen: now})
+	hist.add("k", version{status: 200, body: []byte("b"), seen: now})
+
+	v, ok := hist.stale("k", 1, 0, now)
+	if !ok || string(v.body) != "a" {
+		t.Errorf("Expected 'a' one version ago, got '%s' (%v)", v.body, ok)
+	}
+	if _, ok := hist.stale("k", 2, 0, now); ok {
+		t.Error("Expected no version 2 versions ago")
+	}
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/tracing"
+)
+
+// TracingMiddleware records a span for the proxy hop of every request, with
+// the chaos applied to it, and passes the trace on to the upstream. Requests
+// whose trace isn't sampled go through untouched.
+func TracingMiddleware(proxy string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tracing.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		parent, ok := tracing.ParseParent(r.Header.Get(tracing.Header))
+		if ok && !parent.Sampled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		span := tracing.NewSpan(r.Method, parent)
+		ctx := r.Context()
+		report := chaos.ReportFrom(ctx)
+		if report == nil {
+			ctx, report = chaos.WithReport(ctx)
+		}
+		r = r.WithContext(ctx)
+		r.Header = r.Header.Clone()
+		r.Header.Set(tracing.Header, span.Traceparent())
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		span.End = time.Now()
+		status := recorder.statusCode
+		if status == 0 && recorder.written > 0 {
+			status = http.StatusOK
+		}
+		annotate(span, r, proxy, status, report)
+		tracing.Export(span)
+	})
+}
+
+// annotate describes the request and every fault applied to it on span
+func annotate(span *tracing.Span, r *http.Request, proxy string, status int, report *chaos.Report) {
+	route := report.Route()
+	if route != "" {
+		span.Name = r.Method + " " + route
+	}
+
+	span.Set("http.request.method", r.Method)
+	span.Set("url.path", r.URL.Path)
+	if r.URL.RawQuery != "" {
+		span.Set("url.query", r.URL.RawQuery)
+	}
+	span.Set("server.address", r.Host)
+	span.Set("client.address", r.RemoteAddr)
+	if status != 0 {
+		span.Set("http.response.status_code", status)
+	}
+	span.Set("chaos.proxy", proxy)
+	if route != "" {
+		span.Set("chaos.route", route)
+	}
+
+	var (
+		rule, strategy string
+		faults         []string
+		latency        time.Duration
+		decision       chaos.Decision // Every fault of every layer
+	)
+	for _, d := range report.Decisions() {
+		if rule == "" {
+			rule = d.Rule
+		}
+		if strategy == "" {
+			strategy = d.CorruptStrategy
+		}
+		faults = append(faults, d.Faults()...)
+		latency += d.Latency
+		decision.Drop = decision.Drop || d.Drop
+		if d.ReturnError {
+			decision.ReturnError, decision.ErrorCode = true, d.ErrorCode
+		}
+		decision.Stale = decision.Stale || d.Stale
+		decision.Duplicates += d.Duplicates
+		if d.PostFailure != "" {
+			decision.PostFailure = d.PostFailure
+		}
+		decision.Reorder = decision.Reorder || d.Reorder
+	}
+
+	if rule != "" {
+		span.Set("chaos.rule", rule)
+	}
+	if len(faults) > 0 {
+		span.Set("chaos.faults", strings.Join(faults, ","))
+	}
+	if latency > 0 {
+		span.Set("chaos.latency_ms", latency.Milliseconds())
+	}
+	if decision.ReturnError {
+		span.Set("chaos.error_code", decision.ErrorCode)
+	}
+	if strategy != "" {
+		span.Set("chaos.corrupt.strategy", strategy)
+	}
+	if decision.Drop {
+		span.Set("chaos.drop", true)
+	}
+	if decision.Stale {
+		span.Set("chaos.stale", true)
+	}
+	if decision.Duplicates > 0 {
+		span.Set("chaos.duplicates", decision.Duplicates)
+	}
+	if decision.PostFailure != "" {
+		span.Set("chaos.post_failure", decision.PostFailure)
+	}
+	if decision.Reorder {
+		span.Set("chaos.reorder", true)
+	}
+
+	switch {
+	case decision.Drop:
+		span.Error = "request dropped by chaos"
+	case decision.ReturnError:
+		span.Error = fmt.Sprintf("error %d injected by chaos", decision.ErrorCode)
+	case decision.PostFailure != "":
+		span.Error = fmt.Sprintf("%s injected by chaos after the upstream answered", decision.PostFailure)
+	case status == 0:
+		span.Error = "no response sent"
+	case status >= 500:
+		span.Error = fmt.Sprintf("HTTP %d", status)
+	}
+}
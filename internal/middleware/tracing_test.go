@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+	"github.com/khizar-sudo/chaos-proxy/internal/tracing"
+)
+
+// collect runs a collector and an exporter to it, returning what was
+// exported once stop is called
+func collect(t *testing.T) (stop func() string) {
+	t.Helper()
+	var body strings.Builder
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(&body, r.Body)
+	}))
+	exporter := tracing.NewExporter(config.TracingConfig{Endpoint: collector.URL, ServiceName: "chaos-proxy"})
+	exporter.Start()
+
+	return func() string {
+		exporter.Stop()
+		collector.Close()
+		return body.String()
+	}
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	stop := collect(t)
+
+	var upstreamParent string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamParent = r.Header.Get(tracing.Header)
+	})
+	engine := chaos.NewEngine(chaos.ChaosConfig{ErrorRate: 100, ErrorCode: 503})
+	traced := TracingMiddleware("api", ChaosMiddleware(handler, engine))
+
+	req := httptest.NewRequest("GET", "http://example.com/users", nil)
+	req.Header.Set(tracing.Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	traced.ServeHTTP(rec, req)
+
+	if upstreamParent != "" {
+		t.Errorf("Expected the upstream not to be called on an injected error, got %q", upstreamParent)
+	}
+
+	exported := stop()
+	for _, want := range []string{
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"parentSpanId":"00f067aa0ba902b7"`,
+		`{"key":"chaos.error_code","value":{"intValue":"503"}}`,
+		`{"key":"http.response.status_code","value":{"intValue":"503"}}`,
+		`{"key":"chaos.faults","value":{"stringValue":"error"}}`,
+		`"message":"error 503 injected by chaos"`,
+	} {
+		if !strings.Contains(exported, want) {
+			t.Errorf("Expected %s in the export, got %s", want, exported)
+		}
+	}
+}
+
+func TestTracingMiddleware_Propagate(t *testing.T) {
+	stop := collect(t)
+
+	var upstreamParent string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamParent = r.Header.Get(tracing.Header)
+	})
+	engine := chaos.NewEngine(chaos.ChaosConfig{Latency: time.Millisecond})
+	traced := TracingMiddleware("api", ChaosMiddleware(handler, engine))
+
+	req := httptest.NewRequest("GET", "http://example.com/users", nil)
+	traced.ServeHTTP(httptest.NewRecorder(), req)
+
+	exported := stop()
+	var otlp struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal([]byte(exported), &otlp); err != nil {
+		t.Fatalf("Expected OTLP JSON, got %s: %v", exported, err)
+	}
+	span := otlp.ResourceSpans[0].ScopeSpans[0].Spans[0]
+
+	// A new trace, with the proxy hop as the upstream's parent
+	if span.ParentSpanID != "" {
+		t.Errorf("Expected a root span, got parent %s", span.ParentSpanID)
+	}
+	if want := "00-" + span.TraceID + "-" + span.SpanID + "-01"; upstreamParent != want {
+		t.Errorf("Expected traceparent %s upstream, got %q", want, upstreamParent)
+	}
+	if !strings.Contains(exported, `{"key":"chaos.latency_ms","value":{"intValue":"1"}}`) {
+		t.Errorf("Expected chaos.latency_ms in the export, got %s", exported)
+	}
+}
+
+func TestTracingMiddleware_NotSampled(t *testing.T) {
+	stop := collect(t)
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+	var upstreamParent string
+	traced := TracingMiddleware("api", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamParent = r.Header.Get(tracing.Header)
+	}))
+
+	req := httptest.NewRequest("GET", "http://example.com/users", nil)
+	req.Header.Set(tracing.Header, parent)
+	traced.ServeHTTP(httptest.NewRecorder(), req)
+
+	if upstreamParent != parent {
+		t.Errorf("Expected the traceparent to go through untouched, got %q", upstreamParent)
+	}
+	if exported := stop(); exported != "" {
+		t.Errorf("Expected nothing exported, got %s", exported)
+	}
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+)
+
+// Manager runs one Server per configured proxy and reloads them independently
+type Manager struct {
+	mu      sync.Mutex
+	servers map[string]*Server
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		servers: make(map[string]*Server),
+	}
+}
+
+// Apply brings the running servers in line with proxies. Entries whose
+// configuration didn't change keep running untouched, removed entries are
+// stopped and new or changed entries are (re)started. A changed entry that
+// fails to start is rolled back to its previous configuration.
+func (m *Manager) Apply(proxies []config.ProxyConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[string]config.ProxyConfig, len(proxies))
+	for _, p := range proxies {
+		wanted[p.Name] = p
+	}
+
+	// Stop removed entries first so their listen addresses are freed
+	for name, srv := range m.servers {
+		if _, ok := wanted[name]; !ok {
+			srv.Shutdown()
+			delete(m.servers, name)
+		}
+	}
+
+	var errs []error
+	for _, p := range proxies {
+		old, running := m.servers[p.Name]
+		if running && reflect.DeepEqual(old.Config(), p) {
+			continue
+		}
+
+		srv, err := New(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("proxy %q: %w", p.Name, err))
+			continue
+		}
+
+		if running {
+			slog.Info("reloading proxy", "name", p.Name)
+			old.Shutdown()
+		}
+
+		if err := srv.Start(); err != nil {
+			errs = append(errs, err)
+			delete(m.servers, p.Name)
+
+			if running {
+				slog.Info("keeping previous configuration", "name", p.Name)
+				if restored, rerr := New(old.Config()); rerr == nil && restored.Start() == nil {
+					m.servers[p.Name] = restored
+				}
+			}
+			continue
+		}
+		m.servers[p.Name] = srv
+	}
+
+	return errors.Join(errs...)
+}
+
+// Get returns the running server for name
+func (m *Manager) Get(name string) (*Server, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	srv, ok := m.servers[name]
+	return srv, ok
+}
+
+// Names returns the names of all running proxies in sorted order
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.servers))
+	for name := range m.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Shutdown stops every running proxy
+func (m *Manager) Shutdown() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, srv := range m.servers {
+		srv.Shutdown()
+		delete(m.servers, name)
+	}
+}
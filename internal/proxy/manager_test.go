@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+)
+
+func TestManager_ApplyStartsAll(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	a := newUpstream(t, "a")
+	b := newUpstream(t, "b")
+
+	err := m.Apply([]config.ProxyConfig{proxyConfig(t, "a", a.URL), proxyConfig(t, "b", b.URL)})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if names := m.Names(); !slices.Equal(names, []string{"a", "b"}) {
+		t.Fatalf("Expected proxies a and b, got %v", names)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		srv, _ := m.Get(name)
+		if _, body := get(t, srv, "/"); body != name {
+			t.Errorf("Expected proxy %s to reach its own upstream, got '%s'", name, body)
+		}
+	}
+}
+
+func TestManager_ReloadsIndependently(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	a := newUpstream(t, "a")
+	b := newUpstream(t, "b")
+	cfgA := proxyConfig(t, "a", a.URL)
+	cfgB := proxyConfig(t, "b", b.URL)
+
+	if err := m.Apply([]config.ProxyConfig{cfgA, cfgB}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	srvA, _ := m.Get("a")
+	srvB, _ := m.Get("b")
+
+	cfgB.Chaos.ErrorRate = 100
+	cfgB.Chaos.ErrorCode = http.StatusTeapot
+	if err := m.Apply([]config.ProxyConfig{cfgA, cfgB}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if got, _ := m.Get("a"); got != srvA {
+		t.Error("Expected unchanged proxy a to keep running untouched")
+	}
+	newB, _ := m.Get("b")
+	if newB == srvB {
+		t.Fatal("Expected changed proxy b to be restarted")
+	}
+	if code, _ := get(t, newB, "/"); code != http.StatusTeapot {
+		t.Errorf("Expected reloaded proxy b to inject 418, got %d", code)
+	}
+}
+
+func TestManager_RemovesProxies(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	a := newUpstream(t, "a")
+	b := newUpstream(t, "b")
+
+	m.Apply([]config.ProxyConfig{proxyConfig(t, "a", a.URL), proxyConfig(t, "b", b.URL)})
+	if err := m.Apply([]config.ProxyConfig{proxyConfig(t, "a", a.URL)}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if names := m.Names(); !slices.Equal(names, []string{"a"}) {
+		t.Errorf("Expected only proxy a to remain, got %v", names)
+	}
+}
+
+func TestManager_KeepsOldConfigOnError(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	a := newUpstream(t, "a")
+	cfg := proxyConfig(t, "a", a.URL)
+	m.Apply([]config.ProxyConfig{cfg})
+	before, _ := m.Get("a")
+
+	cfg.Chaos.Latency = "whenever"
+	if err := m.Apply([]config.ProxyConfig{cfg}); err == nil {
+		t.Error("Expected error for invalid config, got nil")
+	}
+
+	if after, _ := m.Get("a"); after != before {
+		t.Error("Expected proxy a to keep its previous server")
+	}
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/match"
+)
+
+// route sends matching requests to their own upstream and chaos engine
+type route struct {
+	name        string
+	match       match.Matcher
+	stripPrefix bool
+	handler     http.Handler
+}
+
+// router picks the first matching route, falling back to the proxy's own
+// upstream when nothing matches
+type router struct {
+	routes   []route
+	fallback http.Handler
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, route := range rt.routes {
+		if !route.match.Matches(r) {
+			continue
+		}
+
+		fmt.Printf("[ROUTE] %s %s -> %s\n", r.Method, r.URL.Path, route.name)
+		if report := chaos.ReportFrom(r.Context()); report != nil {
+			report.SetRoute(route.name)
+		}
+		if route.stripPrefix {
+			r = stripPrefix(r, route.match.PathPrefix)
+		}
+		route.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if rt.fallback == nil {
+		http.Error(w, fmt.Sprintf("no route for %s %s", r.Host, r.URL.Path), http.StatusNotFound)
+		return
+	}
+	rt.fallback.ServeHTTP(w, r)
+}
+
+// stripPrefix returns a shallow copy of r with prefix removed from its path
+func stripPrefix(r *http.Request, prefix string) *http.Request {
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = ensureLeadingSlash(strings.TrimPrefix(r.URL.Path, prefix))
+	if r.URL.RawPath != "" {
+		r2.URL.RawPath = ensureLeadingSlash(strings.TrimPrefix(r.URL.RawPath, prefix))
+	}
+	return r2
+}
+
+func ensureLeadingSlash(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
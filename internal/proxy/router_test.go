@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+)
+
+// newEchoUpstream replies with its name and the path it received
+func newEchoUpstream(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name + " " + r.URL.Path))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func routeConfig(t *testing.T, name, upstream string, mc config.MatchConfig) config.RouteConfig {
+	t.Helper()
+	u, _ := url.Parse(upstream)
+	return config.RouteConfig{Name: name, MatchConfig: mc, Upstream: upstream, UpstreamURL: u}
+}
+
+func startRouted(t *testing.T, cfg config.ProxyConfig) *Server {
+	t.Helper()
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func do(t *testing.T, srv *Server, host, path string, header http.Header) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "http://"+srv.Addr().String()+path, nil)
+	if host != "" {
+		req.Host = host
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestRouter_PicksUpstream(t *testing.T) {
+	users := newEchoUpstream(t, "users")
+	orders := newEchoUpstream(t, "orders")
+	billing := newEchoUpstream(t, "billing")
+	fallback := newEchoUpstream(t, "fallback")
+
+	cfg := proxyConfig(t, "gateway", fallback.URL)
+	stripped := routeConfig(t, "orders", orders.URL, config.MatchConfig{PathPrefix: "/orders"})
+	stripped.StripPrefix = true
+	cfg.Routes = []config.RouteConfig{
+		routeConfig(t, "users", users.URL, config.MatchConfig{Host: "users.example.com"}),
+		stripped,
+		routeConfig(t, "billing", billing.URL, config.MatchConfig{Header: "X-Service", HeaderValue: "billing"}),
+	}
+	srv := startRouted(t, cfg)
+
+	tests := []struct {
+		name   string
+		host   string
+		path   string
+		header http.Header
+		want   string
+	}{
+		{"host header", "users.example.com", "/me", nil, "users /me"},
+		{"path prefix stripped", "", "/orders/42", nil, "orders /42"},
+		{"path prefix root", "", "/orders", nil, "orders /"},
+		{"header value", "", "/invoices", http.Header{"X-Service": {"billing"}}, "billing /invoices"},
+		{"fallback", "", "/other", nil, "fallback /other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := do(t, srv, tt.host, tt.path, tt.header)
+			if code != http.StatusOK || body != tt.want {
+				t.Errorf("Expected 200 '%s', got %d '%s'", tt.want, code, body)
+			}
+		})
+	}
+}
+
+func TestRouter_NoFallback(t *testing.T) {
+	users := newEchoUpstream(t, "users")
+
+	cfg := config.ProxyConfig{Name: "gateway", Mode: config.ModeReverse, Listen: "127.0.0.1:0"}
+	cfg.Routes = []config.RouteConfig{routeConfig(t, "users", users.URL, config.MatchConfig{PathPrefix: "/users"})}
+	srv := startRouted(t, cfg)
+
+	if code, _ := do(t, srv, "", "/orders", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a matching route, got %d", code)
+	}
+	if code, _ := do(t, srv, "", "/users/1", nil); code != http.StatusOK {
+		t.Errorf("Expected 200 for a matching route, got %d", code)
+	}
+}
+
+func TestRouter_PerRouteChaos(t *testing.T) {
+	users := newEchoUpstream(t, "users")
+	orders := newEchoUpstream(t, "orders")
+
+	cfg := config.ProxyConfig{Name: "gateway", Mode: config.ModeReverse, Listen: "127.0.0.1:0"}
+	broken := routeConfig(t, "orders", orders.URL, config.MatchConfig{PathPrefix: "/orders"})
+	broken.Chaos = config.FileConfig{ErrorRate: 100, ErrorCode: 503}
+	cfg.Routes = []config.RouteConfig{
+		routeConfig(t, "users", users.URL, config.MatchConfig{PathPrefix: "/users"}),
+		broken,
+	}
+	srv := startRouted(t, cfg)
+
+	if code, _ := do(t, srv, "", "/orders/1", nil); code != 503 {
+		t.Errorf("Expected route chaos to inject 503, got %d", code)
+	}
+	if code, _ := do(t, srv, "", "/users/1", nil); code != 200 {
+		t.Errorf("Expected clean route to return 200, got %d", code)
+	}
+}
+
+func TestRouter_StubRoutes(t *testing.T) {
+	bodyFile := filepath.Join(t.TempDir(), "orders.json")
+	if err := os.WriteFile(bodyFile, []byte(`[{"id": 1}]`), 0600); err != nil {
+		t.Fatalf("Failed to write body file: %v", err)
+	}
+
+	cfg := config.ProxyConfig{Name: "offline", Mode: config.ModeReverse, Listen: "127.0.0.1:0"}
+	cfg.Routes = []config.RouteConfig{
+		{Name: "hello", MatchConfig: config.MatchConfig{PathPrefix: "/hello"}, Respond: &config.StubConfig{Status: 200, Body: "hello {{.Query.Get \"name\"}}", Template: true}},
+		{Name: "orders", MatchConfig: config.MatchConfig{PathPrefix: "/orders"}, Respond: &config.StubConfig{Status: 200, BodyFile: bodyFile}},
+		{
+			Name:        "broken",
+			MatchConfig: config.MatchConfig{PathPrefix: "/broken"},
+			Respond:     &config.StubConfig{Status: 200, Body: "never seen"},
+			Chaos:       config.FileConfig{ErrorRate: 100, ErrorCode: 503},
+		},
+	}
+	srv := startRouted(t, cfg)
+
+	if code, body := do(t, srv, "", "/hello?name=chaos", nil); code != 200 || body != "hello chaos" {
+		t.Errorf("Expected 200 'hello chaos', got %d '%s'", code, body)
+	}
+	if code, body := do(t, srv, "", "/orders", nil); code != 200 || body != `[{"id": 1}]` {
+		t.Errorf("Expected body from file, got %d '%s'", code, body)
+	}
+	// Chaos applies to stubbed responses too
+	if code, _ := do(t, srv, "", "/broken", nil); code != 503 {
+		t.Errorf("Expected route chaos to inject 503, got %d", code)
+	}
+}
+
+func TestNew_StubMissingBodyFile(t *testing.T) {
+	cfg := config.ProxyConfig{Name: "offline", Mode: config.ModeReverse, Listen: "127.0.0.1:0"}
+	cfg.Routes = []config.RouteConfig{
+		{Name: "missing", Respond: &config.StubConfig{Status: 200, BodyFile: filepath.Join(t.TempDir(), "nope.json")}},
+	}
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for a missing body_file, got nil")
+	}
+}
+
+func TestRouter_RulesChangedAtRuntime(t *testing.T) {
+	users := newEchoUpstream(t, "users")
+
+	cfg := config.ProxyConfig{Name: "gateway", Mode: config.ModeReverse, Listen: "127.0.0.1:0"}
+	cfg.Routes = []config.RouteConfig{routeConfig(t, "users", users.URL, config.MatchConfig{PathPrefix: "/users"})}
+	srv := startRouted(t, cfg)
+
+	err := srv.SetRules([]config.RuleConfig{
+		{Name: "broken", MatchConfig: config.MatchConfig{Method: "DELETE"}, Chaos: config.FileConfig{ErrorRate: 100, ErrorCode: 503}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if code, _ := do(t, srv, "", "/users/1", nil); code != http.StatusOK {
+		t.Errorf("Expected 200 outside the rule, got %d", code)
+	}
+	req, _ := http.NewRequest("DELETE", "http://"+srv.Addr().String()+"/users/1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Errorf("Expected the new rule to apply inside the route, got %d", resp.StatusCode)
+	}
+
+	if err := srv.SetFault("error", false); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.SetFault("meteor", false); err == nil {
+		t.Error("Expected error for an unknown fault, got nil")
+	}
+}
@@ -0,0 +1,755 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/balancer"
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+	"github.com/khizar-sudo/chaos-proxy/internal/forward"
+	"github.com/khizar-sudo/chaos-proxy/internal/har"
+	"github.com/khizar-sudo/chaos-proxy/internal/match"
+	"github.com/khizar-sudo/chaos-proxy/internal/middleware"
+	"github.com/khizar-sudo/chaos-proxy/internal/ratelimit"
+	"github.com/khizar-sudo/chaos-proxy/internal/recording"
+	"github.com/khizar-sudo/chaos-proxy/internal/roundtrip"
+	"github.com/khizar-sudo/chaos-proxy/internal/stub"
+	"github.com/khizar-sudo/chaos-proxy/internal/tlsutil"
+	"github.com/khizar-sudo/chaos-proxy/internal/unixsock"
+)
+
+// Server is one proxy listener built from a ProxyConfig
+type Server struct {
+	cfg       config.ProxyConfig
+	srv       *http.Server
+	tlsConfig *tls.Config
+	capture   *har.Recorder
+	addr      net.Addr
+	engines   *engineSet
+
+	// cfg with the changes made at runtime
+	mu      sync.Mutex
+	live    config.ProxyConfig
+	applied time.Time // When live.Chaos's expires_after started counting
+}
+
+// engineSet keeps track of every chaos engine of a server, so changes made
+// at runtime reach routes and pool backends too
+type engineSet struct {
+	top    *chaos.Engine   // The proxy's own chaos and rules
+	routes []*chaos.Engine // Rules apply inside routes too
+	all    []*chaos.Engine // Including pool backends
+
+	// The config file's expires_after counts from loaded, a reset goes back
+	// to it instead of starting over. Every engine and fault reads deadline.
+	loaded   time.Time
+	deadline *chaos.Deadline
+
+	// One per chaos.ProxyFaults, read wherever those faults are injected
+	switches map[string]*chaos.Switch
+}
+
+func (es *engineSet) add(e *chaos.Engine) *chaos.Engine {
+	es.all = append(es.all, e)
+	return e
+}
+
+// New builds the handler chain for cfg without starting to listen
+func New(cfg config.ProxyConfig) (*Server, error) {
+	loaded := time.Now()
+	chaosConfig, err := buildChaosConfig(cfg.Chaos, loaded)
+	if err != nil {
+		return nil, err
+	}
+	chaosConfig.Rules, err = buildRules(cfg.Rules, loaded)
+	if err != nil {
+		return nil, err
+	}
+	engines := &engineSet{loaded: loaded, deadline: chaos.NewDeadline(chaosConfig.ActiveUntil), switches: make(map[string]*chaos.Switch)}
+	for _, fault := range chaos.ProxyFaults {
+		engines.switches[fault] = chaos.NewSwitch()
+	}
+	chaosConfig.ActiveUntil, chaosConfig.Deadline = time.Time{}, engines.deadline
+	engines.top = engines.add(chaos.NewEngine(chaosConfig))
+
+	baseTransport, err := upstreamTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sockets := unixsock.NewSockets()
+	if cfg.Mode == config.ModeForward {
+		// The proxy must not send its own traffic through HTTP_PROXY, that's us
+		baseTransport.Proxy = nil
+	} else {
+		// Clients pick the hosts in forward mode, only reverse upstreams are sockets
+		baseTransport.DialContext = sockets.DialContext(baseTransport.DialContext)
+	}
+	var transport http.RoundTripper = baseTransport
+	if t := cfg.Transport; t != (config.TransportConfig{}) {
+		transport = roundtrip.New(baseTransport, roundtrip.Faults{
+			DNSErrorRate:   t.DNSErrorRate,
+			DialErrorRate:  t.DialErrorRate,
+			TLSErrorRate:   t.TLSErrorRate,
+			ResetReuseRate: t.ResetReuseRate,
+			SlowDialRate:   t.SlowDialRate,
+			SlowDial:       t.SlowDialDuration,
+			Deadline:       engines.deadline,
+			Switch:         engines.switches[chaos.FaultTransport],
+		})
+	}
+
+	tlsConfig, err := listenerTLSConfig(cfg, engines)
+	if err != nil {
+		return nil, err
+	}
+
+	var capture *har.Recorder
+	if h := cfg.HAR; h != nil {
+		capture = har.NewRecorder(har.Options{File: h.File, Bodies: h.Bodies, MaxEntries: h.MaxEntries})
+	}
+
+	var handler http.Handler
+	if cfg.Mode == config.ModeForward {
+		handler, err = forwardHandler(cfg, transport, engines, capture)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		handler, err = reverseHandler(cfg, transport, sockets, engines)
+		if err != nil {
+			return nil, err
+		}
+		if capture != nil {
+			handler = capture.Middleware(handler)
+		}
+		handler = middleware.TracingMiddleware(cfg.Name, handler)
+		handler = controlled(handler, cfg)
+		handler = middleware.EventsMiddleware(cfg.Name, handler)
+	}
+
+	if capture != nil && cfg.HAR.Endpoint != "" {
+		handler = withEndpoint(handler, cfg.HAR.Endpoint, capture)
+	}
+
+	return &Server{
+		cfg:       cfg,
+		live:      cfg,
+		applied:   loaded,
+		tlsConfig: tlsConfig,
+		capture:   capture,
+		engines:   engines,
+		srv: &http.Server{
+			Addr:              cfg.Listen,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+// Start binds the listen address and serves in the background. Bind errors
+// are returned instead of being logged from the serving goroutine.
+func (s *Server) Start() error {
+	var (
+		ln  net.Listener
+		err error
+	)
+	if path, ok := unixsock.Path(s.cfg.Listen); ok {
+		ln, err = unixsock.Listen(path, s.cfg.SocketPerm)
+	} else {
+		ln, err = net.Listen("tcp", s.cfg.Listen)
+	}
+	if err != nil {
+		return fmt.Errorf("proxy %q: failed to listen on %s: %w", s.cfg.Name, s.cfg.Listen, err)
+	}
+	s.addr = ln.Addr()
+	if s.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
+
+	fmt.Println()
+	fmt.Println("==============================================================================")
+	slog.Info("starting server", "name", s.cfg.Name, "mode", s.cfg.Mode, "listen", s.cfg.Listen, "upstream", s.cfg.Upstream, "tls", s.tlsConfig != nil)
+	s.cfg.PrintConfiguration()
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("server error", "name", s.cfg.Name, "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the listener, giving in-flight requests up to 5 seconds
+func (s *Server) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer func() {
+		cancel()
+		fmt.Println()
+	}()
+
+	slog.Info("shutting down server...", "name", s.cfg.Name)
+	if err := s.srv.Shutdown(ctx); err != nil {
+		slog.Error("server shutdown error", "name", s.cfg.Name, "error", err)
+	} else {
+		slog.Info("server stopped gracefully", "name", s.cfg.Name)
+	}
+
+	if s.capture != nil {
+		if err := s.capture.Close(); err != nil {
+			slog.Error("failed to write HAR file", "name", s.cfg.Name, "error", err)
+		}
+	}
+}
+
+// Addr returns the bound listen address, nil before Start
+func (s *Server) Addr() net.Addr {
+	return s.addr
+}
+
+// Config returns the configuration the server was built from
+func (s *Server) Config() config.ProxyConfig {
+	return s.cfg
+}
+
+// Live returns the configuration including the changes made at runtime
+func (s *Server) Live() config.ProxyConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.live
+}
+
+// SetChaos replaces the proxy's own chaos settings without a restart, an
+// expires_after in fc counts from now. Routes and pool backends keep theirs.
+func (s *Server) SetChaos(fc config.FileConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setChaos(fc, time.Now())
+}
+
+// UpdateChaos is SetChaos for a change to the live settings. An unchanged
+// expires_after keeps counting from when it was applied, so tuning a rate
+// doesn't bring expired chaos back.
+func (s *Server) UpdateChaos(fc config.FileConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	applied := time.Now()
+	if fc.ExpiresAfter == s.live.Chaos.ExpiresAfter {
+		applied = s.applied
+	}
+	return s.setChaos(fc, applied)
+}
+
+// ChaosSnapshot is the proxy's own chaos settings, with when their
+// expires_after started counting
+type ChaosSnapshot struct {
+	Chaos   config.FileConfig
+	applied time.Time
+}
+
+// SnapshotChaos returns the proxy's own chaos settings for RestoreChaos
+func (s *Server) SnapshotChaos() ChaosSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return ChaosSnapshot{Chaos: s.live.Chaos, applied: s.applied}
+}
+
+// RestoreChaos puts back the settings of a snapshot, their expires_after
+// counting from when it was first applied
+func (s *Server) RestoreChaos(snap ChaosSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setChaos(snap.Chaos, snap.applied)
+}
+
+// setChaos applies fc with its expires_after counting from applied, s.mu
+// must be held
+func (s *Server) setChaos(fc config.FileConfig, applied time.Time) error {
+	chaosConfig, err := buildChaosConfig(fc, applied)
+	if err != nil {
+		return err
+	}
+
+	s.engines.deadline.Set(chaosConfig.ActiveUntil)
+	chaosConfig.ActiveUntil, chaosConfig.Deadline = time.Time{}, s.engines.deadline
+	chaosConfig.Rules = s.engines.top.Config().Rules
+	s.engines.top.SetConfig(chaosConfig)
+	s.live.Chaos = fc
+	s.applied = applied
+	return nil
+}
+
+// SetRules replaces the rules without a restart, their expires_after counts
+// from now
+func (s *Server) SetRules(rcs []config.RuleConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setRules(rcs, time.Now())
+}
+
+// setRules applies rcs with their expires_after counting from applied, s.mu
+// must be held
+func (s *Server) setRules(rcs []config.RuleConfig, applied time.Time) error {
+	rules, err := buildRules(rcs, applied)
+	if err != nil {
+		return err
+	}
+
+	s.engines.top.SetRules(rules)
+	for _, e := range s.engines.routes {
+		e.SetRules(rules)
+	}
+	s.live.Rules = rcs
+	return nil
+}
+
+// SetFault switches one of chaos.Faults or chaos.ProxyFaults on or off
+// everywhere in the proxy
+func (s *Server) SetFault(fault string, enabled bool) error {
+	if sw, ok := s.engines.switches[fault]; ok {
+		sw.Set(enabled)
+		return nil
+	}
+	if !chaos.IsFault(fault) {
+		return fmt.Errorf("unknown fault %q, expected one of %s", fault, strings.Join(slices.Concat(chaos.Faults, chaos.ProxyFaults), ", "))
+	}
+	for _, e := range s.engines.all {
+		e.SetFault(fault, enabled)
+	}
+	return nil
+}
+
+// DisabledFaults returns the faults switched off at runtime
+func (s *Server) DisabledFaults() []string {
+	disabled := s.engines.top.Disabled()
+	for _, fault := range chaos.ProxyFaults {
+		if !s.engines.switches[fault].On() {
+			disabled = append(disabled, fault)
+		}
+	}
+	return disabled
+}
+
+// Reset drops every change made at runtime. The config file's expiry still
+// counts from when it was loaded, expired chaos stays off.
+func (s *Server) Reset() error {
+	s.mu.Lock()
+	err := s.setChaos(s.cfg.Chaos, s.engines.loaded)
+	if err == nil {
+		err = s.setRules(s.cfg.Rules, s.engines.loaded)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, fault := range slices.Concat(chaos.Faults, chaos.ProxyFaults) {
+		s.SetFault(fault, true)
+	}
+	return nil
+}
+
+// buildChaosConfig validates fc, an expires_after in it counts from applied
+func buildChaosConfig(fc config.FileConfig, applied time.Time) (chaos.ChaosConfig, error) {
+	latencies, err := fc.ParseDurations()
+	if err != nil {
+		return chaos.ChaosConfig{}, err
+	}
+	if fc.StaleVersions < 0 || fc.StaleVersions > 15 {
+		return chaos.ChaosConfig{}, fmt.Errorf("stale_versions must be between 0 and 15")
+	}
+	if fc.StaleVersions > 0 && fc.StaleAge != "" {
+		return chaos.ChaosConfig{}, fmt.Errorf("use either stale_versions or stale_age, not both")
+	}
+	if fc.DuplicateCount != 0 && (fc.DuplicateCount < 2 || fc.DuplicateCount > 10) {
+		return chaos.ChaosConfig{}, fmt.Errorf("duplicate_count must be between 2 and 10")
+	}
+	switch fc.PostFailureMode {
+	case "", chaos.PostFailureError, chaos.PostFailureTimeout, chaos.PostFailureReset:
+	default:
+		return chaos.ChaosConfig{}, fmt.Errorf("post_failure_mode must be error, timeout or reset, got '%s'", fc.PostFailureMode)
+	}
+	switch fc.ReorderOrder {
+	case "", chaos.ReorderShuffle, chaos.ReorderReverse:
+	default:
+		return chaos.ChaosConfig{}, fmt.Errorf("reorder_order must be shuffle or reverse, got '%s'", fc.ReorderOrder)
+	}
+	if fc.ReorderCount < 0 || latencies.ReorderWindow < 0 {
+		return chaos.ChaosConfig{}, fmt.Errorf("reorder_count and reorder_window can't be negative")
+	}
+	var activeUntil time.Time
+	switch {
+	case fc.ExpiresAfter != "" && fc.ActiveUntil != "":
+		return chaos.ChaosConfig{}, fmt.Errorf("use either expires_after or active_until, not both")
+	case fc.ExpiresAfter != "":
+		if latencies.ExpiresAfter <= 0 {
+			return chaos.ChaosConfig{}, fmt.Errorf("expires_after must be positive")
+		}
+		activeUntil = applied.Add(latencies.ExpiresAfter)
+	case fc.ActiveUntil != "":
+		activeUntil, err = time.Parse(time.RFC3339, fc.ActiveUntil)
+		if err != nil {
+			return chaos.ChaosConfig{}, fmt.Errorf("invalid active_until, expected RFC 3339 like 2006-01-02T15:04:05Z: %w", err)
+		}
+	}
+
+	return chaos.ChaosConfig{
+		DropRate:    fc.DropRate,
+		ErrorRate:   fc.ErrorRate,
+		ErrorCode:   fc.ErrorCode,
+		Latency:     latencies.Latency,
+		LatencyMin:  latencies.LatencyMin,
+		LatencyMax:  latencies.LatencyMax,
+		CorruptRate: fc.CorruptRate,
+
+		StaleRate:        fc.StaleRate,
+		StaleVersions:    fc.StaleVersions,
+		StaleAge:         latencies.StaleAge,
+		StaleKeepHeaders: fc.StaleKeepHeaders,
+
+		DuplicateRate:  fc.DuplicateRate,
+		DuplicateCount: fc.DuplicateCount,
+		DuplicateDelay: latencies.DuplicateDelay,
+
+		PostFailureRate: fc.PostFailureRate,
+		PostFailureMode: fc.PostFailureMode,
+
+		ReorderRate:   fc.ReorderRate,
+		ReorderWindow: latencies.ReorderWindow,
+		ReorderCount:  fc.ReorderCount,
+		ReorderOrder:  fc.ReorderOrder,
+
+		ActiveUntil: activeUntil,
+	}, nil
+}
+
+func buildRules(rcs []config.RuleConfig, applied time.Time) ([]chaos.Rule, error) {
+	rules := make([]chaos.Rule, 0, len(rcs))
+	for _, rule := range rcs {
+		ruleConfig, err := buildChaosConfig(rule.Chaos, applied)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		rules = append(rules, chaos.Rule{
+			Name:    rule.Name,
+			Matcher: matcher(rule.MatchConfig),
+			Config:  ruleConfig,
+		})
+	}
+	return rules, nil
+}
+
+func matcher(mc config.MatchConfig) match.Matcher {
+	return match.Matcher{
+		Host:        mc.Host,
+		PathPrefix:  mc.PathPrefix,
+		Method:      mc.Method,
+		Header:      mc.Header,
+		HeaderValue: mc.HeaderValue,
+	}
+}
+
+func reverseHandler(cfg config.ProxyConfig, transport http.RoundTripper, sockets *unixsock.Sockets, engines *engineSet) (http.Handler, error) {
+	var store *recording.Store
+	if rc := cfg.Recording; rc != nil {
+		var err error
+		store, err = recording.NewStore(rc.Dir, rc.MatchBody)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	limiter := rateLimiter(cfg, engines)
+
+	var fallback http.Handler
+	if cfg.UpstreamURL != nil || len(cfg.Upstreams) > 0 {
+		upstream, err := upstreamHandler(cfg.UpstreamURL, cfg.PoolConfig, transport, sockets, engines, recorder(cfg, store, "default"))
+		if err != nil {
+			return nil, err
+		}
+		fallback = limited(middleware.ChaosMiddleware(upstream, engines.top), limiter, "default")
+	}
+
+	if len(cfg.Routes) == 0 {
+		return middleware.LoggingMiddleware(fallback), nil
+	}
+
+	rt := &router{fallback: fallback}
+	for _, rc := range cfg.Routes {
+		routeConfig, err := buildChaosConfig(rc.Chaos, engines.loaded)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", rc.Name, err)
+		}
+		// Rules still apply inside routes, and the proxy's expiry
+		routeConfig.Rules = engines.top.Config().Rules
+		routeConfig.Deadline = engines.deadline
+		routeEngine := engines.add(chaos.NewEngine(routeConfig))
+		engines.routes = append(engines.routes, routeEngine)
+
+		var upstream http.Handler
+		if rc.Respond != nil {
+			upstream, err = stubHandler(rc.Respond)
+		} else {
+			upstream, err = upstreamHandler(rc.UpstreamURL, rc.PoolConfig, transport, sockets, engines, recorder(cfg, store, rc.Name))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", rc.Name, err)
+		}
+
+		rt.routes = append(rt.routes, route{
+			name:        rc.Name,
+			match:       matcher(rc.MatchConfig),
+			stripPrefix: rc.StripPrefix,
+			handler:     limited(middleware.ChaosMiddleware(upstream, routeEngine), limiter, rc.Name),
+		})
+	}
+
+	return middleware.LoggingMiddleware(rt), nil
+}
+
+// upstreamHandler proxies to a single upstream, or balances over a pool whose
+// backends each apply their own chaos on top. unix:// upstreams are dialed
+// through sockets, record wraps every upstream below any chaos.
+func upstreamHandler(upstreamURL *url.URL, pool config.PoolConfig, transport http.RoundTripper, sockets *unixsock.Sockets, engines *engineSet, record func(http.Handler) http.Handler) (http.Handler, error) {
+	if len(pool.Upstreams) == 0 {
+		return record(reverseProxy(sockets.Target(upstreamURL), transport)), nil
+	}
+
+	backends := make([]*balancer.Backend, 0, len(pool.Upstreams))
+	for _, bc := range pool.Upstreams {
+		backendConfig, err := buildChaosConfig(bc.Chaos, engines.loaded)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %q: %w", bc.Name, err)
+		}
+		backendConfig.Deadline = engines.deadline
+		target := sockets.Target(bc.BackendURL)
+		backends = append(backends, &balancer.Backend{
+			Name:    bc.Name,
+			URL:     target,
+			Handler: middleware.ChaosMiddleware(record(reverseProxy(target, transport)), engines.add(chaos.NewEngine(backendConfig))),
+		})
+	}
+
+	return balancer.NewPool(pool.Balance, pool.HashHeader, backends)
+}
+
+// recorder saves the responses of the upstream it wraps under name, or
+// replaces it with its recordings, depending on the recording mode. It goes
+// right around the reverse proxy, below pool backend chaos too, so
+// recordings are always of the clean upstream response.
+func recorder(cfg config.ProxyConfig, store *recording.Store, name string) func(http.Handler) http.Handler {
+	return func(upstream http.Handler) http.Handler {
+		if store == nil {
+			return upstream
+		}
+		if cfg.Recording.Mode == recording.ModeReplay {
+			return store.Replay(name)
+		}
+		return store.Record(name, upstream)
+	}
+}
+
+// rateLimiter is shared by every route of the proxy, nil without a rate limit
+func rateLimiter(cfg config.ProxyConfig, engines *engineSet) *ratelimit.Limiter {
+	rl := cfg.RateLimit
+	if rl == nil {
+		return nil
+	}
+	return ratelimit.New(ratelimit.Options{
+		Algorithm: rl.Algorithm,
+		Limit:     rl.Limit,
+		Window:    rl.WindowDuration,
+		Burst:     rl.Burst,
+		Key:       rl.Key,
+		Header:    rl.Header,
+		Deadline:  engines.deadline,
+		Switch:    engines.switches[chaos.FaultRateLimit],
+	})
+}
+
+// limited puts the rate limit in front of h, before any chaos is applied.
+// Requests are counted under route when the limit is per route.
+func limited(h http.Handler, limiter *ratelimit.Limiter, route string) http.Handler {
+	if limiter == nil {
+		return h
+	}
+	return limiter.Middleware(route, h)
+}
+
+// controlled lets requests pick their own chaos with control headers. It
+// goes outside the HAR capture, so the secret is never captured.
+func controlled(h http.Handler, cfg config.ProxyConfig) http.Handler {
+	if cfg.Control == nil {
+		return h
+	}
+	return middleware.ControlHeaders(cfg.Control.Secret, h)
+}
+
+// stubHandler answers with a canned response, chaos is applied around it
+// like around any upstream
+func stubHandler(sc *config.StubConfig) (http.Handler, error) {
+	body := []byte(sc.Body)
+	if sc.BodyFile != "" {
+		var err error
+		body, err = os.ReadFile(sc.BodyFile) // #nosec G304 - path comes from the config file
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body_file: %w", err)
+		}
+	}
+
+	return stub.New(stub.Response{
+		Status:  sc.Status,
+		Headers: sc.Headers,
+		Body:    body,
+	}, sc.Template)
+}
+
+func reverseProxy(upstreamURL *url.URL, transport http.RoundTripper) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+	proxy.Transport = transport
+	proxy.ModifyResponse = upstreamStatus
+	// The upstream didn't answer, the 502 is ours and mustn't be recorded
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		recording.Failed(r)
+		log.Printf("http: proxy error: %v", err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	// Customize the Director to properly set headers for the upstream request
+	originalDirector := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		originalDirector(req)
+		req.Host = upstreamURL.Host
+		req.Header.Set("User-Agent", "chaos-proxy/1.0")
+		req.Header.Set("X-Forwarded-Host", req.Header.Get("Host"))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Printf("[PROXY] %s %s\n", r.Method, r.URL.Path)
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// upstreamStatus records the upstream's status in the request's report,
+// before any chaos changes what the client gets
+func upstreamStatus(resp *http.Response) error {
+	if report := chaos.ReportFrom(resp.Request.Context()); report != nil {
+		report.SetUpstreamStatus(resp.StatusCode)
+	}
+	return nil
+}
+
+func forwardHandler(cfg config.ProxyConfig, transport http.RoundTripper, engines *engineSet, capture *har.Recorder) (http.Handler, error) {
+	var ca *tlsutil.CA
+	if cfg.Forward.MITM {
+		var err error
+		ca, err = tlsutil.LoadOrCreateCA(cfg.Forward.CertDir)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("intercepting CONNECT tunnels", "ca", filepath.Join(cfg.Forward.CertDir, "ca.crt"))
+	}
+
+	proxy := forward.New(transport, ca)
+	// Per route limits count per host here
+	handler := middleware.LoggingMiddleware(limited(middleware.ChaosMiddleware(proxy, engines.top), rateLimiter(cfg, engines), ""))
+	if capture != nil {
+		// Inside the MITM, so intercepted requests are captured one by one
+		handler = capture.Middleware(handler)
+	}
+	handler = middleware.TracingMiddleware(cfg.Name, handler)
+	handler = controlled(handler, cfg)
+	handler = middleware.EventsMiddleware(cfg.Name, handler)
+	return proxy.Handler(handler), nil
+}
+
+// withEndpoint serves h on path and everything else with next
+func withEndpoint(next http.Handler, path string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == path && !r.URL.IsAbs() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listenerTLSConfig builds the listener's TLS config, its handshake faults
+// expire with the proxy's chaos
+func listenerTLSConfig(cfg config.ProxyConfig, engines *engineSet) (*tls.Config, error) {
+	if cfg.ListenTLS == nil {
+		return nil, nil
+	}
+
+	var (
+		tlsConfig *tls.Config
+		ca        *tlsutil.CA
+		err       error
+	)
+	if cfg.ListenTLS.AutoCert {
+		tlsConfig, ca, err = tlsutil.AutoServerConfig(cfg.ListenTLS.CertDir, cfg.ListenTLS.Hosts)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("using auto-generated listener certificates", "ca", filepath.Join(cfg.ListenTLS.CertDir, "ca.crt"))
+	} else {
+		tlsConfig, err = tlsutil.ServerConfig(cfg.ListenTLS.CertFile, cfg.ListenTLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f := cfg.ListenTLS.Faults
+	return tlsutil.WithFaults(tlsConfig, ca, tlsutil.Faults{
+		DelayRate:        f.DelayRate,
+		Delay:            f.DelayDuration,
+		AbortRate:        f.AbortRate,
+		AlertRate:        f.AlertRate,
+		ExpiredRate:      f.ExpiredRate,
+		SelfSignedRate:   f.SelfSignedRate,
+		WrongHostRate:    f.WrongHostRate,
+		DowngradeRate:    f.DowngradeRate,
+		DowngradeVersion: f.MaxVersion,
+		Deadline:         engines.deadline,
+		Switch:           engines.switches[chaos.FaultTLSHandshake],
+	}), nil
+}
+
+func upstreamTransport(cfg config.ProxyConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.UpstreamTLS == nil {
+		return transport, nil
+	}
+
+	tlsConfig, err := tlsutil.ClientConfig(tlsutil.ClientOptions{
+		CAFile:             cfg.UpstreamTLS.CAFile,
+		CertFile:           cfg.UpstreamTLS.CertFile,
+		KeyFile:            cfg.UpstreamTLS.KeyFile,
+		ServerName:         cfg.UpstreamTLS.ServerName,
+		InsecureSkipVerify: cfg.UpstreamTLS.InsecureSkipVerify,
+	})
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
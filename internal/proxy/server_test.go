@@ -0,0 +1,678 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+	"github.com/khizar-sudo/chaos-proxy/internal/events"
+)
+
+func newUpstream(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func proxyConfig(t *testing.T, name, upstream string) config.ProxyConfig {
+	t.Helper()
+	u, err := url.Parse(upstream)
+	if err != nil {
+		t.Fatalf("Invalid upstream: %v", err)
+	}
+	return config.ProxyConfig{
+		Name:        name,
+		Mode:        config.ModeReverse,
+		Listen:      "127.0.0.1:0",
+		Upstream:    upstream,
+		UpstreamURL: u,
+	}
+}
+
+func get(t *testing.T, srv *Server, path string) (int, string) {
+	t.Helper()
+	resp, err := http.Get("http://" + srv.Addr().String() + path)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestServer_ReverseProxy(t *testing.T) {
+	upstream := newUpstream(t, "hello")
+
+	srv, err := New(proxyConfig(t, "api", upstream.URL))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	code, body := get(t, srv, "/")
+	if code != http.StatusOK || body != "hello" {
+		t.Errorf("Expected 200 'hello', got %d '%s'", code, body)
+	}
+}
+
+func TestServer_RulesApply(t *testing.T) {
+	upstream := newUpstream(t, "hello")
+
+	cfg := proxyConfig(t, "api", upstream.URL)
+	cfg.Rules = []config.RuleConfig{
+		{Name: "broken", MatchConfig: config.MatchConfig{PathPrefix: "/broken"}, Chaos: config.FileConfig{ErrorRate: 100, ErrorCode: 502}},
+	}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	if code, _ := get(t, srv, "/broken/thing"); code != 502 {
+		t.Errorf("Expected rule to inject 502, got %d", code)
+	}
+	if code, _ := get(t, srv, "/fine"); code != 200 {
+		t.Errorf("Expected 200 outside the rule, got %d", code)
+	}
+}
+
+func TestNew_InvalidLatency(t *testing.T) {
+	cfg := proxyConfig(t, "api", "http://localhost:1")
+	cfg.Chaos.Latency = "later"
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for invalid latency, got nil")
+	}
+}
+
+func TestServer_StartAddressInUse(t *testing.T) {
+	upstream := newUpstream(t, "hello")
+
+	first, _ := New(proxyConfig(t, "a", upstream.URL))
+	if err := first.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer first.Shutdown()
+
+	cfg := proxyConfig(t, "b", upstream.URL)
+	cfg.Listen = first.Addr().String()
+	second, _ := New(cfg)
+	if err := second.Start(); err == nil {
+		second.Shutdown()
+		t.Error("Expected bind error for an address in use, got nil")
+	}
+}
+
+func TestServer_PoolPerBackendChaos(t *testing.T) {
+	healthy := newUpstream(t, "healthy")
+	dead := newUpstream(t, "dead")
+
+	cfg := config.ProxyConfig{Name: "pool", Mode: config.ModeReverse, Listen: "127.0.0.1:0"}
+	cfg.Balance = "round_robin"
+	for i, u := range []string{healthy.URL, dead.URL} {
+		parsed, _ := url.Parse(u)
+		cfg.Upstreams = append(cfg.Upstreams, config.BackendConfig{Name: []string{"one", "two"}[i], URL: u, BackendURL: parsed})
+	}
+	// Backend two is broken, backend one is fine
+	cfg.Upstreams[1].Chaos = config.FileConfig{ErrorRate: 100, ErrorCode: http.StatusBadGateway}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	codes := make(map[int]int)
+	for i := 0; i < 4; i++ {
+		code, _ := get(t, srv, "/")
+		codes[code]++
+	}
+	if codes[http.StatusOK] != 2 || codes[http.StatusBadGateway] != 2 {
+		t.Errorf("Expected half the requests to hit the broken backend, got %v", codes)
+	}
+}
+
+func TestServer_TransportChaos(t *testing.T) {
+	upstream := newUpstream(t, "hello")
+
+	cfg := proxyConfig(t, "api", upstream.URL)
+	cfg.Transport = config.TransportConfig{DNSErrorRate: 100}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	// The failed dial comes back from the ReverseProxy's own error handler
+	if code, _ := get(t, srv, "/"); code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", code)
+	}
+}
+
+func TestServer_RecordSkipsTransportChaos(t *testing.T) {
+	upstream := newUpstream(t, "live data")
+
+	cfg := proxyConfig(t, "api", upstream.URL)
+	cfg.Transport = config.TransportConfig{DialErrorRate: 100}
+	cfg.Recording = &config.RecordingConfig{Mode: "record", Dir: t.TempDir()}
+
+	recorder, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := recorder.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if code, _ := get(t, recorder, "/users/1"); code != http.StatusBadGateway {
+		t.Fatalf("Expected the failed dial while recording, got %d", code)
+	}
+	recorder.Shutdown()
+
+	cfg.Recording.Mode = "replay"
+	cfg.Transport = config.TransportConfig{}
+	replayer, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := replayer.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer replayer.Shutdown()
+
+	if code, _ := get(t, replayer, "/users/1"); code != http.StatusNotFound {
+		t.Errorf("Expected no recording of the failed dial, got %d", code)
+	}
+}
+
+func TestServer_ProxyFaults(t *testing.T) {
+	upstream := newUpstream(t, "hello")
+
+	cfg := proxyConfig(t, "api", upstream.URL)
+	cfg.Transport = config.TransportConfig{DialErrorRate: 100}
+	cfg.RateLimit = &config.RateLimitConfig{Limit: 1, Window: "1h", WindowDuration: time.Hour}
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	if code, _ := get(t, srv, "/"); code != http.StatusBadGateway {
+		t.Fatalf("Expected the failed dial, got %d", code)
+	}
+	if code, _ := get(t, srv, "/"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the rate limit, got %d", code)
+	}
+
+	for _, fault := range []string{"transport", "rate_limit"} {
+		if err := srv.SetFault(fault, false); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+	if disabled := srv.DisabledFaults(); len(disabled) != 2 || disabled[0] != "transport" || disabled[1] != "rate_limit" {
+		t.Errorf("Expected transport and rate_limit disabled, got %v", disabled)
+	}
+	if code, body := get(t, srv, "/"); code != http.StatusOK || body != "hello" {
+		t.Errorf("Expected the upstream with both switched off, got %d %q", code, body)
+	}
+
+	if err := srv.Reset(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if code, _ := get(t, srv, "/"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the rate limit back after a reset, got %d", code)
+	}
+}
+
+func TestServer_UnixSockets(t *testing.T) {
+	dir := t.TempDir()
+
+	upstreamLn, err := net.Listen("unix", filepath.Join(dir, "app.sock"))
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	upstream := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello over uds"))
+	})}
+	go upstream.Serve(upstreamLn)
+	defer upstream.Close()
+
+	listenPath := filepath.Join(dir, "chaos.sock")
+	cfg := proxyConfig(t, "uds", "unix://"+filepath.Join(dir, "app.sock"))
+	cfg.Listen = "unix://" + listenPath
+	cfg.SocketPerm = 0600
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", listenPath)
+		},
+	}}
+	resp, err := client.Get("http://chaos/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello over uds" {
+		t.Errorf("Expected 'hello over uds', got '%s'", body)
+	}
+
+	srv.Shutdown()
+	if _, err := os.Stat(listenPath); !os.IsNotExist(err) {
+		t.Errorf("Expected listen socket to be removed on shutdown, got: %v", err)
+	}
+}
+
+func TestServer_RecordAndReplay(t *testing.T) {
+	upstream := newUpstream(t, "live data")
+	dir := t.TempDir()
+
+	cfg := proxyConfig(t, "api", upstream.URL)
+	cfg.Recording = &config.RecordingConfig{Mode: "record", Dir: dir}
+	recorder, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := recorder.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if code, body := get(t, recorder, "/users/1"); code != 200 || body != "live data" {
+		t.Fatalf("Expected 200 'live data' while recording, got %d '%s'", code, body)
+	}
+	recorder.Shutdown()
+	upstream.Close()
+
+	// The upstream is gone, replay still answers and chaos still applies
+	cfg.Recording.Mode = "replay"
+	cfg.Rules = []config.RuleConfig{
+		{Name: "broken", MatchConfig: config.MatchConfig{PathPrefix: "/broken"}, Chaos: config.FileConfig{ErrorRate: 100, ErrorCode: 503}},
+	}
+	replayer, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := replayer.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer replayer.Shutdown()
+
+	if code, body := get(t, replayer, "/users/1"); code != 200 || body != "live data" {
+		t.Errorf("Expected replayed 200 'live data', got %d '%s'", code, body)
+	}
+	if code, _ := get(t, replayer, "/users/2"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unrecorded request, got %d", code)
+	}
+	if code, _ := get(t, replayer, "/broken"); code != 503 {
+		t.Errorf("Expected chaos on top of replay, got %d", code)
+	}
+}
+
+func TestServer_RecordBelowPoolChaos(t *testing.T) {
+	upstream := newUpstream(t, "live data")
+	parsed, _ := url.Parse(upstream.URL)
+
+	cfg := config.ProxyConfig{Name: "pool", Mode: config.ModeReverse, Listen: "127.0.0.1:0"}
+	cfg.Upstreams = []config.BackendConfig{{
+		Name:       "one",
+		URL:        upstream.URL,
+		BackendURL: parsed,
+		Chaos:      config.FileConfig{ErrorRate: 100, ErrorCode: http.StatusBadGateway},
+	}}
+	cfg.Recording = &config.RecordingConfig{Mode: "record", Dir: t.TempDir()}
+
+	recorder, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := recorder.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if code, _ := get(t, recorder, "/users/1"); code != http.StatusBadGateway {
+		t.Fatalf("Expected the backend's chaos while recording, got %d", code)
+	}
+	recorder.Shutdown()
+
+	// The injected error never reached the upstream, so there's nothing to replay
+	cfg.Recording.Mode = "replay"
+	cfg.Upstreams[0].Chaos = config.FileConfig{}
+	replayer, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := replayer.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer replayer.Shutdown()
+
+	if code, _ := get(t, replayer, "/users/1"); code != http.StatusNotFound {
+		t.Errorf("Expected no recording of the injected error, got %d", code)
+	}
+}
+
+func TestServer_HAREndpoint(t *testing.T) {
+	upstream := newUpstream(t, "hello")
+
+	cfg := proxyConfig(t, "api", upstream.URL)
+	cfg.HAR = &config.HARConfig{Endpoint: "/_chaos/har", MaxEntries: 10}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	get(t, srv, "/users/1")
+
+	code, body := get(t, srv, "/_chaos/har")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	// The endpoint itself isn't captured
+	if !strings.Contains(body, "/users/1") || strings.Count(body, `"startedDateTime"`) != 1 {
+		t.Errorf("Expected exactly the proxied request in the capture, got %s", body)
+	}
+}
+
+func TestNew_InvalidStaleVersions(t *testing.T) {
+	cfg := proxyConfig(t, "api", "http://localhost:1")
+	cfg.Chaos.StaleRate = 10
+	cfg.Chaos.StaleVersions = 50
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for too many stale versions, got nil")
+	}
+}
+
+func TestNew_InvalidDuplicateCount(t *testing.T) {
+	for _, count := range []int{1, 11} {
+		cfg := proxyConfig(t, "api", "http://localhost:1")
+		cfg.Chaos.DuplicateRate = 10
+		cfg.Chaos.DuplicateCount = count
+
+		if _, err := New(cfg); err == nil {
+			t.Errorf("Expected error for duplicate_count %d, got nil", count)
+		}
+	}
+}
+
+func TestNew_InvalidPostFailureMode(t *testing.T) {
+	cfg := proxyConfig(t, "api", "http://localhost:1")
+	cfg.Chaos.PostFailureRate = 10
+	cfg.Chaos.PostFailureMode = "explode"
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for invalid post_failure_mode, got nil")
+	}
+}
+
+func TestNew_InvalidReorderOrder(t *testing.T) {
+	cfg := proxyConfig(t, "api", "http://localhost:1")
+	cfg.Chaos.ReorderRate = 10
+	cfg.Chaos.ReorderOrder = "sorted"
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for invalid reorder_order, got nil")
+	}
+}
+
+func TestNew_InvalidExpiry(t *testing.T) {
+	tests := map[string]config.FileConfig{
+		"both":             {ExpiresAfter: "1h", ActiveUntil: "2030-01-01T00:00:00Z"},
+		"not RFC 3339":     {ActiveUntil: "tomorrow"},
+		"not positive":     {ExpiresAfter: "-1m"},
+		"invalid duration": {ExpiresAfter: "a bit"},
+	}
+	for name, fc := range tests {
+		cfg := proxyConfig(t, "api", "http://localhost:1")
+		cfg.Chaos = fc
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestServer_ChaosExpired(t *testing.T) {
+	upstream := newUpstream(t, "hello")
+
+	cfg := proxyConfig(t, "api", upstream.URL)
+	cfg.Chaos = config.FileConfig{ErrorRate: 100, ActiveUntil: time.Now().Add(-time.Minute).Format(time.RFC3339)}
+	cfg.Routes = []config.RouteConfig{{
+		Name:        "other",
+		MatchConfig: config.MatchConfig{PathPrefix: "/other"},
+		Upstream:    upstream.URL,
+		UpstreamURL: cfg.UpstreamURL,
+		Chaos:       config.FileConfig{ErrorRate: 100},
+	}}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	for _, path := range []string{"/", "/other"} {
+		if code, body := get(t, srv, path); code != http.StatusOK || body != "hello" {
+			t.Errorf("%s: expected expired chaos to pass traffic through, got %d '%s'", path, code, body)
+		}
+	}
+}
+
+func TestServer_ChaosExpiredStaysOff(t *testing.T) {
+	upstream := newUpstream(t, "hello")
+
+	cfg := proxyConfig(t, "api", upstream.URL)
+	cfg.Chaos = config.FileConfig{ErrorRate: 100, ExpiresAfter: "50ms"}
+	cfg.Routes = []config.RouteConfig{{
+		Name:        "other",
+		MatchConfig: config.MatchConfig{PathPrefix: "/other"},
+		Upstream:    upstream.URL,
+		UpstreamURL: cfg.UpstreamURL,
+		Chaos:       config.FileConfig{ErrorRate: 100},
+	}}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// A reset goes back to the load's countdown, an update keeps the current one
+	snapshot := srv.SnapshotChaos()
+	if err := srv.Reset(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	live := srv.Live().Chaos
+	live.ErrorCode = 503
+	if err := srv.UpdateChaos(live); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.RestoreChaos(snapshot); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, path := range []string{"/", "/other"} {
+		if code, body := get(t, srv, path); code != http.StatusOK || body != "hello" {
+			t.Errorf("%s: expected expired chaos to stay off, got %d '%s'", path, code, body)
+		}
+	}
+
+	// Setting expires_after starts a new countdown, it reaches the routes too
+	live.ExpiresAfter = "1h"
+	if err := srv.SetChaos(live); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, path := range []string{"/", "/other"} {
+		if code, _ := get(t, srv, path); code == http.StatusOK {
+			t.Errorf("%s: expected chaos back on, got %d", path, code)
+		}
+	}
+}
+
+func TestServer_ForwardMITMEvents(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	certDir := t.TempDir()
+	cfg := proxyConfig(t, "egress", upstream.URL)
+	cfg.Mode = config.ModeForward
+	cfg.Forward = config.ForwardConfig{MITM: true, CertDir: certDir}
+	cfg.UpstreamTLS = &config.UpstreamTLSConfig{InsecureSkipVerify: true}
+
+	published := make(chan events.Event, 10)
+	defer events.Subscribe(func(e events.Event) { published <- e })()
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	caPEM, err := os.ReadFile(filepath.Join(certDir, "ca.crt"))
+	if err != nil {
+		t.Fatalf("Expected the MITM CA, got: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	proxyURL, _ := url.Parse("http://" + srv.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL), TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	resp, err := client.Get(upstream.URL + "/users?id=1")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// The decrypted request is published, the tunnel around it isn't
+	select {
+	case e := <-published:
+		if e.Method != http.MethodGet || e.Path != "/users" || e.Status != http.StatusOK || e.Proxy != "egress" {
+			t.Errorf("Expected the intercepted GET /users 200, got %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an event for the intercepted request")
+	}
+	client.CloseIdleConnections()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case e := <-published:
+		t.Errorf("Expected no event for the tunnel, got %+v", e)
+	default:
+	}
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	upstream := newUpstream(t, "hello")
+
+	cfg := proxyConfig(t, "api", upstream.URL)
+	cfg.RateLimit = &config.RateLimitConfig{Algorithm: "token_bucket", Limit: 2, WindowDuration: time.Minute, Key: "ip"}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	codes := make(map[int]int)
+	for i := 0; i < 3; i++ {
+		code, _ := get(t, srv, "/")
+		codes[code]++
+	}
+	if codes[http.StatusOK] != 2 || codes[http.StatusTooManyRequests] != 1 {
+		t.Errorf("Expected 2 requests through and 1 rejected, got %v", codes)
+	}
+}
+
+func TestServer_ControlHeaders(t *testing.T) {
+	var forwarded http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	cfg := proxyConfig(t, "api", upstream.URL)
+	cfg.Chaos.ErrorRate = 100
+	cfg.Control = &config.ControlConfig{Secret: "secret"}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer srv.Shutdown()
+
+	req, _ := http.NewRequest("GET", "http://"+srv.Addr().String()+"/", nil)
+	req.Header.Set("X-Chaos-Secret", "secret")
+	req.Header.Set("X-Chaos-Skip", "true")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected chaos to be skipped, got %d", resp.StatusCode)
+	}
+	if forwarded.Get("X-Chaos-Secret") != "" || forwarded.Get("X-Chaos-Skip") != "" {
+		t.Errorf("Expected control headers to be stripped, upstream got %v", forwarded)
+	}
+}
@@ -0,0 +1,208 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
+)
+
+const (
+	TokenBucket   = "token_bucket"
+	SlidingWindow = "sliding_window"
+)
+
+// What requests are counted by
+const (
+	KeyIP     = "ip"
+	KeyHeader = "header"
+	KeyRoute  = "route"
+)
+
+// Idle clients are forgotten once this many are tracked
+const maxKeys = 10000
+
+type Options struct {
+	Algorithm string        // TokenBucket or SlidingWindow
+	Limit     int           // Requests per window
+	Window    time.Duration // The period Limit applies to
+	Burst     int           // Token bucket capacity, Limit by default
+	Key       string        // KeyIP, KeyHeader or KeyRoute
+	Header    string        // Header holding the API key for KeyHeader
+
+	Deadline *chaos.Deadline // Every request is let through after it, like expired chaos
+	Switch   *chaos.Switch   // Every request is let through while it's off
+}
+
+// Result of counting one request
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // Until the full limit is available again
+	RetryAfter time.Duration // Until the next request is allowed, 0 when allowed
+}
+
+// bucket is a token bucket holding up to Burst tokens, refilled at Limit per
+// Window
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter counts requests per key the way API gateways do. Unlike the chaos
+// rates it's deterministic, a client over the limit is always rejected.
+type Limiter struct {
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	windows map[string][]time.Time // Sliding window, times of the requests still in it
+}
+
+func New(opts Options) *Limiter {
+	if opts.Burst <= 0 {
+		opts.Burst = opts.Limit
+	}
+	return &Limiter{
+		opts:    opts,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+		windows: make(map[string][]time.Time),
+	}
+}
+
+// Allow counts a request for key
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.buckets)+len(l.windows) >= maxKeys {
+		l.sweep(now)
+	}
+	if l.opts.Algorithm == SlidingWindow {
+		return l.slidingWindow(key, now)
+	}
+	return l.tokenBucket(key, now)
+}
+
+func (l *Limiter) tokenBucket(key string, now time.Time) Result {
+	capacity := float64(l.opts.Burst)
+	// Time it takes to refill n tokens
+	refill := func(n float64) time.Duration {
+		return time.Duration(math.Ceil(n * float64(l.opts.Window) / float64(l.opts.Limit)))
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(capacity, b.tokens+float64(now.Sub(b.last))*float64(l.opts.Limit)/float64(l.opts.Window))
+	b.last = now
+
+	res := Result{Allowed: b.tokens >= 1, Limit: l.opts.Limit}
+	if res.Allowed {
+		b.tokens--
+	} else {
+		res.RetryAfter = refill(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = refill(capacity - b.tokens)
+	return res
+}
+
+func (l *Limiter) slidingWindow(key string, now time.Time) Result {
+	times := l.windows[key]
+
+	// Drop requests that left the window
+	start := now.Add(-l.opts.Window)
+	i := 0
+	for i < len(times) && !times[i].After(start) {
+		i++
+	}
+	times = times[i:]
+
+	res := Result{Allowed: len(times) < l.opts.Limit, Limit: l.opts.Limit}
+	if res.Allowed {
+		times = append(times, now)
+	} else {
+		res.RetryAfter = times[0].Add(l.opts.Window).Sub(now)
+	}
+	l.windows[key] = times
+
+	res.Remaining = l.opts.Limit - len(times)
+	res.Reset = times[len(times)-1].Add(l.opts.Window).Sub(now)
+	return res
+}
+
+// sweep forgets clients that are back at their full limit
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.opts.Window {
+			delete(l.buckets, key)
+		}
+	}
+	for key, times := range l.windows {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= l.opts.Window {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// Middleware rejects requests over the limit with 429. route is what
+// requests are counted by with KeyRoute, the request's host when empty.
+func (l *Limiter) Middleware(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if killswitch.Engaged() || l.opts.Deadline.Passed(l.now()) || !l.opts.Switch.On() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := l.key(r, route)
+		res := l.Allow(key)
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+
+		if !res.Allowed {
+			fmt.Printf("[RATELIMIT] %s %s rejected, retry in %v\n", r.Method, r.URL.Path, res.RetryAfter.Round(time.Millisecond))
+			w.Header().Set("Retry-After", strconv.Itoa(max(seconds(res.RetryAfter), 1)))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *Limiter) key(r *http.Request, route string) string {
+	switch l.opts.Key {
+	case KeyHeader:
+		return r.Header.Get(l.opts.Header)
+	case KeyRoute:
+		if route == "" {
+			return r.Host
+		}
+		return route
+	default:
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+}
+
+// seconds rounds d up to whole seconds, like clients read the headers
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,166 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+)
+
+// newLimiter returns a limiter with a clock the test moves by hand
+func newLimiter(opts Options) (*Limiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(opts)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestTokenBucket(t *testing.T) {
+	l, now := newLimiter(Options{Algorithm: TokenBucket, Limit: 2, Window: time.Second})
+
+	for i := 0; i < 2; i++ {
+		if res := l.Allow("a"); !res.Allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	res := l.Allow("a")
+	if res.Allowed {
+		t.Fatal("Expected the third request to be rejected")
+	}
+	if res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected to retry after one token (500ms), got %v", res.RetryAfter)
+	}
+	if res.Remaining != 0 || res.Reset != time.Second {
+		t.Errorf("Expected 0 remaining and a full bucket in 1s, got %d and %v", res.Remaining, res.Reset)
+	}
+
+	// Other clients have their own bucket
+	if !l.Allow("b").Allowed {
+		t.Error("Expected another key to be allowed")
+	}
+
+	*now = now.Add(500 * time.Millisecond)
+	if !l.Allow("a").Allowed {
+		t.Error("Expected a refilled token to be used")
+	}
+}
+
+func TestTokenBucket_Burst(t *testing.T) {
+	l, _ := newLimiter(Options{Algorithm: TokenBucket, Limit: 1, Window: time.Second, Burst: 3})
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if l.Allow("a").Allowed {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("Expected a burst of 3, got %d", allowed)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	l, now := newLimiter(Options{Algorithm: SlidingWindow, Limit: 2, Window: time.Minute})
+
+	l.Allow("a")
+	*now = now.Add(20 * time.Second)
+	if res := l.Allow("a"); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("Expected the second request to use up the limit, got %+v", res)
+	}
+
+	*now = now.Add(10 * time.Second)
+	res := l.Allow("a")
+	if res.Allowed {
+		t.Fatal("Expected the third request to be rejected")
+	}
+	// The first request leaves the window 60s after it was made
+	if res.RetryAfter != 30*time.Second {
+		t.Errorf("Expected to retry after 30s, got %v", res.RetryAfter)
+	}
+	if res.Reset != 50*time.Second {
+		t.Errorf("Expected the window to be empty in 50s, got %v", res.Reset)
+	}
+
+	*now = now.Add(30 * time.Second)
+	if !l.Allow("a").Allowed {
+		t.Error("Expected a request once the first left the window")
+	}
+}
+
+func TestMiddleware_Headers(t *testing.T) {
+	l := New(Options{Limit: 1, Window: time.Minute, Key: KeyHeader, Header: "X-API-Key"})
+	handler := l.Middleware("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("one")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Limit") != "1" || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("Expected 200 with rate limit headers, got %d %v", rec.Code, rec.Header())
+	}
+
+	rec = send("one")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Expected Retry-After 60, got '%s'", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Reset"); got != "60" {
+		t.Errorf("Expected X-RateLimit-Reset 60, got '%s'", got)
+	}
+
+	if rec := send("two"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another API key to be allowed, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_KeyByRoute(t *testing.T) {
+	l := New(Options{Limit: 1, Window: time.Minute, Key: KeyRoute})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	users, orders := l.Middleware("users", ok), l.Middleware("orders", ok)
+
+	users.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+
+	rec := httptest.NewRecorder()
+	orders.ServeHTTP(rec, httptest.NewRequest("GET", "/orders", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected routes to be limited separately, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	users.ServeHTTP(rec, httptest.NewRequest("GET", "/users", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_Expired(t *testing.T) {
+	deadline := chaos.NewDeadline(time.Date(2026, 1, 1, 0, 0, 30, 0, time.UTC))
+	l, now := newLimiter(Options{Limit: 1, Window: time.Minute, Deadline: deadline})
+	handler := l.Middleware("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.Code
+	}
+
+	send()
+	if code := send(); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 before the deadline, got %d", code)
+	}
+
+	*now = now.Add(31 * time.Second) // Still inside the window, past the deadline
+	if code := send(); code != http.StatusOK {
+		t.Errorf("Expected requests through once chaos expired, got %d", code)
+	}
+}
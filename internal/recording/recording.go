@@ -0,0 +1,295 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+// Responses bigger than this are passed through but not recorded, request
+// bodies bigger than this can't be matched
+const maxRecordedBody = 10 << 20
+
+var errBodyTooLarge = errors.New("request body too large to match")
+
+// Request headers whose values are never written to disk
+var redactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+type failedKey struct{}
+
+// Failed marks the response to r as the proxy's own, e.g. a 502 because the
+// upstream couldn't be reached, so it isn't recorded
+func Failed(r *http.Request) {
+	if failed, ok := r.Context().Value(failedKey{}).(*atomic.Bool); ok {
+		failed.Store(true)
+	}
+}
+
+// Entry is one recorded request/response pair, stored as JSON
+type Entry struct {
+	Key        string    `json:"key"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Request    Request   `json:"request"`
+	Response   Response  `json:"response"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Store keeps recordings in a directory, one subdirectory per upstream so
+// routes with stripped prefixes can't overwrite each other
+type Store struct {
+	dir       string
+	matchBody bool
+}
+
+// NewStore creates dir if needed. With matchBody the request body is part of
+// the lookup key on top of method, path and query.
+func NewStore(dir string, matchBody bool) (*Store, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	return &Store{dir: dir, matchBody: matchBody}, nil
+}
+
+// Record forwards to next and saves every response it produces under name
+func (s *Store) Record(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, reqBody, err := s.key(r)
+		if errors.Is(err, errBodyTooLarge) {
+			slog.Warn("request too large to record", "path", r.URL.Path)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		failed := new(atomic.Bool)
+		rec := &capturingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), failedKey{}, failed)))
+
+		if failed.Load() {
+			fmt.Printf("[RECORD] %s %s -> %d not recorded, the upstream didn't answer\n", r.Method, r.URL.RequestURI(), rec.status)
+			return
+		}
+		if rec.overflow {
+			slog.Warn("response too large to record", "path", r.URL.Path)
+			return
+		}
+
+		header := r.Header.Clone()
+		for _, name := range redactedHeaders {
+			if header.Get(name) != "" {
+				header.Set(name, "REDACTED")
+			}
+		}
+		entry := Entry{
+			Key:        key,
+			RecordedAt: time.Now(),
+			Request: Request{
+				Method: r.Method,
+				URL:    r.URL.RequestURI(),
+				Header: header,
+				Body:   reqBody,
+			},
+			Response: Response{
+				Status: rec.status,
+				Header: rec.Header().Clone(),
+				Body:   rec.body.Bytes(),
+			},
+		}
+		if err := s.save(name, entry); err != nil {
+			slog.Error("failed to save recording", "path", r.URL.Path, "error", err)
+			return
+		}
+		fmt.Printf("[RECORD] %s %s -> %d\n", r.Method, r.URL.RequestURI(), rec.status)
+	})
+}
+
+// Replay serves recordings saved under name, 404 when there's none
+func (s *Store) Replay(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _, err := s.key(r)
+		if errors.Is(err, errBodyTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		entry, err := s.load(name, key)
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("[REPLAY] %s %s -> no recording\n", r.Method, r.URL.RequestURI())
+			http.Error(w, fmt.Sprintf("no recording for %s %s", r.Method, r.URL.RequestURI()), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("failed to load recording", "path", r.URL.Path, "error", err)
+			http.Error(w, "failed to load recording", http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Printf("[REPLAY] %s %s -> %d\n", r.Method, r.URL.RequestURI(), entry.Response.Status)
+		for k, v := range entry.Response.Header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(entry.Response.Body)))
+		w.WriteHeader(entry.Response.Status)
+		w.Write(entry.Response.Body)
+	})
+}
+
+// key identifies r by method, path, query and optionally body. The body is
+// only read with body matching, up to maxRecordedBody, and put back.
+func (s *Store) key(r *http.Request) (string, []byte, error) {
+	// Encode sorts by key, so parameter order doesn't matter
+	key := r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode()
+	if !s.matchBody {
+		return key, nil, nil
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxRecordedBody+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil {
+			return "", nil, err
+		}
+		if len(body) > maxRecordedBody {
+			return "", nil, errBodyTooLarge
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	key += " " + hex.EncodeToString(sum[:])
+	return key, body, nil
+}
+
+func (s *Store) path(name, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, sanitize(name), hex.EncodeToString(sum[:16])+".json")
+}
+
+func (s *Store) save(name string, entry Entry) error {
+	path := s.path(name, entry.Key)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename, so replay never sees half a file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".recording-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Store) load(name, key string) (Entry, error) {
+	data, err := os.ReadFile(s.path(name, key))
+	if err != nil {
+		return Entry{}, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, fmt.Errorf("corrupt recording: %w", err)
+	}
+	return entry, nil
+}
+
+// sanitize keeps route names from escaping the recording directory
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.Trim(name, "."))
+}
+
+// capturingWriter copies everything written to the client
+type capturingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	overflow    bool
+}
+
+func (cw *capturingWriter) WriteHeader(code int) {
+	if !cw.wroteHeader {
+		cw.status = code
+		cw.wroteHeader = true
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *capturingWriter) Write(b []byte) (int, error) {
+	cw.wroteHeader = true
+	if !cw.overflow {
+		if cw.body.Len()+len(b) > maxRecordedBody {
+			cw.overflow = true
+			cw.body.Reset()
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *capturingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,198 @@
+package recording
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countingUpstream answers with the request path and counts its calls
+func countingUpstream(calls *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("recorded " + r.URL.RequestURI()))
+	})
+}
+
+func TestStore_RecordThenReplay(t *testing.T) {
+	store, err := NewStore(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var calls int
+	rec := httptest.NewRecorder()
+	store.Record("api", countingUpstream(&calls)).ServeHTTP(rec, httptest.NewRequest("GET", "/users?b=2&a=1", nil))
+	if rec.Code != http.StatusCreated || calls != 1 {
+		t.Fatalf("Expected recording to pass through, got %d after %d calls", rec.Code, calls)
+	}
+
+	// Query parameter order doesn't matter
+	rec = httptest.NewRecorder()
+	store.Replay("api").ServeHTTP(rec, httptest.NewRequest("GET", "/users?a=1&b=2", nil))
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected replayed status 201, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-Upstream"); got != "yes" {
+		t.Errorf("Expected replayed header, got '%s'", got)
+	}
+	if body := rec.Body.String(); body != "recorded /users?b=2&a=1" {
+		t.Errorf("Expected replayed body, got '%s'", body)
+	}
+	if calls != 1 {
+		t.Errorf("Expected replay not to call the upstream, got %d calls", calls)
+	}
+}
+
+func TestStore_RecordSkipsFailed(t *testing.T) {
+	store, _ := NewStore(t.TempDir(), false)
+
+	unreachable := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Failed(r)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	store.Record("api", unreachable).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+
+	rec := httptest.NewRecorder()
+	store.Replay("api").ServeHTTP(rec, httptest.NewRequest("GET", "/users", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the proxy's own 502 not to be recorded, got %d", rec.Code)
+	}
+}
+
+func TestStore_RecordRedactsCredentials(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewStore(dir, false)
+
+	var calls int
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Cookie", "session=secret-cookie")
+	req.Header.Set("Proxy-Authorization", "Basic secret-proxy")
+	req.Header.Set("Accept", "application/json")
+	store.Record("api", countingUpstream(&calls)).ServeHTTP(httptest.NewRecorder(), req)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "api", "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 recording, got %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("Expected credentials to be redacted, got %s", data)
+	}
+	if !strings.Contains(string(data), "application/json") {
+		t.Errorf("Expected other headers to be kept, got %s", data)
+	}
+}
+
+func TestStore_ReplayMissing(t *testing.T) {
+	store, _ := NewStore(t.TempDir(), false)
+
+	rec := httptest.NewRecorder()
+	store.Replay("api").ServeHTTP(rec, httptest.NewRequest("GET", "/nothing", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without a recording, got %d", rec.Code)
+	}
+}
+
+func TestStore_MatchBody(t *testing.T) {
+	var calls int
+	post := func(store *Store, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		store.Replay("api").ServeHTTP(rec, httptest.NewRequest("POST", "/search", strings.NewReader(body)))
+		return rec
+	}
+
+	withBody, _ := NewStore(t.TempDir(), true)
+	withBody.Record("api", countingUpstream(&calls)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/search", strings.NewReader(`{"q": "a"}`)))
+
+	if rec := post(withBody, `{"q": "a"}`); rec.Code != http.StatusCreated {
+		t.Errorf("Expected same body to replay, got %d", rec.Code)
+	}
+	if rec := post(withBody, `{"q": "b"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected different body not to match, got %d", rec.Code)
+	}
+
+	withoutBody, _ := NewStore(t.TempDir(), false)
+	withoutBody.Record("api", countingUpstream(&calls)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/search", strings.NewReader(`{"q": "a"}`)))
+
+	if rec := post(withoutBody, `{"q": "b"}`); rec.Code != http.StatusCreated {
+		t.Errorf("Expected body to be ignored, got %d", rec.Code)
+	}
+}
+
+func TestStore_RecordKeepsRequestBody(t *testing.T) {
+	store, _ := NewStore(t.TempDir(), true)
+
+	var seen string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen = string(body)
+	})
+	store.Record("api", upstream).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+
+	if seen != "payload" {
+		t.Errorf("Expected upstream to still receive the body, got '%s'", seen)
+	}
+}
+
+func TestStore_LargeRequestBody(t *testing.T) {
+	store, _ := NewStore(t.TempDir(), true)
+	large := strings.Repeat("a", maxRecordedBody+1)
+
+	var seen int
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen = len(body)
+	})
+	store.Record("api", upstream).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(large)))
+
+	if seen != len(large) {
+		t.Errorf("Expected upstream to receive the whole body, got %d bytes", seen)
+	}
+
+	rec := httptest.NewRecorder()
+	store.Replay("api").ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(large)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", rec.Code)
+	}
+}
+
+func TestStore_NamesAreSeparate(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewStore(dir, false)
+
+	var calls int
+	store.Record("orders", countingUpstream(&calls)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/42", nil))
+
+	rec := httptest.NewRecorder()
+	store.Replay("users").ServeHTTP(rec, httptest.NewRequest("GET", "/42", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected recordings to be per name, got %d", rec.Code)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "orders")); err != nil {
+		t.Errorf("Expected recordings under orders/, got: %v", err)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]string{
+		"orders":      "orders",
+		"../../etc":   "_.._etc",
+		"users/admin": "users_admin",
+	}
+	for in, want := range tests {
+		if got := sanitize(in); got != want {
+			t.Errorf("sanitize(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package roundtrip
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand" // #nosec G404 - math/rand is sufficient for chaos testing, cryptographic randomness not required
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
+)
+
+// Rates (0-100 percentage) for faults on the proxy's own upstream connections
+type Faults struct {
+	DNSErrorRate   float64
+	DialErrorRate  float64
+	TLSErrorRate   float64
+	ResetReuseRate float64
+	SlowDialRate   float64
+	SlowDial       time.Duration
+	Deadline       *chaos.Deadline // No faults after it, shared with the proxy's chaos
+	Switch         *chaos.Switch   // No faults while it's off
+}
+
+// Fault picked for a single upstream round trip
+type Fault int
+
+const (
+	FaultNone Fault = iota
+	FaultDNS
+	FaultDial
+	FaultTLS
+	FaultResetReuse
+)
+
+func (f Fault) String() string {
+	switch f {
+	case FaultDNS:
+		return "DNS Resolution Failure"
+	case FaultDial:
+		return "Connection Refused"
+	case FaultTLS:
+		return "Upstream TLS Failure"
+	case FaultResetReuse:
+		return "Reset Reused Connection"
+	default:
+		return "None"
+	}
+}
+
+var errInjectedTLS = errors.New("chaos: injected upstream TLS failure")
+
+type planKey struct{}
+
+// plan is what a faulted request's dial has to do
+type plan struct {
+	fault    Fault
+	slowDial time.Duration
+}
+
+// RoundTripper injects connection-level faults into upstream requests. Faulted
+// requests are sent over a transport without keep-alives so they really dial,
+// and the errors come out of the stdlib transport itself. That way the
+// ReverseProxy sees them exactly like a real outage, e.g. a 502 from its
+// ErrorHandler.
+type RoundTripper struct {
+	base    *http.Transport
+	fresh   *http.Transport // Always dials, used for dial/DNS/slow faults
+	freshTL *http.Transport // Always dials and fails TLS verification
+	faults  Faults
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// New wraps base. base keeps serving every request that isn't faulted.
+func New(base *http.Transport, faults Faults) *RoundTripper {
+	dial := base.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second}).DialContext
+	}
+
+	fresh := base.Clone()
+	fresh.DisableKeepAlives = true
+	fresh.DialContext = faultyDial(dial)
+
+	freshTLS := fresh.Clone()
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base.TLSClientConfig != nil {
+		tlsConfig = base.TLSClientConfig.Clone()
+	}
+	// The handshake really happens, then the client aborts it with an alert
+	tlsConfig.VerifyConnection = func(tls.ConnectionState) error {
+		return errInjectedTLS
+	}
+	freshTLS.TLSClientConfig = tlsConfig
+
+	return &RoundTripper{
+		base:    base,
+		fresh:   fresh,
+		freshTL: freshTLS,
+		faults:  faults,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())), // #nosec G404 - chaos testing doesn't need crypto rand
+	}
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if killswitch.Engaged() || rt.expired() || !rt.faults.Switch.On() {
+		return rt.base.RoundTrip(req)
+	}
+
+	p := rt.decide()
+	if p.fault == FaultNone && p.slowDial == 0 {
+		return rt.base.RoundTrip(req)
+	}
+
+	if p.slowDial > 0 {
+		fmt.Printf("[CHAOS] Slowing upstream dial: %v\n", p.slowDial)
+	}
+	if p.fault != FaultNone {
+		fmt.Printf("[CHAOS] Injecting transport fault: %s\n", p.fault)
+	}
+
+	switch p.fault {
+	case FaultResetReuse:
+		return rt.base.RoundTrip(withResetOnReuse(req))
+	case FaultTLS:
+		if req.URL.Scheme != "https" {
+			// Nothing to break on a plaintext upstream
+			return rt.base.RoundTrip(req)
+		}
+		return rt.freshTL.RoundTrip(req.WithContext(context.WithValue(req.Context(), planKey{}, p)))
+	default:
+		return rt.fresh.RoundTrip(req.WithContext(context.WithValue(req.Context(), planKey{}, p)))
+	}
+}
+
+// CloseIdleConnections lets callers drain every underlying transport
+func (rt *RoundTripper) CloseIdleConnections() {
+	rt.base.CloseIdleConnections()
+	rt.fresh.CloseIdleConnections()
+	rt.freshTL.CloseIdleConnections()
+}
+
+func (rt *RoundTripper) decide() plan {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	var p plan
+	if rt.shouldApply(rt.faults.SlowDialRate) {
+		p.slowDial = rt.faults.SlowDial
+	}
+
+	switch {
+	case rt.shouldApply(rt.faults.DNSErrorRate):
+		p.fault = FaultDNS
+	case rt.shouldApply(rt.faults.DialErrorRate):
+		p.fault = FaultDial
+	case rt.shouldApply(rt.faults.TLSErrorRate):
+		p.fault = FaultTLS
+	case rt.shouldApply(rt.faults.ResetReuseRate):
+		p.fault = FaultResetReuse
+	}
+	return p
+}
+
+func (rt *RoundTripper) expired() bool {
+	return rt.faults.Deadline.Passed(time.Now())
+}
+
+func (rt *RoundTripper) shouldApply(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 100 {
+		return true
+	}
+	return rt.rnd.Float64()*100 < rate
+}
+
+// faultyDial fails or slows the dial according to the plan in ctx, mimicking
+// the errors net.Dialer returns for the real thing
+func faultyDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		p, _ := ctx.Value(planKey{}).(plan)
+
+		if p.slowDial > 0 {
+			select {
+			case <-time.After(p.slowDial):
+			case <-ctx.Done():
+				return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+			}
+		}
+
+		switch p.fault {
+		case FaultDNS:
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			return nil, &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{
+				Err:        "no such host",
+				Name:       host,
+				IsNotFound: true,
+			}}
+		case FaultDial:
+			return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+		}
+
+		return dial(ctx, network, addr)
+	}
+}
+
+// withResetOnReuse resets the connection if the transport hands out a pooled
+// one, like a server that closed its side of an idle keep-alive connection.
+// Go retries idempotent requests on a fresh connection, just like in
+// production, everything else fails.
+func withResetOnReuse(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				reset(info.Conn)
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+func reset(conn net.Conn) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		// Linger 0 sends an RST instead of a FIN
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
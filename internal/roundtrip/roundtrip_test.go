@@ -0,0 +1,178 @@
+package roundtrip
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newUpstream(t *testing.T, tlsEnabled bool) *httptest.Server {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	})
+
+	var srv *httptest.Server
+	if tlsEnabled {
+		srv = httptest.NewTLSServer(handler)
+	} else {
+		srv = httptest.NewServer(handler)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func baseTransport(srv *httptest.Server) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if srv.TLS != nil {
+		transport.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	}
+	return transport
+}
+
+// proxyVia puts a ReverseProxy using rt in front of upstream
+func proxyVia(t *testing.T, upstream *httptest.Server, rt http.RoundTripper) *httptest.Server {
+	t.Helper()
+	u, _ := url.Parse(upstream.URL)
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.Transport = rt
+	srv := httptest.NewServer(proxy)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRoundTripper_NoFaults(t *testing.T) {
+	upstream := newUpstream(t, false)
+	rt := New(baseTransport(upstream), Faults{})
+
+	req, _ := http.NewRequest("GET", upstream.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestRoundTripper_DNSError(t *testing.T) {
+	upstream := newUpstream(t, false)
+	rt := New(baseTransport(upstream), Faults{DNSErrorRate: 100})
+
+	req, _ := http.NewRequest("GET", upstream.URL, nil)
+	_, err := rt.RoundTrip(req)
+
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("Expected a not found DNS error, got: %v", err)
+	}
+}
+
+func TestRoundTripper_DialError(t *testing.T) {
+	upstream := newUpstream(t, false)
+	rt := New(baseTransport(upstream), Faults{DialErrorRate: 100})
+
+	req, _ := http.NewRequest("GET", upstream.URL, nil)
+	_, err := rt.RoundTrip(req)
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("Expected connection refused, got: %v", err)
+	}
+}
+
+func TestRoundTripper_SlowDial(t *testing.T) {
+	upstream := newUpstream(t, false)
+	rt := New(baseTransport(upstream), Faults{SlowDialRate: 100, SlowDial: 50 * time.Millisecond})
+
+	start := time.Now()
+	req, _ := http.NewRequest("GET", upstream.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Expected slow dial to still succeed, got: %v", err)
+	}
+	resp.Body.Close()
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected at least 50ms, took %v", elapsed)
+	}
+}
+
+func TestRoundTripper_TLSError(t *testing.T) {
+	upstream := newUpstream(t, true)
+	rt := New(baseTransport(upstream), Faults{TLSErrorRate: 100})
+
+	req, _ := http.NewRequest("GET", upstream.URL, nil)
+	_, err := rt.RoundTrip(req)
+	if !errors.Is(err, errInjectedTLS) {
+		t.Errorf("Expected injected TLS failure, got: %v", err)
+	}
+}
+
+func TestRoundTripper_TLSErrorIgnoredForPlaintext(t *testing.T) {
+	upstream := newUpstream(t, false)
+	rt := New(baseTransport(upstream), Faults{TLSErrorRate: 100})
+
+	req, _ := http.NewRequest("GET", upstream.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Expected no error for a plaintext upstream, got: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestRoundTripper_ProxyReturns502(t *testing.T) {
+	upstream := newUpstream(t, false)
+	proxySrv := proxyVia(t, upstream, New(baseTransport(upstream), Faults{DialErrorRate: 100}))
+
+	resp, err := http.Get(proxySrv.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", resp.StatusCode)
+	}
+}
+
+func TestRoundTripper_ResetReuse(t *testing.T) {
+	upstream := newUpstream(t, false)
+	rt := New(baseTransport(upstream), Faults{ResetReuseRate: 100})
+
+	post := func() (*http.Response, error) {
+		req, _ := http.NewRequest("POST", upstream.URL, strings.NewReader("payload"))
+		// Like a proxied request, whose body can't be rewound
+		req.GetBody = nil
+		return rt.RoundTrip(req)
+	}
+
+	// The first request dials, nothing to reuse yet
+	resp, err := post()
+	if err != nil {
+		t.Fatalf("Expected first request to succeed, got: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// The pooled connection is reset and POST isn't retried
+	if _, err := post(); err == nil {
+		t.Error("Expected reused connection to fail")
+	}
+
+	// GET is idempotent, Go retries it on a fresh connection
+	req, _ := http.NewRequest("GET", upstream.URL, nil)
+	resp, err = rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Expected GET to be retried, got: %v", err)
+	}
+	resp.Body.Close()
+}
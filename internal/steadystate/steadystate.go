@@ -0,0 +1,252 @@
+package steadystate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+	"github.com/khizar-sudo/chaos-proxy/internal/events"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
+)
+
+// Responses kept per proxy for the traffic probes
+const maxSamples = 100000
+
+type sample struct {
+	at       time.Time
+	ok       bool
+	duration time.Duration
+}
+
+// Monitor checks the steady-state hypothesis while chaos is on. When a probe
+// keeps failing for its `for`, the kill switch is engaged and onBreach is
+// called with the reason, e.g. to abort experiments.
+type Monitor struct {
+	cfg      config.SteadyStateConfig
+	onBreach func(reason string)
+	client   *http.Client
+
+	proxies map[string]bool // Proxies with traffic probes
+	window  time.Duration   // The longest window of them
+
+	mu           sync.Mutex
+	samples      map[string][]sample  // Recent responses per proxy
+	failingSince map[string]time.Time // Per probe, while it fails
+
+	unsubscribe func()
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+func New(cfg config.SteadyStateConfig, onBreach func(reason string)) *Monitor {
+	proxies := make(map[string]bool)
+	var window time.Duration
+	for _, probe := range cfg.Probes {
+		if probe.Proxy != "" {
+			proxies[probe.Proxy] = true
+			window = max(window, probe.WindowDuration)
+		}
+	}
+
+	return &Monitor{
+		cfg:          cfg,
+		proxies:      proxies,
+		window:       window,
+		onBreach:     onBreach,
+		client:       &http.Client{},
+		samples:      make(map[string][]sample),
+		failingSince: make(map[string]time.Time),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start collects the proxies' responses and checks the probes in the
+// background until Stop is called
+func (m *Monitor) Start() {
+	m.unsubscribe = events.Subscribe(m.add)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.cfg.IntervalDuration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.check(time.Now())
+			case <-m.done:
+				return
+			}
+		}
+	}()
+	slog.Info("steady state probes enabled", "probes", len(m.cfg.Probes), "interval", m.cfg.IntervalDuration)
+}
+
+func (m *Monitor) Stop() {
+	close(m.done)
+	m.wg.Wait()
+	if m.unsubscribe != nil {
+		m.unsubscribe()
+	}
+}
+
+// Config returns the configuration the monitor was built from
+func (m *Monitor) Config() config.SteadyStateConfig {
+	return m.cfg
+}
+
+func (m *Monitor) add(e events.Event) {
+	if !m.proxies[e.Proxy] {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	at := e.Start.Add(e.Duration)
+	samples := append(m.samples[e.Proxy], sample{
+		at:       at,
+		ok:       e.Status != 0 && e.Status < 500,
+		duration: e.Duration,
+	})
+
+	// Forget what no window reaches anymore
+	i := 0
+	for i < len(samples) && (samples[i].at.Before(at.Add(-m.window)) || len(samples)-i > maxSamples) {
+		i++
+	}
+	m.samples[e.Proxy] = samples[i:]
+}
+
+// check runs every probe once. Nothing is checked while the kill switch is
+// engaged, there is no chaos to blame.
+func (m *Monitor) check(now time.Time) {
+	if killswitch.Engaged() {
+		m.mu.Lock()
+		clear(m.failingSince)
+		m.mu.Unlock()
+		return
+	}
+
+	for _, probe := range m.cfg.Probes {
+		failure := m.probe(probe, now)
+
+		m.mu.Lock()
+		if failure == "" {
+			delete(m.failingSince, probe.Name)
+			m.mu.Unlock()
+			continue
+		}
+		since, failing := m.failingSince[probe.Name]
+		if !failing {
+			since = now
+			m.failingSince[probe.Name] = now
+		}
+		m.mu.Unlock()
+
+		fmt.Printf("[STEADY] Probe %q failed: %s\n", probe.Name, failure)
+		if now.Sub(since) >= probe.ForDuration {
+			m.breach(probe, failure, now.Sub(since))
+			return
+		}
+	}
+}
+
+func (m *Monitor) breach(probe config.ProbeConfig, failure string, failingFor time.Duration) {
+	reason := fmt.Sprintf("steady state probe %q failed: %s", probe.Name, failure)
+	if failingFor > 0 {
+		reason += fmt.Sprintf(" for %v", failingFor.Round(time.Second))
+	}
+	slog.Error("steady state hypothesis failed, turning all chaos off", "reason", reason)
+
+	killswitch.Set(true)
+	if m.onBreach != nil {
+		m.onBreach(reason)
+	}
+
+	m.mu.Lock()
+	clear(m.failingSince)
+	m.mu.Unlock()
+}
+
+// probe runs one probe, returning why it failed or "" when it passed
+func (m *Monitor) probe(probe config.ProbeConfig, now time.Time) string {
+	if probe.URL != "" {
+		return m.probeURL(probe)
+	}
+	return m.probeProxy(probe, now)
+}
+
+func (m *Monitor) probeURL(probe config.ProbeConfig) string {
+	ctx, cancel := context.WithTimeout(context.Background(), probe.TimeoutDuration)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.URL, nil)
+	if err != nil {
+		return err.Error()
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err.Error()
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+
+	if probe.ExpectStatus != 0 && resp.StatusCode != probe.ExpectStatus {
+		return fmt.Sprintf("status %d, expected %d", resp.StatusCode, probe.ExpectStatus)
+	}
+	if probe.ExpectStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return fmt.Sprintf("status %d, expected 2xx", resp.StatusCode)
+	}
+	return ""
+}
+
+// probeProxy judges the proxy's responses within the window. Without
+// traffic there's nothing to judge, the probe passes.
+func (m *Monitor) probeProxy(probe config.ProbeConfig, now time.Time) string {
+	start := now.Add(-probe.WindowDuration)
+	m.mu.Lock()
+	var recent []sample
+	for _, s := range m.samples[probe.Proxy] {
+		if !s.at.Before(start) {
+			recent = append(recent, s)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(recent) == 0 {
+		return ""
+	}
+
+	if probe.MinSuccessRate > 0 {
+		ok := 0
+		for _, s := range recent {
+			if s.ok {
+				ok++
+			}
+		}
+		rate := float64(ok) * 100 / float64(len(recent))
+		if rate < probe.MinSuccessRate {
+			return fmt.Sprintf("success rate %.1f%% < %v%% over %v", rate, probe.MinSuccessRate, probe.WindowDuration)
+		}
+	}
+
+	if probe.MaxP99Duration > 0 {
+		durations := make([]time.Duration, len(recent))
+		for i, s := range recent {
+			durations[i] = s.duration
+		}
+		slices.Sort(durations)
+		p99 := durations[(len(durations)*99+99)/100-1]
+		if p99 > probe.MaxP99Duration {
+			return fmt.Sprintf("p99 %v > %v over %v", p99.Round(time.Millisecond), probe.MaxP99Duration, probe.WindowDuration)
+		}
+	}
+	return ""
+}
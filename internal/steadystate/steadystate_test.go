@@ -0,0 +1,127 @@
+package steadystate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+	"github.com/khizar-sudo/chaos-proxy/internal/events"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
+)
+
+func monitor(t *testing.T, probes ...config.ProbeConfig) (*Monitor, *[]string) {
+	t.Helper()
+	t.Cleanup(func() { killswitch.Set(false) })
+
+	var reasons []string
+	m := New(config.SteadyStateConfig{IntervalDuration: time.Second, Probes: probes}, func(reason string) {
+		reasons = append(reasons, reason)
+	})
+	return m, &reasons
+}
+
+// traffic adds n responses of proxy api with status, ending at now
+func traffic(m *Monitor, now time.Time, n, status int, d time.Duration) {
+	for i := 0; i < n; i++ {
+		m.add(events.Event{Proxy: "api", Status: status, Start: now.Add(-d), Duration: d})
+	}
+}
+
+func TestMonitor_SuccessRate(t *testing.T) {
+	m, reasons := monitor(t, config.ProbeConfig{
+		Name: "errors", Proxy: "api", MinSuccessRate: 95, WindowDuration: 30 * time.Second, ForDuration: 30 * time.Second,
+	})
+	now := time.Now()
+
+	traffic(m, now, 95, 200, time.Millisecond)
+	traffic(m, now, 5, 503, time.Millisecond)
+	m.check(now)
+	if len(*reasons) != 0 || killswitch.Engaged() {
+		t.Fatal("Expected a 95% success rate to pass")
+	}
+
+	traffic(m, now, 10, 0, time.Millisecond)
+	m.check(now)
+	if len(*reasons) != 0 {
+		t.Fatal("Expected no abort before the probe failed for 30s")
+	}
+
+	m.check(now.Add(31 * time.Second))
+	if len(*reasons) != 0 {
+		t.Fatal("Expected the failures to have left the window")
+	}
+
+	later := now.Add(time.Minute)
+	traffic(m, later, 10, 500, time.Millisecond)
+	m.check(later)
+	traffic(m, later.Add(30*time.Second), 10, 500, time.Millisecond)
+	m.check(later.Add(30 * time.Second))
+	if len(*reasons) != 1 || !strings.Contains((*reasons)[0], `"errors"`) {
+		t.Fatalf("Expected an abort after 30s of failures, got %v", *reasons)
+	}
+	if !killswitch.Engaged() {
+		t.Error("Expected the kill switch to be engaged")
+	}
+
+	// Nothing is judged while chaos is off
+	m.check(later.Add(time.Minute))
+	if len(*reasons) != 1 {
+		t.Errorf("Expected no more aborts while the kill switch is engaged, got %v", *reasons)
+	}
+}
+
+func TestMonitor_P99(t *testing.T) {
+	m, reasons := monitor(t, config.ProbeConfig{
+		Name: "latency", Proxy: "api", MaxP99Duration: 100 * time.Millisecond, WindowDuration: 30 * time.Second,
+	})
+	now := time.Now()
+
+	traffic(m, now, 99, 200, 10*time.Millisecond)
+	traffic(m, now, 1, 200, time.Second)
+	m.check(now)
+	if len(*reasons) != 0 {
+		t.Fatalf("Expected one slow request in 100 to pass, got %v", *reasons)
+	}
+
+	traffic(m, now, 5, 200, time.Second)
+	m.check(now)
+	if len(*reasons) != 1 || !strings.Contains((*reasons)[0], "p99") {
+		t.Errorf("Expected an abort for the p99, got %v", *reasons)
+	}
+}
+
+func TestMonitor_URL(t *testing.T) {
+	healthy := true
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer health.Close()
+
+	m, reasons := monitor(t, config.ProbeConfig{Name: "health", URL: health.URL, TimeoutDuration: time.Second})
+	now := time.Now()
+
+	m.check(now)
+	if len(*reasons) != 0 {
+		t.Fatalf("Expected a healthy URL to pass, got %v", *reasons)
+	}
+
+	healthy = false
+	m.check(now)
+	if len(*reasons) != 1 || !strings.Contains((*reasons)[0], "503") {
+		t.Errorf("Expected an abort with the status, got %v", *reasons)
+	}
+}
+
+func TestMonitor_NoTraffic(t *testing.T) {
+	m, reasons := monitor(t, config.ProbeConfig{Name: "errors", Proxy: "api", MinSuccessRate: 99, WindowDuration: time.Second})
+
+	m.check(time.Now())
+	if len(*reasons) != 0 {
+		t.Errorf("Expected a proxy without traffic to pass, got %v", *reasons)
+	}
+}
@@ -0,0 +1,101 @@
+package stub
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+)
+
+// Cap on how much of the request body templates can see
+const maxTemplateBody = 1 << 20
+
+// Response is a canned response served instead of calling an upstream
+type Response struct {
+	Status  int
+	Headers map[string]string
+	Body    []byte
+}
+
+// Request data available to body templates, e.g. {{.Query.Get "id"}}
+type Data struct {
+	Method string
+	Host   string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   string
+}
+
+// Handler serves a Response, rendering its body as a Go template if asked to
+type Handler struct {
+	resp Response
+	tmpl *template.Template
+}
+
+// New creates a handler for resp. With isTemplate the body is parsed as a
+// text/template executed against Data for every request.
+func New(resp Response, isTemplate bool) (*Handler, error) {
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+
+	h := &Handler{resp: resp}
+	if isTemplate {
+		tmpl, err := template.New("body").Parse(string(resp.Body))
+		if err != nil {
+			return nil, fmt.Errorf("invalid body template: %w", err)
+		}
+		h.tmpl = tmpl
+	}
+	return h, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := h.resp.Body
+	if h.tmpl != nil {
+		var err error
+		body, err = h.render(r)
+		if err != nil {
+			slog.Error("stub template failed", "path", r.URL.Path, "error", err)
+			http.Error(w, "stub template failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	fmt.Printf("[STUB] %s %s -> %d\n", r.Method, r.URL.Path, h.resp.Status)
+
+	for k, v := range h.resp.Headers {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(h.resp.Status)
+	w.Write(body)
+}
+
+func (h *Handler) render(r *http.Request) ([]byte, error) {
+	data := Data{
+		Method: r.Method,
+		Host:   r.Host,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header,
+	}
+	if r.Body != nil {
+		reqBody, err := io.ReadAll(io.LimitReader(r.Body, maxTemplateBody))
+		if err != nil {
+			return nil, err
+		}
+		data.Body = string(reqBody)
+	}
+
+	var buf bytes.Buffer
+	if err := h.tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package stub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler_StaticResponse(t *testing.T) {
+	h, err := New(Response{
+		Status:  http.StatusCreated,
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    []byte(`{"id": 1}`),
+	}, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/users", nil))
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got '%s'", ct)
+	}
+	if body := rec.Body.String(); body != `{"id": 1}` {
+		t.Errorf("Expected stub body, got '%s'", body)
+	}
+}
+
+func TestHandler_DefaultStatus(t *testing.T) {
+	h, _ := New(Response{Body: []byte("ok")}, false)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+}
+
+func TestHandler_Template(t *testing.T) {
+	h, err := New(Response{
+		Body: []byte(`{{.Method}} {{.Path}} id={{.Query.Get "id"}} user={{.Header.Get "X-User"}} body={{.Body}}`),
+	}, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	req := httptest.NewRequest("PUT", "/users?id=42", strings.NewReader("payload"))
+	req.Header.Set("X-User", "alice")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	expected := "PUT /users id=42 user=alice body=payload"
+	if body := rec.Body.String(); body != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, body)
+	}
+}
+
+func TestNew_InvalidTemplate(t *testing.T) {
+	if _, err := New(Response{Body: []byte("{{.Method")}, true); err == nil {
+		t.Error("Expected error for invalid template, got nil")
+	}
+}
+
+func TestHandler_TemplateExecutionError(t *testing.T) {
+	h, err := New(Response{Body: []byte("{{.Missing}}")}, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rec.Code)
+	}
+}
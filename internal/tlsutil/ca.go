@@ -0,0 +1,267 @@
+package tlsutil
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	caCertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+)
+
+// Leaf certificates kept, clients pick the SNI so the least recently used go
+const maxCachedLeaves = 1000
+
+// CA is a local certificate authority used to issue leaf certificates on the fly
+type CA struct {
+	Cert    *x509.Certificate
+	CertPEM []byte
+	key     crypto.Signer
+
+	mu    sync.Mutex
+	cache map[string]*list.Element // Of *cachedLeaf
+	lru   *list.List               // Most recently used first
+}
+
+type cachedLeaf struct {
+	key  string
+	cert *tls.Certificate
+}
+
+// LoadOrCreateCA reads ca.crt/ca.key from dir, generating and writing a new
+// self-signed CA if they don't exist yet
+func LoadOrCreateCA(dir string) (*CA, error) {
+	certPath := filepath.Join(dir, caCertFile)
+	keyPath := filepath.Join(dir, caKeyFile)
+
+	certPEM, certErr := os.ReadFile(certPath) // #nosec G304 - path comes from the operator's config
+	keyPEM, keyErr := os.ReadFile(keyPath)    // #nosec G304 - path comes from the operator's config
+	if certErr == nil && keyErr == nil {
+		return parseCA(certPEM, keyPEM)
+	}
+	if !errors.Is(certErr, os.ErrNotExist) && certErr != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", certErr)
+	}
+	if !errors.Is(keyErr, os.ErrNotExist) && keyErr != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", keyErr)
+	}
+
+	ca, keyPEM, err := NewCA()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create cert directory: %w", err)
+	}
+	if err := os.WriteFile(certPath, ca.CertPEM, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write CA key: %w", err)
+	}
+
+	return ca, nil
+}
+
+// NewCA generates a fresh self-signed CA in memory. The PEM encoded private
+// key is returned so the caller can persist it.
+func NewCA() (*CA, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "chaos-proxy local CA", Organization: []string{"chaos-proxy"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(5, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode CA key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	ca, err := parseCA(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, keyPEM, nil
+}
+
+func parseCA(certPEM, keyPEM []byte) (*CA, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA key pair: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate %q is not a CA", cert.Subject.CommonName)
+	}
+
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", pair.PrivateKey)
+	}
+
+	return &CA{
+		Cert:    cert,
+		CertPEM: certPEM,
+		key:     signer,
+		cache:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}, nil
+}
+
+// Issue signs a leaf certificate for the given hosts with the given validity window
+func (ca *CA) Issue(hosts []string, notBefore, notAfter time.Time) (*tls.Certificate, error) {
+	return issue(hosts, notBefore, notAfter, ca.Cert, ca.key)
+}
+
+// SelfSigned creates a leaf certificate that is signed by its own key and
+// therefore chains to no trusted root
+func SelfSigned(hosts []string, notBefore, notAfter time.Time) (*tls.Certificate, error) {
+	return issue(hosts, notBefore, notAfter, nil, nil)
+}
+
+func issue(hosts []string, notBefore, notAfter time.Time, parent *x509.Certificate, parentKey crypto.Signer) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"chaos-proxy"}},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if len(hosts) > 0 {
+		tmpl.Subject.CommonName = hosts[0]
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// Leaf returns a cached certificate for hosts, issuing a new one when needed
+func (ca *CA) Leaf(hosts ...string) (*tls.Certificate, error) {
+	key := strings.Join(hosts, ",")
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if el, ok := ca.cache[key]; ok {
+		cached := el.Value.(*cachedLeaf)
+		if time.Now().Before(cached.cert.Leaf.NotAfter.Add(-time.Hour)) {
+			ca.lru.MoveToFront(el)
+			return cached.cert, nil
+		}
+		ca.lru.Remove(el)
+		delete(ca.cache, key)
+	}
+
+	cert, err := ca.Issue(hosts, time.Now().Add(-time.Hour), time.Now().AddDate(1, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+	ca.cache[key] = ca.lru.PushFront(&cachedLeaf{key: key, cert: cert})
+	if ca.lru.Len() > maxCachedLeaves {
+		oldest := ca.lru.Remove(ca.lru.Back()).(*cachedLeaf)
+		delete(ca.cache, oldest.key)
+	}
+	return cert, nil
+}
+
+// GetCertificate returns a tls.Config.GetCertificate callback that issues
+// certificates for the SNI name the client asked for, falling back to
+// fallbackHosts when there is none
+func (ca *CA) GetCertificate(fallbackHosts []string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if len(fallbackHosts) == 0 {
+		fallbackHosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if hello.ServerName == "" {
+			return ca.Leaf(fallbackHosts...)
+		}
+		return ca.Leaf(hello.ServerName)
+	}
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,134 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateCA_WritesAndReloads(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+
+	ca, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !ca.Cert.IsCA {
+		t.Error("Expected generated certificate to be a CA")
+	}
+
+	for _, name := range []string{"ca.crt", "ca.key"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Expected %s to be written: %v", name, err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("Expected %s to have mode 0600, got %v", name, info.Mode().Perm())
+		}
+	}
+
+	reloaded, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatalf("Expected no error on reload, got: %v", err)
+	}
+	if !reloaded.Cert.Equal(ca.Cert) {
+		t.Error("Expected the existing CA to be reused")
+	}
+}
+
+func TestLoadOrCreateCA_InvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "ca.crt"), []byte("garbage"), 0o600)
+	os.WriteFile(filepath.Join(dir, "ca.key"), []byte("garbage"), 0o600)
+
+	if _, err := LoadOrCreateCA(dir); err == nil {
+		t.Error("Expected error for invalid CA files, got nil")
+	}
+}
+
+func TestCA_IssueVerifies(t *testing.T) {
+	ca, _, err := NewCA()
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	cert, err := ca.Issue([]string{"api.example.com", "127.0.0.1"}, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	for _, name := range []string{"api.example.com", "127.0.0.1"} {
+		if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("Expected certificate to verify for %s: %v", name, err)
+		}
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "other.example.com", Roots: roots}); err == nil {
+		t.Error("Expected verification to fail for a different host")
+	}
+}
+
+func TestSelfSigned_DoesNotChainToCA(t *testing.T) {
+	ca, _, _ := NewCA()
+
+	cert, err := SelfSigned([]string{"localhost"}, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: roots}); err == nil {
+		t.Error("Expected self-signed certificate to fail verification")
+	}
+}
+
+func TestCA_GetCertificate(t *testing.T) {
+	ca, _, _ := NewCA()
+	get := ca.GetCertificate(nil)
+
+	cert, err := get(&tls.ClientHelloInfo{ServerName: "svc.internal"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cert.Leaf.Subject.CommonName != "svc.internal" {
+		t.Errorf("Expected certificate for svc.internal, got %s", cert.Leaf.Subject.CommonName)
+	}
+
+	again, _ := get(&tls.ClientHelloInfo{ServerName: "svc.internal"})
+	if again != cert {
+		t.Error("Expected certificate to be cached")
+	}
+
+	fallback, err := get(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := fallback.Leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("Expected fallback certificate to cover localhost: %v", err)
+	}
+}
+
+func TestCA_LeafCacheBounded(t *testing.T) {
+	ca, _, _ := NewCA()
+
+	first, _ := ca.Leaf("first.test")
+	for i := 0; i < maxCachedLeaves; i++ {
+		if _, err := ca.Leaf(fmt.Sprintf("host-%d.test", i)); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	if len(ca.cache) != maxCachedLeaves || ca.lru.Len() != maxCachedLeaves {
+		t.Errorf("Expected the cache to stay at %d certificates, got %d", maxCachedLeaves, len(ca.cache))
+	}
+	if again, _ := ca.Leaf("first.test"); again == first {
+		t.Error("Expected the least recently used certificate to be evicted")
+	}
+}
@@ -0,0 +1,80 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Options for the proxy's outgoing TLS connections to the upstream
+type ClientOptions struct {
+	CAFile             string // PEM bundle added to the system roots
+	CertFile           string // Client certificate for mTLS
+	KeyFile            string
+	ServerName         string // Overrides the SNI / verification name
+	InsecureSkipVerify bool
+}
+
+// ServerConfig builds a listener TLS config from a cert/key pair on disk
+func ServerConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load listener certificate: %w", err)
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
+
+// AutoServerConfig builds a listener TLS config whose certificates are issued
+// by a local CA stored in dir. The CA is created on first use so clients can
+// be pointed at dir/ca.crt.
+func AutoServerConfig(dir string, hosts []string) (*tls.Config, *CA, error) {
+	ca, err := LoadOrCreateCA(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: ca.GetCertificate(hosts),
+	}, ca, nil
+}
+
+// ClientConfig builds the TLS config used by the upstream transport
+func ClientConfig(opts ClientOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify, // #nosec G402 - opt-in for lab use
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upstream CA bundle: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in upstream CA bundle %s", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load upstream client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
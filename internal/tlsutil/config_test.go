@@ -0,0 +1,138 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair writes cert to disk as PEM files and returns their paths
+func writePair(t *testing.T, cert *tls.Certificate) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certPath, keyPath
+}
+
+func TestServerConfig_LoadsPair(t *testing.T) {
+	cert, _ := SelfSigned([]string{"localhost"}, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+	certPath, keyPath := writePair(t, cert)
+
+	cfg, err := ServerConfig(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(cfg.Certificates) != 1 {
+		t.Errorf("Expected 1 certificate, got %d", len(cfg.Certificates))
+	}
+}
+
+func TestServerConfig_MissingFiles(t *testing.T) {
+	if _, err := ServerConfig("/nonexistent/tls.crt", "/nonexistent/tls.key"); err == nil {
+		t.Error("Expected error for missing files, got nil")
+	}
+}
+
+func TestClientConfig_CABundleAndServerName(t *testing.T) {
+	ca, _, _ := NewCA()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	leaf, _ := ca.Issue([]string{"upstream.internal"}, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{*leaf}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.crt")
+	os.WriteFile(caPath, ca.CertPEM, 0o600)
+
+	cfg, err := ClientConfig(ClientOptions{CAFile: caPath, ServerName: "upstream.internal"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, got: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "ok" {
+		t.Errorf("Expected body 'ok', got '%s'", body)
+	}
+
+	// Without the server name override verification has to fail
+	cfg, _ = ClientConfig(ClientOptions{CAFile: caPath})
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Error("Expected verification error without server_name override")
+	}
+}
+
+func TestClientConfig_InvalidCABundle(t *testing.T) {
+	caPath := filepath.Join(t.TempDir(), "ca.crt")
+	os.WriteFile(caPath, []byte("not a certificate"), 0o600)
+
+	if _, err := ClientConfig(ClientOptions{CAFile: caPath}); err == nil {
+		t.Error("Expected error for invalid CA bundle, got nil")
+	}
+}
+
+func TestClientConfig_ClientCertificate(t *testing.T) {
+	cert, _ := SelfSigned([]string{"client"}, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+	certPath, keyPath := writePair(t, cert)
+
+	cfg, err := ClientConfig(ClientOptions{CertFile: certPath, KeyFile: keyPath, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(cfg.Certificates) != 1 {
+		t.Errorf("Expected client certificate to be loaded")
+	}
+	if !cfg.InsecureSkipVerify {
+		t.Error("Expected InsecureSkipVerify to be set")
+	}
+}
+
+func TestAutoServerConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, ca, err := AutoServerConfig(dir, []string{"localhost"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.GetCertificate == nil {
+		t.Fatal("Expected GetCertificate to be set")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ca.crt")); err != nil {
+		t.Errorf("Expected CA certificate on disk: %v", err)
+	}
+
+	cert, err := cfg.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: roots}); err != nil {
+		t.Errorf("Expected certificate to chain to the CA: %v", err)
+	}
+}
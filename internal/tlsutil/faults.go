@@ -0,0 +1,215 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand" // #nosec G404 - math/rand is sufficient for chaos testing, cryptographic randomness not required
+	"sync"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/chaos"
+	"github.com/khizar-sudo/chaos-proxy/internal/killswitch"
+)
+
+// Host used for certificates issued by the wrong-host fault
+const wrongHost = "wrong-host.chaos-proxy.invalid"
+
+// Rates (0-100 percentage) for each handshake fault on the listener
+type Faults struct {
+	DelayRate        float64
+	Delay            time.Duration
+	AbortRate        float64
+	AlertRate        float64
+	ExpiredRate      float64
+	SelfSignedRate   float64
+	WrongHostRate    float64
+	DowngradeRate    float64
+	DowngradeVersion uint16          // Highest TLS version offered when downgrading
+	Deadline         *chaos.Deadline // No faults after it, shared with the proxy's chaos
+	Switch           *chaos.Switch   // No faults while it's off
+}
+
+// Handshake fault picked for a single client hello
+type HandshakeFault int
+
+const (
+	FaultNone HandshakeFault = iota
+	FaultAbort
+	FaultAlert
+	FaultExpired
+	FaultSelfSigned
+	FaultWrongHost
+	FaultDowngrade
+)
+
+func (f HandshakeFault) String() string {
+	switch f {
+	case FaultAbort:
+		return "Aborted Handshake"
+	case FaultAlert:
+		return "Mid-Handshake Alert"
+	case FaultExpired:
+		return "Expired Certificate"
+	case FaultSelfSigned:
+		return "Self-Signed Certificate"
+	case FaultWrongHost:
+		return "Wrong Hostname Certificate"
+	case FaultDowngrade:
+		return "Protocol/Cipher Downgrade"
+	default:
+		return "None"
+	}
+}
+
+var errInjected = errors.New("chaos: injected TLS handshake failure")
+
+type faultInjector struct {
+	base   *tls.Config
+	ca     *CA
+	faults Faults
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// WithFaults wraps base so that each handshake may be delayed or broken
+// according to faults. Broken certificates are issued by ca when one is
+// available so they fail for the intended reason only; otherwise they are
+// self-signed.
+func WithFaults(base *tls.Config, ca *CA, faults Faults) *tls.Config {
+	if faults.DowngradeVersion == 0 {
+		faults.DowngradeVersion = tls.VersionTLS10
+	}
+
+	fi := &faultInjector{
+		base:   base,
+		ca:     ca,
+		faults: faults,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())), // #nosec G404 - chaos testing doesn't need crypto rand
+	}
+
+	cfg := base.Clone()
+	cfg.GetConfigForClient = fi.configForClient
+	return cfg
+}
+
+// decide picks an optional delay and at most one terminal fault
+func (fi *faultInjector) decide() (time.Duration, HandshakeFault) {
+	if killswitch.Engaged() || fi.faults.Deadline.Passed(time.Now()) || !fi.faults.Switch.On() {
+		return 0, FaultNone
+	}
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	var delay time.Duration
+	if fi.shouldApply(fi.faults.DelayRate) {
+		delay = fi.faults.Delay
+	}
+
+	ordered := []struct {
+		rate  float64
+		fault HandshakeFault
+	}{
+		{fi.faults.AbortRate, FaultAbort},
+		{fi.faults.AlertRate, FaultAlert},
+		{fi.faults.ExpiredRate, FaultExpired},
+		{fi.faults.SelfSignedRate, FaultSelfSigned},
+		{fi.faults.WrongHostRate, FaultWrongHost},
+		{fi.faults.DowngradeRate, FaultDowngrade},
+	}
+	for _, o := range ordered {
+		if fi.shouldApply(o.rate) {
+			return delay, o.fault
+		}
+	}
+	return delay, FaultNone
+}
+
+func (fi *faultInjector) shouldApply(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 100 {
+		return true
+	}
+	return fi.rnd.Float64()*100 < rate
+}
+
+func (fi *faultInjector) configForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	delay, fault := fi.decide()
+
+	if delay > 0 {
+		fmt.Printf("[CHAOS] Delaying TLS handshake: %v\n", delay)
+		select {
+		case <-time.After(delay):
+		case <-hello.Context().Done():
+			return nil, hello.Context().Err()
+		}
+	}
+
+	if fault == FaultNone {
+		// Fall through to the regular config
+		return nil, nil
+	}
+
+	fmt.Printf("[CHAOS] Injecting TLS fault: %s\n", fault)
+
+	host := hello.ServerName
+	if host == "" {
+		host = "localhost"
+	}
+	now := time.Now()
+
+	switch fault {
+	case FaultAbort:
+		// Close the socket without an alert, like a crashed or filtered peer
+		_ = hello.Conn.Close()
+		return nil, errInjected
+	case FaultAlert:
+		cfg := fi.base.Clone()
+		// The server sends its full flight before failing, so the client
+		// sees a fatal alert halfway through the handshake
+		cfg.ClientAuth = tls.RequestClientCert
+		cfg.VerifyConnection = func(tls.ConnectionState) error {
+			return errInjected
+		}
+		return cfg, nil
+	case FaultExpired:
+		return fi.withCert(fi.sign([]string{host}, now.AddDate(-1, 0, 0), now.Add(-24*time.Hour)))
+	case FaultSelfSigned:
+		return fi.withCert(SelfSigned([]string{host}, now.Add(-time.Hour), now.AddDate(0, 0, 7)))
+	case FaultWrongHost:
+		return fi.withCert(fi.sign([]string{wrongHost}, now.Add(-time.Hour), now.AddDate(0, 0, 7)))
+	case FaultDowngrade:
+		cfg := fi.base.Clone()
+		cfg.MinVersion = tls.VersionTLS10
+		cfg.MaxVersion = fi.faults.DowngradeVersion
+		// Only CBC/SHA1 suites are left, TLS 1.3 suites can't be restricted
+		cfg.CipherSuites = []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		}
+		return cfg, nil
+	}
+
+	return nil, nil
+}
+
+func (fi *faultInjector) sign(hosts []string, notBefore, notAfter time.Time) (*tls.Certificate, error) {
+	if fi.ca != nil {
+		return fi.ca.Issue(hosts, notBefore, notAfter)
+	}
+	return SelfSigned(hosts, notBefore, notAfter)
+}
+
+func (fi *faultInjector) withCert(cert *tls.Certificate, err error) (*tls.Config, error) {
+	if err != nil {
+		return nil, err
+	}
+	cfg := fi.base.Clone()
+	cfg.GetCertificate = nil
+	cfg.Certificates = []tls.Certificate{*cert}
+	return cfg, nil
+}
@@ -0,0 +1,180 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTLSServer accepts connections on a TLS listener using cfg and
+// completes the handshake on each of them
+func startTLSServer(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if err := conn.(*tls.Conn).Handshake(); err != nil {
+					return
+				}
+				conn.Write([]byte("ok"))
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func newFaultServer(t *testing.T, faults Faults) (string, *x509.CertPool) {
+	t.Helper()
+
+	ca, _, err := NewCA()
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: ca.GetCertificate(nil)}
+	addr := startTLSServer(t, WithFaults(base, ca, faults))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	return addr, roots
+}
+
+// dial performs a handshake and reads the server's greeting
+func dial(addr string, cfg *tls.Config) error {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 2 * time.Second}, "tcp", addr, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2)
+	if _, err := conn.Read(buf); err != nil {
+		return err
+	}
+	if string(buf) != "ok" {
+		return errors.New("unexpected greeting " + string(buf))
+	}
+	return nil
+}
+
+func TestWithFaults_NoFaults(t *testing.T) {
+	addr, roots := newFaultServer(t, Faults{})
+
+	if err := dial(addr, &tls.Config{RootCAs: roots, ServerName: "localhost"}); err != nil {
+		t.Errorf("Expected clean handshake, got: %v", err)
+	}
+}
+
+func TestWithFaults_Delay(t *testing.T) {
+	delay := 200 * time.Millisecond
+	addr, roots := newFaultServer(t, Faults{DelayRate: 100, Delay: delay})
+
+	start := time.Now()
+	if err := dial(addr, &tls.Config{RootCAs: roots, ServerName: "localhost"}); err != nil {
+		t.Fatalf("Expected delayed handshake to succeed, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("Expected handshake to take at least %v, took %v", delay, elapsed)
+	}
+}
+
+func TestWithFaults_CertificateFaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		faults  Faults
+		wantErr string
+	}{
+		{"expired", Faults{ExpiredRate: 100}, "expired"},
+		{"self-signed", Faults{SelfSignedRate: 100}, "unknown authority"},
+		{"wrong host", Faults{WrongHostRate: 100}, "not localhost"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, roots := newFaultServer(t, tt.faults)
+
+			err := dial(addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+			if err == nil {
+				t.Fatal("Expected handshake to fail, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestWithFaults_Abort(t *testing.T) {
+	addr, roots := newFaultServer(t, Faults{AbortRate: 100})
+
+	if err := dial(addr, &tls.Config{RootCAs: roots, ServerName: "localhost"}); err == nil {
+		t.Error("Expected aborted handshake to fail, got nil")
+	}
+}
+
+func TestWithFaults_Alert(t *testing.T) {
+	addr, roots := newFaultServer(t, Faults{AlertRate: 100})
+
+	err := dial(addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err == nil {
+		t.Fatal("Expected handshake alert, got nil")
+	}
+	if !strings.Contains(err.Error(), "remote error") {
+		t.Errorf("Expected a TLS alert from the server, got: %v", err)
+	}
+}
+
+func TestWithFaults_Downgrade(t *testing.T) {
+	addr, roots := newFaultServer(t, Faults{DowngradeRate: 100, DowngradeVersion: tls.VersionTLS12})
+
+	// A client insisting on TLS 1.3 must be refused
+	if err := dial(addr, &tls.Config{RootCAs: roots, ServerName: "localhost", MinVersion: tls.VersionTLS13}); err == nil {
+		t.Error("Expected TLS 1.3-only client to fail against a downgraded server")
+	}
+
+	// A permissive client negotiates the weak suite
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		RootCAs:      roots,
+		ServerName:   "localhost",
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	})
+	if err != nil {
+		t.Fatalf("Expected permissive client to connect, got: %v", err)
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if state.Version != tls.VersionTLS12 {
+		t.Errorf("Expected TLS 1.2, got %x", state.Version)
+	}
+	if state.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA {
+		t.Errorf("Expected downgraded cipher suite, got %s", tls.CipherSuiteName(state.CipherSuite))
+	}
+}
+
+func TestHandshakeFault_String(t *testing.T) {
+	if FaultExpired.String() != "Expired Certificate" {
+		t.Errorf("Unexpected name %q", FaultExpired.String())
+	}
+	if FaultNone.String() != "None" {
+		t.Errorf("Unexpected name %q", FaultNone.String())
+	}
+}
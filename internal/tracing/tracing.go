@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// W3C trace context header, see https://www.w3.org/TR/trace-context/
+const Header = "traceparent"
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// Parent is the trace context a request came in with
+type Parent struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// ParseParent reads a traceparent header value. ok is false when it's
+// missing or malformed, the request then starts a new trace.
+func ParseParent(value string) (p Parent, ok bool) {
+	// version-traceid-spanid-flags, later versions may append fields
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return Parent{}, false
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return Parent{}, false
+	}
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		return Parent{}, false
+	}
+	if _, err := hex.Decode(p.TraceID[:], []byte(parts[1])); err != nil {
+		return Parent{}, false
+	}
+	if _, err := hex.Decode(p.SpanID[:], []byte(parts[2])); err != nil {
+		return Parent{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || p.TraceID == (TraceID{}) || p.SpanID == (SpanID{}) {
+		return Parent{}, false
+	}
+	p.Sampled = flags[0]&1 == 1
+	return p, true
+}
+
+// Span is the proxy hop of one request
+type Span struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID // Zero for the root of a trace
+	Name       string
+	Start, End time.Time
+	Attributes []Attribute
+	Error      string // Span status message, empty when the request went fine
+}
+
+// NewSpan opens the span of a request, as a child of parent unless it's the
+// zero Parent
+func NewSpan(name string, parent Parent) *Span {
+	s := &Span{Name: name, Start: time.Now()}
+	if parent.TraceID != (TraceID{}) {
+		s.TraceID, s.ParentID = parent.TraceID, parent.SpanID
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+	rand.Read(s.SpanID[:])
+	return s
+}
+
+// Traceparent is the header value that makes the upstream's spans children
+// of s
+func (s *Span) Traceparent() string {
+	return "00-" + s.TraceID.String() + "-" + s.SpanID.String() + "-01"
+}
+
+// Set adds an attribute, value is a string, bool, int, int64 or float64
+func (s *Span) Set(key string, value any) {
+	s.Attributes = append(s.Attributes, Attribute{Key: key, Value: value})
+}
+
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// The exporter spans go to, nil while tracing is off
+var current atomic.Pointer[Exporter]
+
+// Enabled reports whether spans are exported, so requests can skip the work
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Export queues s for the running exporter, if there is one
+func Export(s *Span) {
+	if e := current.Load(); e != nil {
+		e.add(s)
+	}
+}
@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/khizar-sudo/chaos-proxy/internal/config"
+)
+
+func TestParseParent(t *testing.T) {
+	tests := []struct {
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true, true},
+		{"", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01", false, false},
+	}
+
+	for _, tt := range tests {
+		p, ok := ParseParent(tt.value)
+		if ok != tt.ok || p.Sampled != tt.sampled {
+			t.Errorf("%q: expected ok=%v sampled=%v, got ok=%v sampled=%v", tt.value, tt.ok, tt.sampled, ok, p.Sampled)
+		}
+	}
+
+	p, _ := ParseParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if p.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || p.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("Unexpected parent: %s %s", p.TraceID, p.SpanID)
+	}
+}
+
+func TestNewSpan(t *testing.T) {
+	parent, _ := ParseParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	child := NewSpan("GET", parent)
+	if child.TraceID != parent.TraceID || child.ParentID != parent.SpanID || child.SpanID == parent.SpanID {
+		t.Errorf("Expected a child of the parent, got %+v", child)
+	}
+	if p, ok := ParseParent(child.Traceparent()); !ok || p.SpanID != child.SpanID || !p.Sampled {
+		t.Errorf("Expected a valid traceparent for the span, got %q", child.Traceparent())
+	}
+
+	root := NewSpan("GET", Parent{})
+	if root.TraceID == (TraceID{}) || root.ParentID != (SpanID{}) {
+		t.Errorf("Expected a new trace, got %+v", root)
+	}
+}
+
+func TestExporter(t *testing.T) {
+	received := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected headers: %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer collector.Close()
+
+	exporter := NewExporter(config.TracingConfig{
+		Endpoint:    collector.URL + "/v1/traces",
+		ServiceName: "chaos-proxy",
+		Headers:     map[string]string{"X-Api-Key": "secret"},
+	})
+	exporter.Start()
+	if !Enabled() {
+		t.Fatal("Expected tracing to be enabled")
+	}
+
+	span := NewSpan("GET", Parent{})
+	span.End = span.Start.Add(250 * time.Millisecond)
+	span.Set("chaos.latency_ms", int64(250))
+	span.Set("chaos.corrupt.strategy", "truncate")
+	span.Error = "error 503 injected by chaos"
+	Export(span)
+	exporter.Stop() // Sends what's queued
+
+	if Enabled() {
+		t.Error("Expected tracing to be off once stopped")
+	}
+
+	var req otlpRequest
+	select {
+	case body := <-received:
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("Expected OTLP JSON, got %s: %v", body, err)
+		}
+	default:
+		t.Fatal("Expected the span to be exported")
+	}
+
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	got := spans[0]
+	if got.TraceID != span.TraceID.String() || got.SpanID != span.SpanID.String() || got.ParentSpanID != "" {
+		t.Errorf("Unexpected ids: %+v", got)
+	}
+	if got.Status.Code != statusCodeError || got.Status.Message != "error 503 injected by chaos" {
+		t.Errorf("Expected an error status, got %+v", got.Status)
+	}
+	if len(got.Attributes) != 2 || got.Attributes[0].Value["intValue"] != "250" || got.Attributes[1].Value["stringValue"] != "truncate" {
+		t.Errorf("Unexpected attributes: %+v", got.Attributes)
+	}
+	if service := req.ResourceSpans[0].Resource.Attributes[0]; service.Value["stringValue"] != "chaos-proxy" {
+		t.Errorf("Expected service.name chaos-proxy, got %+v", service)
+	}
+}
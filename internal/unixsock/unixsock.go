@@ -0,0 +1,161 @@
+package unixsock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheme prefix for socket addresses, e.g. unix:///run/chaos.sock
+const Prefix = "unix://"
+
+// Path returns the socket path of a unix:// address
+func Path(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, Prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, Prefix), true
+}
+
+// Listen binds a unix socket at path and sets its permissions. A stale socket
+// left behind by a crashed process is removed first, a socket something is
+// still listening on is not. The file is removed again when the listener is
+// closed.
+func Listen(path string, perm fs.FileMode) (net.Listener, error) {
+	if err := removeStale(path); err != nil {
+		return nil, err
+	}
+
+	// Bind in a private directory and move the socket into place once it has
+	// its permissions, so it's never reachable with the umask's
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	ln.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, perm); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return &listener{UnixListener: ln, path: path}, nil
+}
+
+// listener removes its socket file once closed, it was bound under another name
+type listener struct {
+	*net.UnixListener
+	path string
+	once sync.Once
+}
+
+func (l *listener) Close() error {
+	err := l.UnixListener.Close()
+	l.once.Do(func() { os.Remove(l.path) })
+	return err
+}
+
+func removeStale(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is already in use", path)
+	}
+
+	return os.Remove(path)
+}
+
+// Placeholder hosts end in this, .invalid never resolves so no real host can
+// be mistaken for a socket
+const placeholderSuffix = ".unix.invalid"
+
+// Sockets maps unix upstreams onto placeholder http hosts, so the reverse
+// proxy can treat them like any other upstream while the transport dials the
+// socket instead
+type Sockets struct {
+	mu     sync.Mutex
+	byHost map[string]string
+	byPath map[string]string
+}
+
+func NewSockets() *Sockets {
+	return &Sockets{
+		byHost: make(map[string]string),
+		byPath: make(map[string]string),
+	}
+}
+
+// Target returns the URL to proxy to. unix:// URLs become
+// http://<name>.unix.invalid, where name is derived from the socket name,
+// anything else is returned as is.
+func (s *Sockets) Target(u *url.URL) *url.URL {
+	if u == nil || u.Scheme != "unix" {
+		return u
+	}
+	path := u.Host + u.Path
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	host, ok := s.byPath[path]
+	if !ok {
+		host = filepath.Base(path) + placeholderSuffix
+		for i := 2; s.byHost[host] != ""; i++ {
+			host = fmt.Sprintf("%s-%d%s", filepath.Base(path), i, placeholderSuffix)
+		}
+		s.byHost[host] = path
+		s.byPath[path] = host
+	}
+
+	return &url.URL{Scheme: "http", Host: host}
+}
+
+// DialContext wraps dial so placeholder hosts from Target dial their socket
+func (s *Sockets) DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+
+		s.mu.Lock()
+		path, ok := s.byHost[host]
+		s.mu.Unlock()
+
+		if ok {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		return dial(ctx, network, addr)
+	}
+}
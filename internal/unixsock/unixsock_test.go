@@ -0,0 +1,175 @@
+package unixsock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		addr   string
+		path   string
+		isUnix bool
+	}{
+		{"unix:///run/chaos.sock", "/run/chaos.sock", true},
+		{"unix://chaos.sock", "chaos.sock", true},
+		{":8080", "", false},
+		{"127.0.0.1:8080", "", false},
+	}
+
+	for _, tt := range tests {
+		path, ok := Path(tt.addr)
+		if path != tt.path || ok != tt.isUnix {
+			t.Errorf("Path(%q): expected (%q, %v), got (%q, %v)", tt.addr, tt.path, tt.isUnix, path, ok)
+		}
+	}
+}
+
+func TestListen_Permissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chaos.sock")
+
+	ln, err := Listen(path, 0600)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected socket file, got: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected permissions 0600, got %o", perm)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected only the socket in its directory, got %v", entries)
+	}
+
+	ln.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected socket file to be removed on close, got: %v", err)
+	}
+}
+
+func TestListen_RemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chaos.sock")
+
+	// A listener that doesn't unlink on close leaves a stale file, like a crash
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := Listen(path, 0660)
+	if err != nil {
+		t.Fatalf("Expected stale socket to be replaced, got: %v", err)
+	}
+	ln.Close()
+}
+
+func TestListen_SocketInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chaos.sock")
+
+	first, err := Listen(path, 0660)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer first.Close()
+
+	if second, err := Listen(path, 0660); err == nil {
+		second.Close()
+		t.Error("Expected error for a socket in use, got nil")
+	}
+}
+
+func TestListen_NotASocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chaos.sock")
+	if err := os.WriteFile(path, []byte("important"), 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	if ln, err := Listen(path, 0660); err == nil {
+		ln.Close()
+		t.Error("Expected error for a regular file, got nil")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "important" {
+		t.Error("Expected regular file to be left alone")
+	}
+}
+
+func TestSockets_TargetAndDial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := Listen(path, 0660)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("over uds"))
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	sockets := NewSockets()
+	target := sockets.Target(&url.URL{Scheme: "unix", Path: path})
+	if target.Scheme != "http" || target.Host != "app.sock.unix.invalid" {
+		t.Errorf("Expected http://app.sock.unix.invalid, got %s", target)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = sockets.DialContext(transport.DialContext)
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(target.String() + "/")
+	if err != nil {
+		t.Fatalf("Expected request over the socket to succeed, got: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "over uds" {
+		t.Errorf("Expected 'over uds', got '%s'", body)
+	}
+}
+
+func TestSockets_DialRealHost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	sockets := NewSockets()
+	sockets.Target(&url.URL{Scheme: "unix", Path: path})
+
+	// A host named like the socket is dialed normally
+	var dialed string
+	dial := sockets.DialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = addr
+		return nil, errors.New("not dialing")
+	})
+	dial(context.Background(), "tcp", "app.sock:80")
+	if dialed != "app.sock:80" {
+		t.Errorf("Expected app.sock:80 to be dialed over the network, got %q", dialed)
+	}
+}
+
+func TestSockets_TargetDistinctPaths(t *testing.T) {
+	sockets := NewSockets()
+
+	a := sockets.Target(&url.URL{Scheme: "unix", Path: "/a/app.sock"})
+	b := sockets.Target(&url.URL{Scheme: "unix", Path: "/b/app.sock"})
+	again := sockets.Target(&url.URL{Scheme: "unix", Path: "/a/app.sock"})
+
+	if a.Host == b.Host {
+		t.Errorf("Expected distinct hosts for distinct sockets, both got %s", a.Host)
+	}
+	if again.Host != a.Host {
+		t.Errorf("Expected the same host for the same socket, got %s and %s", a.Host, again.Host)
+	}
+
+	tcp := &url.URL{Scheme: "http", Host: "localhost:3000"}
+	if got := sockets.Target(tcp); got != tcp {
+		t.Errorf("Expected non-unix URLs to pass through, got %s", got)
+	}
+}